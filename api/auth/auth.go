@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"git.neds.sh/matty/entain/common/httputil"
+	"git.neds.sh/matty/entain/common/identity"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys the authenticated subject and roles are forwarded to backend services with,
+// which the services read them from
+const (
+	SubjectMetadataKey = identity.SubjectMetadataKey
+	RolesMetadataKey   = identity.RolesMetadataKey
+)
+
+// AdminRole is the role required by routes with Admin access.
+const AdminRole = identity.AdminRole
+
+// Access is the level of authentication a route requires.
+type Access int
+
+const (
+	// Public routes can be called anonymously, although a token that is sent must be valid.
+	Public Access = iota
+	// Protected routes require a valid token.
+	Protected
+	// Admin routes require a valid token holding the admin role.
+	Admin
+)
+
+// ParseAccess converts the name of an access level, as used in flags, to its Access.
+func ParseAccess(name string) (Access, error) {
+	switch strings.ToLower(name) {
+	case "public":
+		return Public, nil
+	case "protected":
+		return Protected, nil
+	case "admin":
+		return Admin, nil
+	default:
+		return Public, fmt.Errorf("unknown access %q", name)
+	}
+}
+
+// Rule marks the routes matching a method and path with the access they require.
+// Path segments of * match any single segment, such as the id in /v1/event/*/score.
+type Rule struct {
+	Method string
+	Path   string
+	Access Access
+}
+
+func (r Rule) matches(method string, path string) bool {
+	return httputil.MatchRoute(r.Method+" "+r.Path, method, path)
+}
+
+// Claims are the JWT claims used by the gateway, roles being held in a roles claim.
+type Claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles"`
+}
+
+// HasRole reports whether the claims hold a role.
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type claimsContextKey struct{}
+
+// ClaimsFromContext returns the claims of an authenticated request, or nil for anonymous requests.
+func ClaimsFromContext(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims
+}
+
+// Authenticator validates bearer tokens and enforces the access rules of routes.
+type Authenticator struct {
+	keys          []*Key
+	rules         []Rule
+	defaultAccess Access
+	issuer        string
+	audience      string
+	parser        *jwt.Parser
+}
+
+// NewAuthenticator creates an authenticator verifying tokens with keys. Routes not matching
+// any rule require the default access. Tokens must be issued by the issuer and for the
+// audience when they are set.
+func NewAuthenticator(keys []*Key, rules []Rule, defaultAccess Access, issuer string, audience string) *Authenticator {
+	return &Authenticator{
+		keys:          keys,
+		rules:         rules,
+		defaultAccess: defaultAccess,
+		issuer:        issuer,
+		audience:      audience,
+		parser:        jwt.NewParser(jwt.WithValidMethods([]string{"HS256", "RS256"})),
+	}
+}
+
+// Access returns the access required by a route, from the first rule matching it.
+func (a *Authenticator) Access(method string, path string) Access {
+	for _, rule := range a.rules {
+		if rule.matches(method, path) {
+			return rule.Access
+		}
+	}
+	return a.defaultAccess
+}
+
+// Authenticate validates a bearer token, returning its claims.
+func (a *Authenticator) Authenticate(token string) (*Claims, error) {
+	var claims Claims
+
+	if _, err := a.parser.ParseWithClaims(token, &claims, a.key); err != nil {
+		return nil, err
+	}
+
+	//Tokens must expire, and the registered claims only check expiry when it is present
+	if claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("token has no expiry")
+	}
+	if len(claims.Subject) == 0 {
+		return nil, fmt.Errorf("token has no subject")
+	}
+	if len(a.issuer) > 0 && !claims.VerifyIssuer(a.issuer, true) {
+		return nil, fmt.Errorf("token issuer %q is not trusted", claims.Issuer)
+	}
+	if len(a.audience) > 0 && !claims.VerifyAudience(a.audience, true) {
+		return nil, fmt.Errorf("token is not for audience %q", a.audience)
+	}
+
+	return &claims, nil
+}
+
+// Find the key a token was signed with from its kid header, or the only key for its algorithm
+// when it has no kid. The key's algorithm must match the token's so that a public RSA key
+// can never be used as an HMAC secret.
+func (a *Authenticator) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	var found *Key
+	for _, key := range a.keys {
+		if key.Algorithm != token.Method.Alg() {
+			continue
+		}
+		if len(kid) > 0 && key.Id == kid {
+			return key.Material, nil
+		}
+		if len(kid) == 0 {
+			if found != nil {
+				return nil, fmt.Errorf("token has no kid and several keys match")
+			}
+			found = key
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("no %s key found for kid %q", token.Method.Alg(), kid)
+	}
+	return found.Material, nil
+}
+
+// Middleware authenticates requests before passing them to the next handler, rejecting
+// requests that lack the access their route requires. Errors are written in the same format
+// as the gateway mux writes them.
+func (a *Authenticator) Middleware(mux *runtime.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			//Clients must not be able to set the identity forwarded to the services themselves
+			for _, key := range []string{SubjectMetadataKey, RolesMetadataKey} {
+				r.Header.Del(key)
+				r.Header.Del(runtime.MetadataHeaderPrefix + key)
+			}
+
+			access := a.Access(r.Method, r.URL.Path)
+
+			var claims *Claims
+			if authorization := r.Header.Get("Authorization"); len(authorization) > 0 {
+				token := strings.TrimPrefix(authorization, "Bearer ")
+				if token == authorization {
+					a.writeError(mux, w, r, status.Error(codes.Unauthenticated, "authorization must be a bearer token"))
+					return
+				}
+
+				var err error
+				claims, err = a.Authenticate(token)
+				if err != nil {
+					a.writeError(mux, w, r, status.Errorf(codes.Unauthenticated, "invalid token: %s", err))
+					return
+				}
+			}
+
+			if access != Public && claims == nil {
+				a.writeError(mux, w, r, status.Error(codes.Unauthenticated, "authentication required"))
+				return
+			}
+			if access == Admin && !claims.HasRole(AdminRole) {
+				a.writeError(mux, w, r, status.Errorf(codes.PermissionDenied, "%s role required", AdminRole))
+				return
+			}
+
+			if claims != nil {
+				r = r.WithContext(context.WithValue(r.Context(), claimsContextKey{}, claims))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (a *Authenticator) writeError(mux *runtime.ServeMux, w http.ResponseWriter, r *http.Request, err error) {
+	if status.Code(err) == codes.Unauthenticated {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="entain"`)
+	}
+
+	_, outbound := runtime.MarshalerForRequest(mux, r)
+	runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+}
+
+// Metadata forwards the subject and roles of an authenticated request to the backend
+// services, for use with runtime.WithMetadata.
+func Metadata(ctx context.Context, r *http.Request) metadata.MD {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		return nil
+	}
+
+	return metadata.Pairs(
+		SubjectMetadataKey, claims.Subject,
+		RolesMetadataKey, strings.Join(claims.Roles, ","),
+	)
+}
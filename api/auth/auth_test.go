@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+var hmacSecret = []byte("test-secret-for-hs256-signing")
+
+// JWKS holding an HS256 secret and the public half of an RS256 key
+func testKeys(t *testing.T, rsaKey *rsa.PrivateKey) []*Key {
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kid": "hmac", "kty": "oct", "alg": "HS256", "k": %q},
+		{"kid": "rsa", "kty": "RSA", "alg": "RS256", "use": "sig", "n": %q, "e": %q}
+	]}`,
+		base64.RawURLEncoding.EncodeToString(hmacSecret),
+		base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	)
+
+	keys, err := ParseKeys([]byte(jwks))
+	if err != nil {
+		t.Fatalf("Error parsing keys: %v", err)
+	}
+	return keys
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims *Claims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if len(kid) > 0 {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Error signing token: %v", err)
+	}
+	return signed
+}
+
+func testClaims(subject string, roles ...string) *Claims {
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Issuer:    "entain-test",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Roles: roles,
+	}
+}
+
+// Tests requests are admitted or rejected according to the access of their route
+func TestMiddleware(t *testing.T) {
+	rsaKey := mustGenerateKey(t)
+
+	rules := []Rule{
+		{Method: http.MethodPost, Path: "/v1/event/*/score", Access: Admin},
+		{Method: http.MethodPost, Path: "/v1/list-markets", Access: Protected},
+	}
+	authenticator := NewAuthenticator(testKeys(t, rsaKey), rules, Public, "entain-test", "")
+
+	expired := testClaims("punter")
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+
+	otherKey := mustGenerateKey(t)
+	wrongIssuer := testClaims("punter")
+	wrongIssuer.Issuer = "elsewhere"
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		status        int
+		subject       string
+	}{
+		{"public anonymous", http.MethodPost, "/v1/list-races", "", http.StatusOK, ""},
+		{"protected anonymous", http.MethodPost, "/v1/list-markets", "", http.StatusUnauthorized, ""},
+		{"protected hs256", http.MethodPost, "/v1/list-markets", "Bearer " + signToken(t, jwt.SigningMethodHS256, "hmac", hmacSecret, testClaims("punter")), http.StatusOK, "punter"},
+		{"protected rs256 without kid", http.MethodPost, "/v1/list-markets", "Bearer " + signToken(t, jwt.SigningMethodRS256, "", rsaKey, testClaims("punter")), http.StatusOK, "punter"},
+		{"admin without role", http.MethodPost, "/v1/event/12/score", "Bearer " + signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims("punter")), http.StatusForbidden, ""},
+		{"admin with role", http.MethodPost, "/v1/event/12/score", "Bearer " + signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims("trader", "admin")), http.StatusOK, "trader"},
+		{"expired token", http.MethodPost, "/v1/list-races", "Bearer " + signToken(t, jwt.SigningMethodHS256, "hmac", hmacSecret, expired), http.StatusUnauthorized, ""},
+		{"unknown signer", http.MethodPost, "/v1/list-markets", "Bearer " + signToken(t, jwt.SigningMethodRS256, "rsa", otherKey, testClaims("punter")), http.StatusUnauthorized, ""},
+		{"wrong issuer", http.MethodPost, "/v1/list-markets", "Bearer " + signToken(t, jwt.SigningMethodHS256, "hmac", hmacSecret, wrongIssuer), http.StatusUnauthorized, ""},
+		{"not a bearer token", http.MethodPost, "/v1/list-markets", "Basic cHVudGVyOnB1bnRlcg==", http.StatusUnauthorized, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var subject string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if claims := ClaimsFromContext(r.Context()); claims != nil {
+					subject = claims.Subject
+				}
+			})
+
+			request := httptest.NewRequest(test.method, test.path, nil)
+			if len(test.authorization) > 0 {
+				request.Header.Set("Authorization", test.authorization)
+			}
+
+			recorder := httptest.NewRecorder()
+			authenticator.Middleware(runtime.NewServeMux())(next).ServeHTTP(recorder, request)
+
+			if recorder.Code != test.status {
+				t.Errorf("Expected status %d, got %d %s", test.status, recorder.Code, recorder.Body.String())
+			}
+			if subject != test.subject {
+				t.Errorf("Expected subject %q, got %q", test.subject, subject)
+			}
+		})
+	}
+}
+
+// Tests an RS256 public key cannot be used as an HS256 secret
+func TestAlgorithmConfusion(t *testing.T) {
+	rsaKey := mustGenerateKey(t)
+	keys := testKeys(t, rsaKey)
+	authenticator := NewAuthenticator(keys[1:], nil, Public, "", "")
+
+	token := signToken(t, jwt.SigningMethodHS256, "rsa", rsaKey.N.Bytes(), testClaims("attacker", "admin"))
+	if _, err := authenticator.Authenticate(token); err == nil {
+		t.Error("Expected HS256 token signed with RSA key material to be rejected")
+	}
+}
+
+// Tests identity headers sent by clients are replaced by the authenticated identity
+func TestMetadata(t *testing.T) {
+	authenticator := NewAuthenticator(testKeys(t, mustGenerateKey(t)), nil, Public, "", "")
+
+	var forwarded []string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = append(forwarded, r.Header.Get(runtime.MetadataHeaderPrefix+RolesMetadataKey))
+		md := Metadata(context.TODO(), r)
+		forwarded = append(forwarded, md.Get(SubjectMetadataKey)...)
+		forwarded = append(forwarded, md.Get(RolesMetadataKey)...)
+	})
+
+	request := httptest.NewRequest(http.MethodPost, "/v1/list-races", nil)
+	request.Header.Set(runtime.MetadataHeaderPrefix+RolesMetadataKey, "admin")
+	request.Header.Set("Authorization", "Bearer "+signToken(t, jwt.SigningMethodHS256, "hmac", hmacSecret, testClaims("punter", "punter", "vip")))
+
+	authenticator.Middleware(runtime.NewServeMux())(next).ServeHTTP(httptest.NewRecorder(), request)
+
+	expected := []string{"", "punter", "punter,vip"}
+	if fmt.Sprint(forwarded) != fmt.Sprint(expected) {
+		t.Errorf("Expected forwarded identity %q, got %q", expected, forwarded)
+	}
+}
+
+func mustGenerateKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+)
+
+// Key is a token verification key loaded from a JWKS file.
+type Key struct {
+	// Id matches the kid header of tokens signed with the key.
+	Id string
+	// Algorithm is the signing algorithm the key verifies, HS256 or RS256.
+	Algorithm string
+	// Material is the HMAC secret as []byte or the *rsa.PublicKey.
+	Material interface{}
+}
+
+// JSON web key, holding the fields of symmetric (oct) and RSA keys
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// LoadKeys reads the verification keys from a local JWKS file. Symmetric keys verify HS256
+// tokens and RSA keys verify RS256 tokens, other keys are rejected.
+func LoadKeys(path string) ([]*Key, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseKeys(data)
+}
+
+// ParseKeys parses verification keys from a JWKS document.
+func ParseKeys(data []byte) ([]*Key, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("parsing JWKS: %w", err)
+	}
+
+	var keys []*Key
+	for i, jwk := range jwks.Keys {
+		//Keys for encryption are of no use for verifying tokens
+		if len(jwk.Use) > 0 && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := parseKey(jwk)
+		if err != nil {
+			return nil, fmt.Errorf("parsing JWKS key %d: %w", i, err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func parseKey(jwk jsonWebKey) (*Key, error) {
+	switch jwk.Kty {
+	case "oct":
+		if len(jwk.Alg) > 0 && jwk.Alg != "HS256" {
+			return nil, fmt.Errorf("unsupported algorithm %q for oct key", jwk.Alg)
+		}
+
+		secret, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil || len(secret) == 0 {
+			return nil, fmt.Errorf("invalid secret for oct key")
+		}
+
+		return &Key{Id: jwk.Kid, Algorithm: "HS256", Material: secret}, nil
+	case "RSA":
+		if len(jwk.Alg) > 0 && jwk.Alg != "RS256" {
+			return nil, fmt.Errorf("unsupported algorithm %q for RSA key", jwk.Alg)
+		}
+
+		modulus, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil || len(modulus) == 0 {
+			return nil, fmt.Errorf("invalid modulus for RSA key")
+		}
+		exponent, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil || len(exponent) == 0 {
+			return nil, fmt.Errorf("invalid exponent for RSA key")
+		}
+
+		publicKey := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: int(new(big.Int).SetBytes(exponent).Int64()),
+		}
+
+		return &Key{Id: jwk.Kid, Algorithm: "RS256", Material: publicKey}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
@@ -0,0 +1,302 @@
+// Package cache caches the responses of read routes in the gateway, serving repeated requests
+// without calling the services, with ETags so that clients can revalidate them for free.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.neds.sh/matty/entain/common/httputil"
+	"git.neds.sh/matty/entain/common/logging"
+)
+
+// CacheHeader reports whether a response was served from the cache, HIT, or not, MISS.
+const CacheHeader = "X-Cache"
+
+// Fields of resources holding the times their status changes, such as a race closing at its
+// advertised start time. Responses are never cached past the next of these times.
+var boundaryFields = map[string]bool{
+	"advertisedStartTime":   true,
+	"advertised_start_time": true,
+	"expectedEndTime":       true,
+	"expected_end_time":     true,
+}
+
+// Route is a route by method and path, such as "GET /v1/race/*", where * matches any single
+// path segment. Scope names the cached responses a route reads or invalidates by writing,
+// such as those of a service.
+type Route struct {
+	Route string
+	Scope string
+}
+
+// Cache caches the successful responses of routes for a TTL, and invalidates every response
+// in a scope when a write to it succeeds.
+type Cache struct {
+	store         Store
+	ttl           time.Duration
+	routes        []Route
+	invalidations []Route
+	now           func() time.Time
+}
+
+// Cached responses are stored with their content type and ETag
+type entry struct {
+	ContentType string    `json:"content_type"`
+	ETag        string    `json:"etag"`
+	Expires     time.Time `json:"expires"`
+	Body        []byte    `json:"body"`
+}
+
+// New creates a cache of the responses of routes in a store, for at most the TTL. Successful
+// requests to the invalidation routes invalidate the responses in their scope.
+func New(store Store, ttl time.Duration, routes []Route, invalidations []Route) *Cache {
+	return &Cache{
+		store:         store,
+		ttl:           ttl,
+		routes:        routes,
+		invalidations: invalidations,
+		now:           time.Now,
+	}
+}
+
+// Middleware serves the responses of cached routes from the cache, and invalidates them
+// after writes.
+func (c *Cache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if scope, ok := match(c.routes, r.Method, r.URL.Path); ok {
+			c.serveCached(w, r, next, scope)
+			return
+		}
+
+		if scope, ok := match(c.invalidations, r.Method, r.URL.Path); ok {
+			recorder := httputil.NewResponseRecorder(w)
+			next.ServeHTTP(recorder, r)
+
+			if recorder.Status >= 200 && recorder.Status < 300 {
+				c.Invalidate(r.Context(), scope)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Invalidate invalidates every cached response in a scope, which is done by moving the scope
+// to a new generation of keys, leaving the old keys to expire.
+func (c *Cache) Invalidate(ctx context.Context, scope string) {
+	if _, err := c.store.Incr(ctx, generationKey(scope)); err != nil {
+		logging.FromContext(ctx).Error("failed invalidating cached responses", "scope", scope, "error", err)
+	}
+}
+
+func (c *Cache) serveCached(w http.ResponseWriter, r *http.Request, next http.Handler, scope string) {
+	ctx := r.Context()
+
+	key, err := c.key(r, scope)
+	if err != nil {
+		//The cache is bypassed while it is unavailable, rather than failing requests
+		logging.FromContext(ctx).Warn("failed reading cached responses", "scope", scope, "error", err)
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	if cached, ok, err := c.store.Get(ctx, key); err != nil {
+		logging.FromContext(ctx).Warn("failed reading cached response", "scope", scope, "error", err)
+	} else if ok {
+		var e entry
+		if err := json.Unmarshal(cached, &e); err == nil && c.now().Before(e.Expires) {
+			w.Header().Set(CacheHeader, "HIT")
+			c.write(w, r, &e)
+			return
+		}
+	}
+
+	buffer := newBufferedResponse()
+	next.ServeHTTP(buffer, r)
+
+	if buffer.status != http.StatusOK {
+		buffer.writeTo(w)
+		return
+	}
+
+	e := &entry{
+		ContentType: buffer.header.Get("Content-Type"),
+		ETag:        etag(buffer.body.Bytes()),
+		Expires:     c.expires(buffer.body.Bytes()),
+		Body:        buffer.body.Bytes(),
+	}
+
+	if e.Expires.After(c.now()) {
+		encoded, _ := json.Marshal(e)
+		if err := c.store.Set(ctx, key, encoded, e.Expires.Sub(c.now())); err != nil {
+			logging.FromContext(ctx).Warn("failed caching response", "scope", scope, "error", err)
+		}
+	}
+
+	for name, values := range buffer.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(CacheHeader, "MISS")
+	c.write(w, r, e)
+}
+
+// Write a response with its ETag and freshness, or 304 Not Modified if the client holds it
+func (c *Cache) write(w http.ResponseWriter, r *http.Request, e *entry) {
+	maxAge := int(e.Expires.Sub(c.now()) / time.Second)
+	if maxAge < 0 {
+		maxAge = 0
+	}
+
+	w.Header().Set("ETag", e.ETag)
+	w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(maxAge))
+
+	if etagMatches(r.Header.Get("If-None-Match"), e.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if len(e.ContentType) > 0 {
+		w.Header().Set("Content-Type", e.ContentType)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(e.Body)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(e.Body)
+}
+
+// Responses are keyed by the generation of their scope, and the route and normalised body of
+// the request, so that requests differing only in JSON formatting or field order share them
+func (c *Cache) key(r *http.Request, scope string) (string, error) {
+	generation, _, err := c.store.Get(r.Context(), generationKey(scope))
+	if err != nil {
+		return "", err
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		body, _ = json.Marshal(decoded)
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "?" + r.URL.Query().Encode() + "\n"))
+	hash.Write(body)
+
+	return "response:" + scope + ":" + string(generation) + ":" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Responses expire after the TTL, or sooner when a resource in them changes status
+func (c *Cache) expires(body []byte) time.Time {
+	now := c.now()
+	expires := now.Add(c.ttl)
+
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return expires
+	}
+
+	walkBoundaries(decoded, func(boundary time.Time) {
+		if boundary.After(now) && boundary.Before(expires) {
+			expires = boundary
+		}
+	})
+
+	return expires
+}
+
+func walkBoundaries(value interface{}, visit func(time.Time)) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for field, nested := range value {
+			if s, ok := nested.(string); ok && boundaryFields[field] {
+				if boundary, err := time.Parse(time.RFC3339Nano, s); err == nil {
+					visit(boundary)
+				}
+				continue
+			}
+			walkBoundaries(nested, visit)
+		}
+	case []interface{}:
+		for _, nested := range value {
+			walkBoundaries(nested, visit)
+		}
+	}
+}
+
+func generationKey(scope string) string {
+	return "generation:" + scope
+}
+
+func etag(body []byte) string {
+	hash := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+// If-None-Match holds a list of ETags, or *, compared weakly
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func match(routes []Route, method string, path string) (string, bool) {
+	for _, route := range routes {
+		if httputil.MatchRoute(route.Route, method, path) {
+			return route.Scope, true
+		}
+	}
+	return "", false
+}
+
+// Responses to cacheable requests are buffered, so that they can be stored before being sent
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header)}
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for name, values := range b.header {
+		w.Header()[name] = values
+	}
+	b.WriteHeader(http.StatusOK)
+	w.WriteHeader(b.status)
+	_, _ = w.Write(b.body.Bytes())
+}
@@ -0,0 +1,287 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"git.neds.sh/matty/entain/api/proto/sports"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	testRoutes = []Route{
+		{Route: "GET /v1/race/*", Scope: "racing"},
+		{Route: "POST /v1/list-races", Scope: "racing"},
+	}
+	testInvalidations = []Route{
+		{Route: "POST /v1/race/*/result", Scope: "racing"},
+	}
+)
+
+// A backend counting the requests it serves, which responds with a race starting at a time
+type testBackend struct {
+	calls int
+	start time.Time
+}
+
+func (b *testBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.calls++
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/404"):
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/result"):
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"race":{"id":"1","advertisedStartTime":"` + b.start.Format(time.RFC3339) + `","status":"OPEN"}}`))
+	}
+}
+
+// Create a cache in a store with a clock the test controls, in front of a test backend
+func newTestCache(store Store, now *time.Time) (http.Handler, *testBackend) {
+	c := New(store, time.Minute, testRoutes, testInvalidations)
+	c.now = func() time.Time { return *now }
+
+	backend := &testBackend{start: now.Add(time.Hour)}
+	return c.Middleware(backend), backend
+}
+
+func serve(handler http.Handler, method string, path string, body string, ifNoneMatch string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if len(ifNoneMatch) > 0 {
+		request.Header.Set("If-None-Match", ifNoneMatch)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// Tests responses are cached, revalidated with ETags, and invalidated by writes, in each store
+func TestCache(t *testing.T) {
+	for name, store := range map[string]Store{
+		"memory": NewMemoryStore(100),
+		"redis":  NewRedisStore(newTestRedis(t)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+			handler, backend := newTestCache(store, &now)
+
+			first := serve(handler, http.MethodGet, "/v1/race/1", "", "")
+			second := serve(handler, http.MethodGet, "/v1/race/1", "", "")
+			if backend.calls != 1 || first.Header().Get(CacheHeader) != "MISS" || second.Header().Get(CacheHeader) != "HIT" {
+				t.Fatalf("Expected the second request served from the cache, got %d calls", backend.calls)
+			}
+			if first.Body.String() != second.Body.String() || second.Header().Get("Content-Type") != "application/json" || second.Header().Get("Cache-Control") != "max-age=60" {
+				t.Errorf("Expected the cached response to match, got %v %s", second.Header(), second.Body.String())
+			}
+
+			etag := first.Header().Get("ETag")
+			if notModified := serve(handler, http.MethodGet, "/v1/race/1", "", `"other", `+etag); notModified.Code != http.StatusNotModified || notModified.Body.Len() != 0 {
+				t.Errorf("Expected 304 Not Modified for a matching ETag, got %d", notModified.Code)
+			}
+
+			//Bodies are normalised, so the same request formatted differently shares a response
+			serve(handler, http.MethodPost, "/v1/list-races", `{"filter": {"meeting_ids": ["1"], "visible_only": true}}`, "")
+			serve(handler, http.MethodPost, "/v1/list-races", `{"filter":{"visible_only":true,"meeting_ids":["1"]}}`, "")
+			if backend.calls != 2 {
+				t.Errorf("Expected equivalent bodies to share a response, got %d calls", backend.calls)
+			}
+
+			//Failed responses aren't cached
+			serve(handler, http.MethodGet, "/v1/race/404", "", "")
+			serve(handler, http.MethodGet, "/v1/race/404", "", "")
+			if backend.calls != 4 {
+				t.Errorf("Expected failed responses not to be cached, got %d calls", backend.calls)
+			}
+
+			serve(handler, http.MethodPost, "/v1/race/1/result", "{}", "")
+			if invalidated := serve(handler, http.MethodGet, "/v1/race/1", "", ""); invalidated.Header().Get(CacheHeader) != "MISS" || backend.calls != 6 {
+				t.Errorf("Expected the write to invalidate the cached response, got %d calls", backend.calls)
+			}
+		})
+	}
+}
+
+// Tests responses expire when a race in them is due to change status, before the TTL
+func TestStatusBoundary(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	handler, backend := newTestCache(NewMemoryStore(100), &now)
+	backend.start = now.Add(20 * time.Second)
+
+	if response := serve(handler, http.MethodGet, "/v1/race/1", "", ""); response.Header().Get("Cache-Control") != "max-age=20" {
+		t.Errorf("Expected the response to be fresh until the race starts, got %s", response.Header().Get("Cache-Control"))
+	}
+
+	now = now.Add(20 * time.Second)
+	serve(handler, http.MethodGet, "/v1/race/1", "", "")
+	if backend.calls != 2 {
+		t.Errorf("Expected the response to expire when the race started, got %d calls", backend.calls)
+	}
+}
+
+// Tests the memory store drops entries to stay within its maximum
+func TestMemoryStoreEviction(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(2)
+
+	_, _ = store.Incr(ctx, "generation:racing")
+	_ = store.Set(ctx, "a", []byte("a"), time.Minute)
+	_ = store.Set(ctx, "b", []byte("b"), time.Minute)
+
+	if len(store.entries) != 2 {
+		t.Errorf("Expected 2 entries, got %d", len(store.entries))
+	}
+	if generation, ok, _ := store.Get(ctx, "generation:racing"); !ok || string(generation) != "1" {
+		t.Errorf("Expected counters to be kept, got %q", generation)
+	}
+}
+
+// Start a stand-in for Redis serving GET, SET and INCR from a memory store, returning its address
+func newTestRedis(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	store := NewMemoryStore(100)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestRedis(conn, store)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func serveTestRedis(conn net.Conn, store *MemoryStore) {
+	defer conn.Close()
+	ctx := context.Background()
+	reader := bufio.NewReader(conn)
+
+	for {
+		command, err := readReply(reader)
+		if err != nil {
+			return
+		}
+
+		var args []string
+		for _, arg := range command.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "GET":
+			value, ok, _ := store.Get(ctx, args[1])
+			if ok {
+				reply = "$" + strconv.Itoa(len(value)) + "\r\n" + string(value) + "\r\n"
+			} else {
+				reply = "$-1\r\n"
+			}
+		case "SET":
+			ms, _ := strconv.Atoi(args[4])
+			_ = store.Set(ctx, args[1], []byte(args[2]), time.Duration(ms)*time.Millisecond)
+			reply = "+OK\r\n"
+		case "INCR":
+			counter, _ := store.Incr(ctx, args[1])
+			reply = ":" + strconv.FormatInt(counter, 10) + "\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+// Watches events by handing out streams of updates in turn, recording what was resumed after
+type mockSportsClient struct {
+	sports.SportsClient
+	streams  [][]*sports.WatchEventsResponse
+	afterIds []uint64
+	// Closed once every stream has been handed out and the watcher waits for another
+	waiting chan struct{}
+}
+
+func (m *mockSportsClient) WatchEvents(ctx context.Context, in *sports.WatchEventsRequest, opts ...grpc.CallOption) (sports.Sports_WatchEventsClient, error) {
+	m.afterIds = append(m.afterIds, in.AfterId)
+	if len(m.streams) == 0 {
+		close(m.waiting)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	stream := &mockWatchStream{updates: m.streams[0]}
+	m.streams = m.streams[1:]
+	return stream, nil
+}
+
+type mockWatchStream struct {
+	sports.Sports_WatchEventsClient
+	updates []*sports.WatchEventsResponse
+}
+
+func (s *mockWatchStream) Recv() (*sports.WatchEventsResponse, error) {
+	if len(s.updates) == 0 {
+		return nil, status.Error(codes.Unavailable, "service shutting down")
+	}
+	update := s.updates[0]
+	s.updates = s.updates[1:]
+	return update, nil
+}
+
+// Tests cached responses are invalidated as scores change, resuming the watch when it fails
+func TestWatchScores(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore(100)
+	c := New(store, time.Minute, testRoutes, testInvalidations)
+	c.now = func() time.Time { return now }
+	handler := c.Middleware(&testBackend{start: now.Add(time.Hour)})
+
+	serve(handler, http.MethodGet, "/v1/race/1", "", "")
+	if response := serve(handler, http.MethodGet, "/v1/race/1", "", ""); response.Header().Get(CacheHeader) != "HIT" {
+		t.Fatalf("Expected the response to be cached, got %s", response.Header().Get(CacheHeader))
+	}
+
+	client := &mockSportsClient{streams: [][]*sports.WatchEventsResponse{
+		{{Id: 3, Missed: true}, {Id: 4, Type: "SCORE"}},
+		{{Id: 5, Type: "SCORE"}},
+	}, waiting: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.WatchScores(ctx, client, "racing", time.Millisecond)
+		close(done)
+	}()
+
+	<-client.waiting
+	cancel()
+	<-done
+
+	if len(client.afterIds) != 3 || client.afterIds[0] != 0 || client.afterIds[1] != 4 || client.afterIds[2] != 5 {
+		t.Errorf("Expected the watch to resume after the last update received, got %v", client.afterIds)
+	}
+	if generation, _, _ := store.Get(context.Background(), generationKey("racing")); string(generation) != "3" {
+		t.Errorf("Expected the scope invalidated for each update, got generation %s", generation)
+	}
+	if response := serve(handler, http.MethodGet, "/v1/race/1", "", ""); response.Header().Get(CacheHeader) != "MISS" {
+		t.Errorf("Expected the cached response to be invalidated, got %s", response.Header().Get(CacheHeader))
+	}
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Connections kept open to Redis for reuse, and how long commands are given without a deadline
+const (
+	redisIdleConns = 8
+	redisTimeout   = time.Second
+)
+
+// RedisStore is a store in Redis, or any server speaking its protocol, so that cached responses
+// and invalidations are shared by every gateway instance.
+type RedisStore struct {
+	address string
+	idle    chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisStore creates a store in the Redis server at an address, such as localhost:6379.
+func NewRedisStore(address string) *RedisStore {
+	return &RedisStore{address: address, idle: make(chan *redisConn, redisIdleConns)}
+}
+
+// Get returns the value of a key, and whether it was found.
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := s.do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected reply to GET: %v", reply)
+	}
+	return value, true, nil
+}
+
+// Set sets the value of a key, expiring it after the TTL.
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := s.do(ctx, "SET", key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// Incr increments the counter at a key, which never expires, returning its new value.
+func (s *RedisStore) Incr(ctx context.Context, key string) (int64, error) {
+	reply, err := s.do(ctx, "INCR", key)
+	if err != nil {
+		return 0, err
+	}
+
+	counter, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected reply to INCR: %v", reply)
+	}
+	return counter, nil
+}
+
+// Send a command and read its reply, on an idle connection if there is one
+func (s *RedisStore) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if _, err := conn.Write(encodeCommand(args)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reply, err := readReply(conn.reader)
+
+	//Connections are only reused after a complete reply, errors from the server included
+	var serverErr redisError
+	if err != nil && !errors.As(err, &serverErr) {
+		conn.Close()
+		return nil, err
+	}
+	s.release(conn)
+
+	return reply, err
+}
+
+func (s *RedisStore) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-s.idle:
+		return conn, nil
+	default:
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return nil, err
+	}
+	return &redisConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+func (s *RedisStore) release(conn *redisConn) {
+	select {
+	case s.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// Commands are sent as arrays of bulk strings
+func encodeCommand(args []string) []byte {
+	command := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		command = append(command, "$"+strconv.Itoa(len(arg))+"\r\n"...)
+		command = append(command, arg...)
+		command = append(command, "\r\n"...)
+	}
+	return command
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// Read a reply, being a string, an error, an integer, a bulk string as bytes or nil, or an array
+func readReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	kind, value := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return value, nil
+	case '-':
+		return nil, redisError(value)
+	case ':':
+		return strconv.ParseInt(value, 10, 64)
+	case '$':
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 0 {
+			return nil, err
+		}
+		bulk := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, bulk); err != nil {
+			return nil, err
+		}
+		return bulk[:length], nil
+	case '*':
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 0 {
+			return nil, err
+		}
+		array := make([]interface{}, length)
+		for i := range array {
+			if array[i], err = readReply(reader); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	}
+
+	return nil, fmt.Errorf("malformed reply %q", line)
+}
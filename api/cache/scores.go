@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"git.neds.sh/matty/entain/api/proto/sports"
+	"git.neds.sh/matty/entain/common/logging"
+)
+
+// WatchScores invalidates the cached responses in a scope whenever an event's score changes,
+// watching the sports service's updates until the context is done. This covers scores updated
+// by calling the service directly, which the gateway's invalidation routes never see. A watch
+// that fails is reopened after the retry interval, resuming after the last update received.
+func (c *Cache) WatchScores(ctx context.Context, client sports.SportsClient, scope string, retry time.Duration) {
+	var afterId uint64
+	for {
+		err := c.watchScores(ctx, client, scope, &afterId)
+		if ctx.Err() != nil {
+			return
+		}
+		logging.Warn("failed watching scores, cached responses may be stale until it resumes", "scope", scope, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+func (c *Cache) watchScores(ctx context.Context, client sports.SportsClient, scope string, afterId *uint64) error {
+	stream, err := client.WatchEvents(ctx, &sports.WatchEventsRequest{
+		Filter:  &sports.WatchEventsRequestFilter{Types: []string{"SCORE"}},
+		AfterId: *afterId,
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		update, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		//Scores may have changed in updates that were missed, as well as in those received
+		c.Invalidate(ctx, scope)
+		*afterId = update.Id
+	}
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Store holds cached responses, such as in memory or in Redis shared by gateway instances.
+type Store interface {
+	// Get returns the value of a key, and whether it was found.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set sets the value of a key, expiring it after the TTL.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Incr increments the counter at a key, which never expires, returning its new value.
+	Incr(ctx context.Context, key string) (int64, error)
+}
+
+// MemoryStore is a store local to the gateway, holding up to a maximum number of entries.
+type MemoryStore struct {
+	mu         sync.Mutex
+	entries    map[string]memoryEntry
+	maxEntries int
+	now        func() time.Time
+}
+
+// Entries without an expiry, such as counters, have a zero expires
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryStore creates a store holding up to a maximum number of entries.
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	return &MemoryStore{
+		entries:    make(map[string]memoryEntry),
+		maxEntries: maxEntries,
+		now:        time.Now,
+	}
+}
+
+// Get returns the value of a key, and whether it was found.
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if s.expired(entry) {
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+
+	return entry.value, true, nil
+}
+
+// Set sets the value of a key, expiring it after the TTL.
+func (s *MemoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[key]; !ok && len(s.entries) >= s.maxEntries {
+		s.evict()
+	}
+	s.entries[key] = memoryEntry{value: value, expires: s.now().Add(ttl)}
+
+	return nil
+}
+
+// Incr increments the counter at a key, which never expires, returning its new value.
+func (s *MemoryStore) Incr(ctx context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var counter int64
+	if entry, ok := s.entries[key]; ok {
+		counter, _ = strconv.ParseInt(string(entry.value), 10, 64)
+	}
+	counter++
+	s.entries[key] = memoryEntry{value: []byte(strconv.FormatInt(counter, 10))}
+
+	return counter, nil
+}
+
+func (s *MemoryStore) expired(entry memoryEntry) bool {
+	return !entry.expires.IsZero() && !s.now().Before(entry.expires)
+}
+
+// Make room for an entry by dropping expired entries, or failing that any entry but counters,
+// which responses are cached under
+func (s *MemoryStore) evict() {
+	for key, entry := range s.entries {
+		if s.expired(entry) {
+			delete(s.entries, key)
+		}
+	}
+	for key, entry := range s.entries {
+		if len(s.entries) < s.maxEntries {
+			return
+		}
+		if !entry.expires.IsZero() {
+			delete(s.entries, key)
+		}
+	}
+}
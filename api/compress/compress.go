@@ -0,0 +1,196 @@
+// Package compress compresses the responses of the gateway with brotli or gzip, whichever the
+// client prefers of those it accepts.
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Responses smaller than this are sent as they are, as compressing them saves little
+const minSize = 1024
+
+// Encodings supported, preferred in this order when the client accepts them equally
+var encodings = []string{"br", "gzip"}
+
+// Brotli's default quality is too slow for responses written on every request
+const brotliQuality = 5
+
+// Middleware compresses responses of compressible content types, such as JSON and HTML, in the
+// encoding negotiated from the Accept-Encoding header. Streamed responses are compressed as
+// they are flushed, and upgraded connections are left alone.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiate(r.Header.Get("Accept-Encoding"))
+		if len(encoding) == 0 || len(r.Header.Get("Upgrade")) > 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writer := &writer{ResponseWriter: w, encoding: encoding, status: http.StatusOK}
+		defer writer.Close()
+
+		next.ServeHTTP(writer, r)
+	})
+}
+
+// The supported encoding the client prefers, or none if it accepts neither
+func negotiate(acceptEncoding string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params := part, ""
+		if i := strings.Index(part, ";"); i >= 0 {
+			name, params = part[:i], part[i+1:]
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		quality := 1.0
+		if value := strings.TrimSpace(params); strings.HasPrefix(value, "q=") {
+			q, err := strconv.ParseFloat(value[2:], 64)
+			if err != nil {
+				continue
+			}
+			quality = q
+		}
+		qualities[name] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range encodings {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+// Content types worth compressing, which excludes images and others already compressed
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "+xml") ||
+		mediaType == "application/javascript" ||
+		mediaType == "application/xml"
+}
+
+// Writer holding back the start of a response until it is known whether it is worth
+// compressing, which is once minSize bytes are written, it is flushed, or it ends
+type writer struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+
+	buffer  []byte
+	decided bool
+	encoder io.WriteCloser
+}
+
+func (w *writer) WriteHeader(status int) {
+	if !w.decided {
+		w.status = status
+	}
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buffer = append(w.buffer, b...)
+		if len(w.buffer) < minSize {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if w.encoder != nil {
+		return w.encoder.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends what has been written so far, compressing streamed responses however small.
+func (w *writer) Flush() {
+	if !w.decided {
+		if err := w.decide(true); err != nil {
+			return
+		}
+	}
+
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close ends the response, sending it as it is if it was never worth compressing.
+func (w *writer) Close() error {
+	if !w.decided {
+		return w.decide(false)
+	}
+	if w.encoder != nil {
+		return w.encoder.Close()
+	}
+	return nil
+}
+
+// Write the header, compressing the body if it is large or streamed enough and compressible
+func (w *writer) decide(large bool) error {
+	w.decided = true
+
+	header := w.Header()
+	compress := large &&
+		len(header.Get("Content-Encoding")) == 0 &&
+		compressible(header.Get("Content-Type")) &&
+		w.status != http.StatusNoContent && w.status != http.StatusNotModified
+
+	if compress {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+
+		//The compressed body is a different representation, so its ETag can only match weakly
+		if etag := header.Get("ETag"); len(etag) > 0 && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+
+		if w.encoding == "br" {
+			w.encoder = brotli.NewWriterLevel(w.ResponseWriter, brotliQuality)
+		} else {
+			w.encoder = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buffer := w.buffer
+	w.buffer = nil
+	if len(buffer) == 0 {
+		return nil
+	}
+
+	if w.encoder != nil {
+		_, err := w.encoder.Write(buffer)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buffer)
+	return err
+}
@@ -0,0 +1,104 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+var largeBody = `{"races":[` + strings.Repeat(`{"name":"Flemington Cup"},`, 100) + `{}]}`
+
+func serve(acceptEncoding string, contentType string, body string) *httptest.ResponseRecorder {
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte(body))
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/v1/races", nil)
+	if len(acceptEncoding) > 0 {
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// Tests large responses are compressed in the encoding the client prefers
+func TestCompresses(t *testing.T) {
+	recorder := serve("gzip, deflate, br", "application/json", largeBody)
+	if recorder.Header().Get("Content-Encoding") != "br" || recorder.Header().Get("ETag") != `W/"abc"` {
+		t.Fatalf("Expected brotli with a weak ETag, got %v", recorder.Header())
+	}
+	body, err := ioutil.ReadAll(brotli.NewReader(recorder.Body))
+	if err != nil || string(body) != largeBody {
+		t.Errorf("Expected the body to decompress, got %v", err)
+	}
+
+	recorder = serve("br;q=0.5, gzip", "application/json", largeBody)
+	if recorder.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip, got %v", recorder.Header())
+	}
+	reader, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = ioutil.ReadAll(reader)
+	if err != nil || string(body) != largeBody {
+		t.Errorf("Expected the body to decompress, got %v", err)
+	}
+	if recorder.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Expected responses to vary by encoding, got %v", recorder.Header())
+	}
+}
+
+// Tests small, incompressible and unaccepted responses are sent as they are
+func TestLeavesUncompressed(t *testing.T) {
+	for _, test := range []struct {
+		acceptEncoding, contentType, body string
+	}{
+		{"gzip, br", "application/json", `{"races":[]}`},
+		{"gzip, br", "image/png", largeBody},
+		{"", "application/json", largeBody},
+		{"deflate", "application/json", largeBody},
+		{"br;q=0, gzip;q=0", "application/json", largeBody},
+	} {
+		recorder := serve(test.acceptEncoding, test.contentType, test.body)
+		if recorder.Header().Get("Content-Encoding") != "" || !bytes.Equal(recorder.Body.Bytes(), []byte(test.body)) {
+			t.Errorf("Expected %s accepting %q to be uncompressed, got %v", test.contentType, test.acceptEncoding, recorder.Header())
+		}
+	}
+}
+
+// Tests streamed responses are compressed as they are flushed, however small
+func TestFlushes(t *testing.T) {
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {}\n\n"))
+		w.(http.Flusher).Flush()
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/v1/stream", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if !recorder.Flushed || recorder.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected the stream to be flushed compressed, got %v", recorder.Header())
+	}
+	reader, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil || string(body) != "data: {}\n\n" {
+		t.Errorf("Expected the event to decompress, got %q %v", body, err)
+	}
+}
@@ -0,0 +1,140 @@
+// Package cors lets browser apps on other origins call the gateway, answering CORS preflight
+// requests and marking the responses of allowed origins as readable by them.
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of gateway responses that browser apps may read, beyond those CORS always exposes
+var exposedHeaders = []string{"ETag", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "X-Cache", "X-Request-Id"}
+
+// Config holds the origins allowed to call the gateway, and what they may send.
+type Config struct {
+	// Origins allowed, such as https://app.example.com, or * for any.
+	AllowedOrigins []string
+	// Methods allowed in requests from those origins.
+	AllowedMethods []string
+	// Request headers allowed, such as Authorization, compared case insensitively.
+	AllowedHeaders []string
+	// How long browsers may cache a preflight response, not cached if 0.
+	MaxAge time.Duration
+}
+
+// CORS applies a config to requests from browsers on other origins.
+type CORS struct {
+	origins        map[string]bool
+	anyOrigin      bool
+	methods        map[string]bool
+	headers        map[string]bool
+	allowedMethods string
+	allowedHeaders string
+	maxAge         string
+}
+
+// New creates CORS handling for a config.
+func New(config Config) *CORS {
+	c := &CORS{
+		origins: make(map[string]bool),
+		methods: make(map[string]bool),
+		headers: make(map[string]bool),
+	}
+
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			c.anyOrigin = true
+		}
+		c.origins[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	var methods, headers []string
+	for _, method := range config.AllowedMethods {
+		method = strings.ToUpper(method)
+		c.methods[method] = true
+		methods = append(methods, method)
+	}
+	for _, header := range config.AllowedHeaders {
+		header = http.CanonicalHeaderKey(header)
+		c.headers[header] = true
+		headers = append(headers, header)
+	}
+
+	c.allowedMethods = strings.Join(methods, ", ")
+	c.allowedHeaders = strings.Join(headers, ", ")
+	if config.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(config.MaxAge.Seconds()))
+	}
+	return c
+}
+
+// Middleware answers preflight requests itself, without passing them on, so they are never
+// authenticated or rate limited. Other requests from allowed origins are passed on with
+// headers letting the browser read their responses. Requests from other origins are passed
+// on as they are, and it's left to the browser to keep their responses from the app.
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		header := w.Header()
+
+		if r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0 {
+			header.Add("Vary", "Origin")
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+
+			if c.Allowed(origin) && c.preflightAllowed(r) {
+				c.allowOrigin(header, origin)
+				header.Set("Access-Control-Allow-Methods", c.allowedMethods)
+				if len(c.allowedHeaders) > 0 {
+					header.Set("Access-Control-Allow-Headers", c.allowedHeaders)
+				}
+				if len(c.maxAge) > 0 {
+					header.Set("Access-Control-Max-Age", c.maxAge)
+				}
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		header.Add("Vary", "Origin")
+		if len(origin) > 0 && c.Allowed(origin) {
+			c.allowOrigin(header, origin)
+			header.Set("Access-Control-Expose-Headers", strings.Join(exposedHeaders, ", "))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Allowed returns whether browser apps on the origin may call the gateway, which WebSocket
+// upgrades are checked against too, as browsers don't send them preflight requests.
+func (c *CORS) Allowed(origin string) bool {
+	return len(origin) > 0 && (c.anyOrigin || c.origins[origin])
+}
+
+// Preflight requests are allowed if the method and every header to be sent are
+func (c *CORS) preflightAllowed(r *http.Request) bool {
+	if !c.methods[strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))] {
+		return false
+	}
+
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		header = strings.TrimSpace(header)
+		if len(header) > 0 && !c.headers[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
+
+// Any origin is allowed with *, as bearer tokens and API keys are sent as headers, never cookies
+func (c *CORS) allowOrigin(header http.Header, origin string) {
+	if c.anyOrigin {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+}
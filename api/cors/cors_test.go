@@ -0,0 +1,83 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var config = Config{
+	AllowedOrigins: []string{"https://app.example.com"},
+	AllowedMethods: []string{"GET", "POST"},
+	AllowedHeaders: []string{"Authorization", "content-type"},
+	MaxAge:         10 * time.Minute,
+}
+
+func serve(c *CORS, method string, headers map[string]string) (*httptest.ResponseRecorder, bool) {
+	called := false
+	handler := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	request := httptest.NewRequest(method, "/v1/races", nil)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder, called
+}
+
+// Tests preflight requests from allowed origins are answered without being passed on
+func TestPreflight(t *testing.T) {
+	recorder, called := serve(New(config), http.MethodOptions, map[string]string{
+		"Origin":                         "https://app.example.com",
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "authorization, Content-Type",
+	})
+
+	header := recorder.Header()
+	if called || recorder.Code != http.StatusNoContent {
+		t.Fatalf("Expected the preflight to be answered, got %d", recorder.Code)
+	}
+	if header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		header.Get("Access-Control-Allow-Methods") != "GET, POST" ||
+		header.Get("Access-Control-Allow-Headers") != "Authorization, Content-Type" ||
+		header.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("Expected the preflight to be allowed, got %v", header)
+	}
+}
+
+// Tests preflight requests from other origins, or for other methods and headers, aren't allowed
+func TestPreflightNotAllowed(t *testing.T) {
+	for _, headers := range []map[string]string{
+		{"Origin": "https://evil.example.com", "Access-Control-Request-Method": "GET"},
+		{"Origin": "https://app.example.com", "Access-Control-Request-Method": "DELETE"},
+		{"Origin": "https://app.example.com", "Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Secret"},
+	} {
+		recorder, called := serve(New(config), http.MethodOptions, headers)
+		if called || len(recorder.Header().Get("Access-Control-Allow-Origin")) > 0 {
+			t.Errorf("Expected the preflight %v not to be allowed, got %v", headers, recorder.Header())
+		}
+	}
+}
+
+// Tests responses to allowed origins can be read by them, and others are passed on as they are
+func TestRequests(t *testing.T) {
+	recorder, called := serve(New(config), http.MethodGet, map[string]string{"Origin": "https://app.example.com"})
+	if !called || recorder.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" || len(recorder.Header().Get("Access-Control-Expose-Headers")) == 0 {
+		t.Errorf("Expected the response to be readable by the origin, got %v", recorder.Header())
+	}
+
+	recorder, called = serve(New(config), http.MethodGet, map[string]string{"Origin": "https://evil.example.com"})
+	if !called || len(recorder.Header().Get("Access-Control-Allow-Origin")) > 0 {
+		t.Errorf("Expected the response not to be readable by another origin, got %v", recorder.Header())
+	}
+
+	recorder, _ = serve(New(Config{AllowedOrigins: []string{"*"}}), http.MethodGet, map[string]string{"Origin": "https://any.example.com"})
+	if recorder.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("Expected the response to be readable by any origin, got %v", recorder.Header())
+	}
+}
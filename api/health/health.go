@@ -0,0 +1,126 @@
+// Package health reports whether the gateway and the services behind it are healthy, for
+// orchestrators to decide when the gateway is live and ready to be sent traffic.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Backend is a service the gateway forwards requests to.
+type Backend struct {
+	Name string
+	// Service is the gRPC service whose health is checked, the backend's overall health if empty.
+	Service string
+	Client  healthpb.HealthClient
+}
+
+// Report is the health of the gateway and its backends.
+type Report struct {
+	// Status is SERVING when every backend is, and NOT_SERVING otherwise.
+	Status   string            `json:"status"`
+	Backends map[string]string `json:"backends"`
+}
+
+// Checker checks the health of the gateway's backends.
+type Checker struct {
+	backends []Backend
+	timeout  time.Duration
+}
+
+// NewChecker creates a checker of the backends, with checks taking longer than the timeout
+// reported as failed.
+func NewChecker(timeout time.Duration, backends ...Backend) *Checker {
+	return &Checker{backends: backends, timeout: timeout}
+}
+
+// Check checks the health of every backend concurrently. Backends that fail to respond are
+// reported with the reason, such as UNAVAILABLE when they can't be reached.
+func (c *Checker) Check(ctx context.Context) *Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := &Report{
+		Status:   healthpb.HealthCheckResponse_SERVING.String(),
+		Backends: make(map[string]string, len(c.backends)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, backend := range c.backends {
+		wg.Add(1)
+		go func(backend Backend) {
+			defer wg.Done()
+
+			backendStatus := checkBackend(ctx, backend)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			report.Backends[backend.Name] = backendStatus
+			if backendStatus != healthpb.HealthCheckResponse_SERVING.String() {
+				report.Status = healthpb.HealthCheckResponse_NOT_SERVING.String()
+			}
+		}(backend)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func checkBackend(ctx context.Context, backend Backend) string {
+	response, err := backend.Client.Check(ctx, &healthpb.HealthCheckRequest{Service: backend.Service})
+	if err != nil {
+		return errorStatus(err)
+	}
+	return response.Status.String()
+}
+
+// Failed checks are reported by their gRPC code in the same form as statuses, such as UNAVAILABLE
+func errorStatus(err error) string {
+	var name strings.Builder
+	for i, r := range status.Code(err).String() {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			name.WriteByte('_')
+		}
+		name.WriteRune(r)
+	}
+
+	return strings.ToUpper(name.String())
+}
+
+// LiveHandler serves the gateway's liveness. The gateway is live while it can serve requests,
+// whatever the health of its backends, so that it isn't restarted for their failures. The
+// backends' health is reported for information.
+func (c *Checker) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, http.StatusOK, c.Check(r.Context()))
+	})
+}
+
+// ReadyHandler serves the gateway's readiness, which requires every backend to be serving.
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Check(r.Context())
+
+		code := http.StatusOK
+		if report.Status != healthpb.HealthCheckResponse_SERVING.String() {
+			code = http.StatusServiceUnavailable
+		}
+		writeReport(w, code, report)
+	})
+}
+
+func writeReport(w http.ResponseWriter, code int, report *Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,67 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+type mockHealthClient struct {
+	healthpb.HealthClient
+	status healthpb.HealthCheckResponse_ServingStatus
+	err    error
+}
+
+func (c *mockHealthClient) Check(ctx context.Context, in *healthpb.HealthCheckRequest, opts ...grpc.CallOption) (*healthpb.HealthCheckResponse, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &healthpb.HealthCheckResponse{Status: c.status}, nil
+}
+
+func serve(handler http.Handler) (int, *Report) {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var report Report
+	_ = json.Unmarshal(recorder.Body.Bytes(), &report)
+
+	return recorder.Code, &report
+}
+
+// Tests the gateway is only ready when every backend is serving, but live regardless
+func TestHandlers(t *testing.T) {
+	racing := &mockHealthClient{status: healthpb.HealthCheckResponse_SERVING}
+	sports := &mockHealthClient{status: healthpb.HealthCheckResponse_SERVING}
+	checker := NewChecker(time.Second,
+		Backend{Name: "racing", Service: "racing.Racing", Client: racing},
+		Backend{Name: "sports", Service: "sports.Sports", Client: sports},
+	)
+
+	if code, report := serve(checker.ReadyHandler()); code != http.StatusOK || report.Status != "SERVING" {
+		t.Errorf("Expected ready with every backend serving, got %d %v", code, report)
+	}
+
+	sports.status = healthpb.HealthCheckResponse_NOT_SERVING
+	racing.err = status.Error(codes.Unavailable, "connection refused")
+
+	code, report := serve(checker.ReadyHandler())
+	if code != http.StatusServiceUnavailable || report.Status != "NOT_SERVING" {
+		t.Errorf("Expected not ready with backends failing, got %d %v", code, report)
+	}
+	if report.Backends["racing"] != "UNAVAILABLE" || report.Backends["sports"] != "NOT_SERVING" {
+		t.Errorf("Unexpected backend statuses %v", report.Backends)
+	}
+
+	if code, report := serve(checker.LiveHandler()); code != http.StatusOK || report.Backends["racing"] != "UNAVAILABLE" {
+		t.Errorf("Expected live with backend health reported, got %d %v", code, report)
+	}
+}
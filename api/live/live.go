@@ -0,0 +1,366 @@
+// Package live streams race status changes and event status and score changes to browsers, which
+// can't consume the services' gRPC streams, as Server-Sent Events or over WebSockets.
+package live
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"git.neds.sh/matty/entain/api/outgoing"
+	"git.neds.sh/matty/entain/api/params"
+	"git.neds.sh/matty/entain/api/proto/racing"
+	"git.neds.sh/matty/entain/api/proto/sports"
+	"git.neds.sh/matty/entain/common/logging"
+	"github.com/gorilla/websocket"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// How long browsers wait before reconnecting an event stream that ended, in milliseconds
+const retryMillis = 3000
+
+// How long a WebSocket close message is given to be written before the connection is closed
+const closeTimeout = time.Second
+
+// Streamer streams the updates watched from the racing and sports services to browsers.
+type Streamer struct {
+	racing    racing.RacingClient
+	sports    sports.SportsClient
+	heartbeat time.Duration
+	upgrader  websocket.Upgrader
+
+	done     chan struct{}
+	shutdown sync.Once
+}
+
+// NewStreamer creates a new streamer over the racing and sports services, sending heartbeats
+// every interval so that idle streams aren't closed by proxies. WebSockets may be opened from
+// the gateway's own origin, or those allowedOrigin allows if it isn't nil.
+func NewStreamer(racingClient racing.RacingClient, sportsClient sports.SportsClient, heartbeat time.Duration, allowedOrigin func(origin string) bool) *Streamer {
+	s := &Streamer{racing: racingClient, sports: sportsClient, heartbeat: heartbeat, done: make(chan struct{})}
+	s.upgrader.CheckOrigin = func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return len(origin) == 0 || sameOrigin(r, origin) || (allowedOrigin != nil && allowedOrigin(origin))
+	}
+	return s
+}
+
+// Shutdown ends the streams being served, which would otherwise keep the server from shutting
+// down until they are cut off. Clients reconnect to another gateway and resume.
+func (s *Streamer) Shutdown() {
+	s.shutdown.Do(func() {
+		close(s.done)
+	})
+}
+
+// Races streams races as their status changes, filtered by the meeting_ids and race_ids query
+// parameters.
+func (s *Streamer) Races(mux *runtime.ServeMux) runtime.HandlerFunc {
+	return s.handler(mux, "/gateway.Gateway/LiveRaces", []string{"meeting_ids", "race_ids"}, func(ctx context.Context, p *params.Params, afterId uint64) (receiveFunc, error) {
+		request := &racing.WatchRacesRequest{
+			Filter: &racing.WatchRacesRequestFilter{
+				MeetingIds: p.Ids("meeting_ids"),
+				RaceIds:    p.Ids("race_ids"),
+			},
+			AfterId: afterId,
+		}
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+
+		stream, err := s.racing.WatchRaces(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := stream.Header(); err != nil {
+			return nil, err
+		}
+
+		return func() (*update, error) {
+			response, err := stream.Recv()
+			if err != nil {
+				return nil, err
+			}
+			if response.Missed {
+				return &update{id: response.Id, event: "missed", message: response}, nil
+			}
+			return &update{id: response.Id, event: "status", message: response}, nil
+		}, nil
+	})
+}
+
+// Events streams events as their status or score changes, filtered by the event_ids,
+// sport_ids, competition_ids, team_ids and types query parameters.
+func (s *Streamer) Events(mux *runtime.ServeMux) runtime.HandlerFunc {
+	known := []string{"event_ids", "sport_ids", "competition_ids", "team_ids", "types"}
+	return s.handler(mux, "/gateway.Gateway/LiveEvents", known, func(ctx context.Context, p *params.Params, afterId uint64) (receiveFunc, error) {
+		request := &sports.WatchEventsRequest{
+			Filter: &sports.WatchEventsRequestFilter{
+				EventIds:       p.Ids("event_ids"),
+				SportIds:       p.Ids("sport_ids"),
+				CompetitionIds: p.Ids("competition_ids"),
+				TeamIds:        p.Ids("team_ids"),
+				Types:          p.List("types"),
+			},
+			AfterId: afterId,
+		}
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+
+		stream, err := s.sports.WatchEvents(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := stream.Header(); err != nil {
+			return nil, err
+		}
+
+		return func() (*update, error) {
+			response, err := stream.Recv()
+			if err != nil {
+				return nil, err
+			}
+			if response.Missed {
+				return &update{id: response.Id, event: "missed", message: response}, nil
+			}
+			return &update{id: response.Id, event: strings.ToLower(response.Type), message: response}, nil
+		}, nil
+	})
+}
+
+// Update received from a service, named by the event it is streamed as
+type update struct {
+	id      uint64
+	event   string
+	message proto.Message
+}
+
+// Receives the next update from a service's stream
+type receiveFunc func() (*update, error)
+
+// Starts watching a service with the filter in the query parameters, resuming after an id
+type watchFunc func(ctx context.Context, p *params.Params, afterId uint64) (receiveFunc, error)
+
+// Result of receiving from a service's stream
+type received struct {
+	update *update
+	err    error
+}
+
+// Serves the updates watched from a service over a WebSocket if the request is an upgrade, or
+// as Server-Sent Events otherwise. The service must start watching before either is, so its
+// errors are still written as those of the gateway's generated handlers.
+func (s *Streamer) handler(mux *runtime.ServeMux, method string, known []string, watch watchFunc) runtime.HandlerFunc {
+	known = append(known, "last_event_id")
+
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+
+		p := params.New(r.URL.Query())
+		if err := p.Unknown(known); err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		//Browsers resend the id of the last event received when an event stream reconnects, and
+		//WebSockets, which can't be sent headers, give it as a parameter
+		afterId := p.Uint("Last-Event-ID", r.Header.Get("Last-Event-ID"))
+		if afterId == 0 {
+			afterId = p.Uint("last_event_id", p.Get("last_event_id"))
+		}
+
+		ctx, err := outgoing.Context(mux, r, method)
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		receive, err := watch(ctx, p, afterId)
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		results := make(chan received)
+		go func() {
+			for {
+				update, err := receive()
+				select {
+				case results <- received{update, err}:
+				case <-ctx.Done():
+					return
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+
+		if websocket.IsWebSocketUpgrade(r) {
+			s.serveWebSocket(ctx, w, r, outbound, results)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, status.Error(codes.Unimplemented, "streaming is not supported"))
+			return
+		}
+		s.serveEvents(ctx, w, flusher, outbound, results)
+	}
+}
+
+// Writes updates as Server-Sent Events, with comments as heartbeats. The response ends when the
+// service's stream does, and the browser reconnects and resumes after the last event received.
+func (s *Streamer) serveEvents(ctx context.Context, w http.ResponseWriter, flusher http.Flusher, outbound runtime.Marshaler, results <-chan received) {
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	//Proxies such as nginx would otherwise buffer the stream
+	header.Set("X-Accel-Buffering", "no")
+
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "retry: "+strconv.Itoa(retryMillis)+"\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(s.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case result := <-results:
+			if result.err != nil {
+				endOfStream(ctx, result.err)
+				return
+			}
+
+			body, err := outbound.Marshal(result.update.message)
+			if err != nil {
+				logging.FromContext(ctx).Warn("failed marshalling live update", "error", err)
+				return
+			}
+
+			//An empty id clears the id browsers resume after, for updates missed since a restart
+			var event bytes.Buffer
+			event.WriteString("id: ")
+			if result.update.id > 0 {
+				event.WriteString(strconv.FormatUint(result.update.id, 10))
+			}
+			event.WriteString("\nevent: " + result.update.event + "\n")
+			for _, line := range bytes.Split(body, []byte("\n")) {
+				event.WriteString("data: ")
+				event.Write(line)
+				event.WriteString("\n")
+			}
+			event.WriteString("\n")
+
+			if _, err := w.Write(event.Bytes()); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-s.done:
+			return
+		case <-ctx.Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// Writes updates as WebSocket text messages, with pings as heartbeats. The connection is closed
+// when the service's stream ends, and the client reconnects and resumes after the last update
+// received with the last_event_id parameter.
+func (s *Streamer) serveWebSocket(ctx context.Context, w http.ResponseWriter, r *http.Request, outbound runtime.Marshaler, results <-chan received) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		//The upgrader has written the error
+		return
+	}
+	defer conn.Close()
+
+	//Clients aren't expected to send anything, but control messages are only handled while
+	//reading, and a client missing heartbeats has gone away
+	closed := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(2 * s.heartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * s.heartbeat))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(s.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case result := <-results:
+			if result.err != nil {
+				endOfStream(ctx, result.err)
+				closeWebSocket(conn, websocket.CloseTryAgainLater, "stream ended, resume after the last update received")
+				return
+			}
+
+			body, err := outbound.Marshal(result.update.message)
+			if err != nil {
+				logging.FromContext(ctx).Warn("failed marshalling live update", "error", err)
+				closeWebSocket(conn, websocket.CloseInternalServerErr, "")
+				return
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(s.heartbeat))
+			if err := conn.WriteMessage(websocket.TextMessage, body); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.heartbeat)); err != nil {
+				return
+			}
+		case <-s.done:
+			closeWebSocket(conn, websocket.CloseGoingAway, "gateway shutting down")
+			return
+		case <-closed:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func closeWebSocket(conn *websocket.Conn, code int, text string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(closeTimeout))
+}
+
+// Services' streams ending other than by the client going away are logged, such as when a
+// client fell too far behind, or the service restarted
+func endOfStream(ctx context.Context, err error) {
+	if ctx.Err() == nil && err != io.EOF {
+		logging.FromContext(ctx).Warn("live update stream ended", "error", err)
+	}
+}
+
+// Browsers send the origin of the page opening a WebSocket, which is allowed if it's the gateway
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
@@ -0,0 +1,232 @@
+package live
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"git.neds.sh/matty/entain/api/proto/racing"
+	"git.neds.sh/matty/entain/api/proto/sports"
+	"github.com/gorilla/websocket"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Racing client streaming fixed responses then ending, recording the request it was sent
+type mockRacingClient struct {
+	racing.RacingClient
+	request   *racing.WatchRacesRequest
+	responses []*racing.WatchRacesResponse
+	err       error
+}
+
+func (m *mockRacingClient) WatchRaces(ctx context.Context, in *racing.WatchRacesRequest, opts ...grpc.CallOption) (racing.Racing_WatchRacesClient, error) {
+	m.request = in
+	return &mockRacingStream{ctx: ctx, responses: m.responses, err: m.err}, nil
+}
+
+type mockRacingStream struct {
+	racing.Racing_WatchRacesClient
+	ctx       context.Context
+	responses []*racing.WatchRacesResponse
+	err       error
+}
+
+func (m *mockRacingStream) Header() (metadata.MD, error) {
+	return metadata.MD{}, m.err
+}
+
+// Streams the responses, then ends, or waits for the client to go away if there were none
+func (m *mockRacingStream) Recv() (*racing.WatchRacesResponse, error) {
+	if len(m.responses) == 0 {
+		<-m.ctx.Done()
+		return nil, m.ctx.Err()
+	}
+
+	response := m.responses[0]
+	m.responses = m.responses[1:]
+	return response, nil
+}
+
+// Sports client streaming fixed responses then ending, recording the request it was sent
+type mockSportsClient struct {
+	sports.SportsClient
+	request   *sports.WatchEventsRequest
+	responses []*sports.WatchEventsResponse
+}
+
+func (m *mockSportsClient) WatchEvents(ctx context.Context, in *sports.WatchEventsRequest, opts ...grpc.CallOption) (sports.Sports_WatchEventsClient, error) {
+	m.request = in
+	return &mockSportsStream{responses: m.responses}, nil
+}
+
+type mockSportsStream struct {
+	sports.Sports_WatchEventsClient
+	responses []*sports.WatchEventsResponse
+}
+
+func (m *mockSportsStream) Header() (metadata.MD, error) {
+	return metadata.MD{}, nil
+}
+
+func (m *mockSportsStream) Recv() (*sports.WatchEventsResponse, error) {
+	if len(m.responses) == 0 {
+		return nil, io.EOF
+	}
+
+	response := m.responses[0]
+	m.responses = m.responses[1:]
+	return response, nil
+}
+
+func newTestMux(t *testing.T, streamer *Streamer) *runtime.ServeMux {
+	mux := runtime.NewServeMux()
+	if err := mux.HandlePath(http.MethodGet, "/v1/live/races", streamer.Races(mux)); err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.HandlePath(http.MethodGet, "/v1/live/events", streamer.Events(mux)); err != nil {
+		t.Fatal(err)
+	}
+	return mux
+}
+
+// Tests the filter and the id resumed after are sent to the service, and its updates written as
+// Server-Sent Events until its stream ends
+func TestEvents(t *testing.T) {
+	sportsClient := &mockSportsClient{responses: []*sports.WatchEventsResponse{
+		{Id: 0, Missed: true},
+		{Id: 41, Type: "SCORE", Event: &sports.Event{Id: 3, Score: &sports.Score{HomeScore: 2}}},
+	}}
+	mux := newTestMux(t, NewStreamer(&mockRacingClient{}, sportsClient, time.Minute, nil))
+
+	request := httptest.NewRequest(http.MethodGet, "/v1/live/events?sport_ids=1,2&team_ids=5&types=score", nil)
+	request.Header.Set("Last-Event-ID", "40")
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+
+	filter := sportsClient.request.Filter
+	if sportsClient.request.AfterId != 40 || len(filter.SportIds) != 2 || filter.TeamIds[0] != 5 || filter.Types[0] != "score" {
+		t.Errorf("Expected the filter and last event id in the request, got %v", sportsClient.request)
+	}
+
+	if recorder.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected an event stream, got %v", recorder.Header())
+	}
+
+	body := recorder.Body.String()
+	missed := strings.Index(body, "id: \nevent: missed\ndata: {")
+	score := strings.Index(body, "id: 41\nevent: score\ndata: {")
+	if !strings.HasPrefix(body, "retry: 3000\n\n") || missed < 0 || score < missed || !strings.Contains(body[score:], `"homeScore":"2"`) {
+		t.Errorf("Expected the updates as events, got %q", body)
+	}
+}
+
+// Tests updates are written as WebSocket messages, resuming after the last_event_id parameter
+func TestWebSocket(t *testing.T) {
+	racingClient := &mockRacingClient{responses: []*racing.WatchRacesResponse{
+		{Id: 12, Race: &racing.Race{Id: 7, Status: "CLOSED"}},
+	}}
+	server := httptest.NewServer(newTestMux(t, NewStreamer(racingClient, &mockSportsClient{}, time.Minute, nil)))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/v1/live/races?meeting_ids=4&last_event_id=11", nil)
+	if err != nil {
+		t.Fatalf("Error opening WebSocket: %v", err)
+	}
+	defer conn.Close()
+
+	_, message, err := conn.ReadMessage()
+	if err != nil || !strings.Contains(string(message), `"id":"12"`) || !strings.Contains(string(message), `"status":"CLOSED"`) {
+		t.Errorf("Expected the update as a message, got %s (%v)", message, err)
+	}
+	if racingClient.request.AfterId != 11 || racingClient.request.Filter.MeetingIds[0] != 4 {
+		t.Errorf("Expected the filter and last event id in the request, got %v", racingClient.request)
+	}
+}
+
+// Tests WebSockets are closed as going away when the gateway shuts down
+func TestShutdown(t *testing.T) {
+	streamer := NewStreamer(&mockRacingClient{}, &mockSportsClient{}, time.Minute, nil)
+	server := httptest.NewServer(newTestMux(t, streamer))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/v1/live/races", nil)
+	if err != nil {
+		t.Fatalf("Error opening WebSocket: %v", err)
+	}
+	defer conn.Close()
+
+	streamer.Shutdown()
+	streamer.Shutdown()
+
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Expected the WebSocket to be closed as going away, got %v", err)
+	}
+}
+
+// Tests heartbeats are sent while there are no updates
+func TestHeartbeat(t *testing.T) {
+	mux := newTestMux(t, NewStreamer(&mockRacingClient{}, &mockSportsClient{}, 10*time.Millisecond, nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/live/races", nil).WithContext(ctx))
+
+	if !strings.Contains(recorder.Body.String(), ": heartbeat\n\n") {
+		t.Errorf("Expected heartbeats, got %q", recorder.Body.String())
+	}
+}
+
+// Tests the service failing to start watching, and invalid parameters, are written as errors
+func TestErrors(t *testing.T) {
+	racingClient := &mockRacingClient{err: status.Error(codes.Unavailable, "racing unavailable")}
+	mux := newTestMux(t, NewStreamer(racingClient, &mockSportsClient{}, time.Minute, nil))
+
+	for path, code := range map[string]int{
+		"/v1/live/races":                  http.StatusServiceUnavailable,
+		"/v1/live/races?meeting_ids=x":    http.StatusBadRequest,
+		"/v1/live/races?last_event_id=-1": http.StatusBadRequest,
+		"/v1/live/events?status=OPEN":     http.StatusBadRequest,
+	} {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if recorder.Code != code {
+			t.Errorf("Expected %s to be %d, got %d", path, code, recorder.Code)
+		}
+	}
+}
+
+// Tests WebSockets can only be opened from the gateway's origin, or those allowed
+func TestOrigin(t *testing.T) {
+	streamer := NewStreamer(&mockRacingClient{}, &mockSportsClient{}, time.Minute, func(origin string) bool {
+		return origin == "https://app.example.com"
+	})
+	server := httptest.NewServer(newTestMux(t, streamer))
+	defer server.Close()
+	defer streamer.Shutdown()
+
+	for origin, allowed := range map[string]bool{
+		server.URL:                 true,
+		"https://app.example.com":  true,
+		"https://evil.example.com": false,
+	} {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/v1/live/races", http.Header{"Origin": {origin}})
+		if (err == nil) != allowed {
+			t.Errorf("Expected origin %s allowed to be %t, got %v", origin, allowed, err)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
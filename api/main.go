@@ -3,54 +3,393 @@ package main
 import (
 	"context"
 	"flag"
-	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"git.neds.sh/matty/entain/api/auth"
+	"git.neds.sh/matty/entain/api/cache"
+	"git.neds.sh/matty/entain/api/compress"
+	"git.neds.sh/matty/entain/api/cors"
+	"git.neds.sh/matty/entain/api/health"
+	"git.neds.sh/matty/entain/api/live"
+	"git.neds.sh/matty/entain/api/nexttogo"
+	"git.neds.sh/matty/entain/api/openapi"
 	"git.neds.sh/matty/entain/api/proto/racing"
 	"git.neds.sh/matty/entain/api/proto/sports"
+	"git.neds.sh/matty/entain/api/ratelimit"
+	"git.neds.sh/matty/entain/api/readmask"
+	"git.neds.sh/matty/entain/api/rest"
+	"git.neds.sh/matty/entain/api/search"
+	"git.neds.sh/matty/entain/api/security"
+	"git.neds.sh/matty/entain/common/config"
+	"git.neds.sh/matty/entain/common/logging"
+	"git.neds.sh/matty/entain/common/metrics"
+	"git.neds.sh/matty/entain/common/tlsconfig"
+	"git.neds.sh/matty/entain/common/tracing"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 var (
-	apiEndpoint    = flag.String("api-endpoint", "localhost:8000", "API endpoint")
-	racingEndpoint = flag.String("grpc-endpoint-racing", "localhost:9000", "gRPC racing server endpoint")
-	sportsEndpoint = flag.String("grpc-endpoint-sports", "localhost:9001", "gRPC sports server endpoint")
+	apiEndpoint     = flag.String("api-endpoint", "localhost:8000", "API endpoint")
+	racingEndpoint  = flag.String("grpc-endpoint-racing", "localhost:9000", "gRPC racing server endpoint")
+	sportsEndpoint  = flag.String("grpc-endpoint-sports", "localhost:9001", "gRPC sports server endpoint")
+	jwksFile        = flag.String("jwks-file", "", "JWKS file of the keys bearer tokens are verified with")
+	jwtIssuer       = flag.String("jwt-issuer", "", "Issuer bearer tokens must be issued by, if set")
+	jwtAudience     = flag.String("jwt-audience", "", "Audience bearer tokens must be issued for, if set")
+	authDefault     = flag.String("auth-default", "public", "Access required by routes without an access rule: public, protected or admin")
+	rateLimits      = flag.String("rate-limits-file", "", "JSON file of API keys and rate limits, requests are not limited if unset")
+	grpcTLSCA       = flag.String("grpc-tls-ca-file", "", "PEM CA bundle the services' certificates are verified against, enabling TLS to the services")
+	grpcTLSCert     = flag.String("grpc-tls-cert-file", "", "PEM client certificate presented to the services for mutual TLS, enabling TLS to the services")
+	grpcTLSKey      = flag.String("grpc-tls-key-file", "", "PEM private key of the client certificate")
+	grpcTLSName     = flag.String("grpc-tls-server-name", "", "Name the services' certificates are verified against, instead of the host dialled")
+	rateLimitsPoll  = flag.Duration("rate-limits-reload-interval", 5*time.Second, "How often the rate limits file is checked for changes")
+	healthTimeout   = flag.Duration("health-check-timeout", 2*time.Second, "How long the services are given to report their health")
+	nextToGoTimeout = flag.Duration("next-to-go-timeout", 2*time.Second, "How long each service is given to list what starts next before it is left out")
+	metricsEndpoint = flag.String("metrics-endpoint", "localhost:8100", "HTTP endpoint Prometheus metrics are served on at /metrics, disabled if empty")
+	otlpEndpoint    = flag.String("otlp-endpoint", "", "Base URL of an OTLP/HTTP receiver traces are exported to, such as http://localhost:4318")
+	traceFile       = flag.String("trace-file", "", "File traces are appended to as OTLP JSON lines, or - for stdout")
+	traceSampling   = flag.Float64("trace-sample-ratio", 1, "Ratio of traces started by the gateway that are sampled")
+	logLevel        = flag.String("log-level", "info", "Minimum level logged: debug, info, warn or error")
+	cacheTTL        = flag.Duration("response-cache-ttl", 5*time.Second, "How long responses of read routes are cached for at most, disabled if 0")
+	cacheSize       = flag.Int("response-cache-size", 10000, "Most responses cached in memory")
+	cacheRedis      = flag.String("response-cache-redis", "", "Redis endpoint responses are cached in, shared by gateway instances, instead of memory")
+	apiDocs         = flag.Bool("api-docs", true, "Serve the OpenAPI spec at /openapi.json, with Swagger UI at /docs and Redoc at /redoc")
+	corsOrigins     = flag.String("cors-allowed-origins", "", "Origins browser apps may call the gateway from, comma separated, or * for any, CORS is disabled if empty")
+	corsMethods     = flag.String("cors-allowed-methods", "GET,HEAD,POST", "Methods browser apps on allowed origins may use, comma separated")
+	corsHeaders     = flag.String("cors-allowed-headers", "Authorization,Content-Type,X-API-Key,X-Request-Id", "Request headers browser apps on allowed origins may send, comma separated")
+	corsMaxAge      = flag.Duration("cors-max-age", 10*time.Minute, "How long browsers may cache CORS preflight responses, not cached if 0")
+	compression     = flag.Bool("response-compression", true, "Compress responses with brotli or gzip for clients that accept them")
+	hstsMaxAge      = flag.Duration("hsts-max-age", 0, "Max age of the Strict-Transport-Security header, for gateways served over HTTPS, not sent if 0")
+	liveHeartbeat   = flag.Duration("live-heartbeat-interval", 15*time.Second, "How often live update streams are sent heartbeats, so idle streams aren't closed by proxies")
+	shutdownTimeout = flag.Duration("shutdown-timeout", 10*time.Second, "How long in-flight requests are given to finish on SIGINT or SIGTERM before they are cancelled")
 )
 
+// Access rules for gateway routes, routes not listed require the --auth-default access
+var accessRules = []auth.Rule{
+	{Method: http.MethodPost, Path: "/v1/event/*/score", Access: auth.Admin},
+}
+
+// Settings are read from a config file and API_ environment variables as well as flags
+var settings = config.New(flag.CommandLine, "API")
+
+// Read routes whose responses are cached, scoped by the service they are served by
+var cachedRoutes = []cache.Route{
+	{Route: "GET /v1/race/*", Scope: "racing"},
+	{Route: "POST /v1/list-races", Scope: "racing"},
+	{Route: "GET /v1/races", Scope: "racing"},
+	{Route: "POST /v1/batch-get-races", Scope: "racing"},
+	{Route: "GET /v1/event/*", Scope: "sports"},
+	{Route: "POST /v1/list-events", Scope: "sports"},
+	{Route: "GET /v1/events", Scope: "sports"},
+	{Route: "POST /v1/batch-get-events", Scope: "sports"},
+	{Route: "GET /v1/market/*", Scope: "sports"},
+	{Route: "POST /v1/list-markets", Scope: "sports"},
+	{Route: "GET /v1/competition/*/standings", Scope: "sports"},
+}
+
+// Admin writes invalidating cached responses, scores changing events, their markets and standings
+var cacheInvalidations = []cache.Route{
+	{Route: "POST /v1/event/*/score", Scope: "sports"},
+}
+
+// How long the gateway waits to watch scores again when watching them fails
+const scoreWatchRetry = 5 * time.Second
+
+func init() {
+	settings.Check("api-endpoint", config.Required, config.Endpoint)
+	settings.Check("grpc-endpoint-racing", config.Required, config.Endpoint)
+	settings.Check("grpc-endpoint-sports", config.Required, config.Endpoint)
+	settings.Check("metrics-endpoint", config.Optional(config.Endpoint))
+	settings.Check("otlp-endpoint", config.Optional(config.URL))
+	settings.Check("trace-sample-ratio", config.Ratio)
+	settings.Check("auth-default", config.OneOf("public", "protected", "admin"))
+	settings.Check("rate-limits-reload-interval", config.Positive)
+	settings.Check("health-check-timeout", config.Positive)
+	settings.Check("next-to-go-timeout", config.Positive)
+	settings.Check("response-cache-redis", config.Optional(config.Endpoint))
+	settings.Check("live-heartbeat-interval", config.Positive)
+	settings.Check("shutdown-timeout", config.Positive)
+	settings.Check("log-level", config.OneOf("debug", "info", "warn", "error"))
+}
+
 func main() {
-	flag.Parse()
+	if err := settings.Load(os.Args[1:]); err != nil {
+		logging.Error("failed loading config", "error", err)
+		os.Exit(2)
+	}
+
+	if settings.PrintRequested() {
+		if err := settings.Print(os.Stdout); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
 
 	if err := run(); err != nil {
-		log.Printf("failed running api server: %s\n", err)
+		logging.Error("failed running api server", "error", err)
+		os.Exit(1)
 	}
 }
 
 func run() error {
-	ctx := context.Background()
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	if err := logging.Configure(*logLevel); err != nil {
+		return err
+	}
+
+	//The gateway runs until it is interrupted or terminated, then drains in-flight requests
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	tracer, err := tracing.Configure(tracing.Config{
+		Service:      "api",
+		OTLPEndpoint: *otlpEndpoint,
+		File:         *traceFile,
+		SampleRatio:  *traceSampling,
+	})
+	if err != nil {
+		return err
+	}
+	if tracer != nil {
+		defer tracer.Shutdown(context.Background())
+	}
+
+	transportCredentials, err := grpcCredentials()
+	if err != nil {
+		return err
+	}
+
+	//Calls to the services carry the id and continue the trace of the request they are made for
+	dialOptions := []grpc.DialOption{
+		transportCredentials,
+		grpc.WithChainUnaryInterceptor(logging.UnaryClientInterceptor(), otelgrpc.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(logging.StreamClientInterceptor(), otelgrpc.StreamClientInterceptor()),
+	}
+
+	racingConn, err := grpc.DialContext(ctx, *racingEndpoint, dialOptions...)
+	if err != nil {
+		return err
+	}
+	defer racingConn.Close()
+
+	sportsConn, err := grpc.DialContext(ctx, *sportsEndpoint, dialOptions...)
+	if err != nil {
+		return err
+	}
+	defer sportsConn.Close()
+
+	defaultAccess, err := auth.ParseAccess(*authDefault)
+	if err != nil {
+		return err
+	}
+
+	var keys []*auth.Key
+	if len(*jwksFile) > 0 {
+		keys, err = auth.LoadKeys(*jwksFile)
+		if err != nil {
+			return err
+		}
+	} else {
+		logging.Warn("no JWKS file configured, requests to protected routes will be rejected")
+	}
+
+	authenticator := auth.NewAuthenticator(keys, accessRules, defaultAccess, *jwtIssuer, *jwtAudience)
 
-	mux := runtime.NewServeMux()
-	if err := racing.RegisterRacingHandlerFromEndpoint(
-		ctx,
-		mux,
-		*racingEndpoint,
-		[]grpc.DialOption{grpc.WithInsecure()},
-	); err != nil {
+	mux := runtime.NewServeMux(runtime.WithMetadata(auth.Metadata))
+	if err := racing.RegisterRacingHandler(ctx, mux, racingConn); err != nil {
 		return err
 	}
 
-	if err := sports.RegisterSportsHandlerFromEndpoint(
-		ctx,
-		mux,
-		*sportsEndpoint,
-		[]grpc.DialOption{grpc.WithInsecure()},
-	); err != nil {
+	if err := sports.RegisterSportsHandler(ctx, mux, sportsConn); err != nil {
 		return err
 	}
 
-	log.Printf("API server listening on: %s\n", *apiEndpoint)
+	//Search is merged from both services rather than forwarded to one
+	searcher := search.NewSearcher(racing.NewRacingClient(racingConn), sports.NewSportsClient(sportsConn))
+	if err := mux.HandlePath(http.MethodGet, "/v1/search", searcher.Handler(mux)); err != nil {
+		return err
+	}
+
+	//Next to go is merged from both services too, leaving out either if it can't be reached
+	aggregator := nexttogo.NewAggregator(racing.NewRacingClient(racingConn), sports.NewSportsClient(sportsConn), *nextToGoTimeout)
+	if err := mux.HandlePath(http.MethodGet, "/v1/next-to-go", aggregator.Handler(mux)); err != nil {
+		return err
+	}
+
+	//Lists can be requested with query parameters too, so they can be bookmarked and cached by CDNs
+	if err := mux.HandlePath(http.MethodGet, "/v1/races", rest.Races(mux, racing.NewRacingClient(racingConn))); err != nil {
+		return err
+	}
+	if err := mux.HandlePath(http.MethodGet, "/v1/events", rest.Events(mux, sports.NewSportsClient(sportsConn))); err != nil {
+		return err
+	}
+
+	//Browser apps on the origins allowed by CORS may open WebSockets for live updates too
+	var crossOrigin *cors.CORS
+	var allowedOrigin func(origin string) bool
+	if len(*corsOrigins) > 0 {
+		crossOrigin = cors.New(cors.Config{
+			AllowedOrigins: list(*corsOrigins),
+			AllowedMethods: list(*corsMethods),
+			AllowedHeaders: list(*corsHeaders),
+			MaxAge:         *corsMaxAge,
+		})
+		allowedOrigin = crossOrigin.Allowed
+	}
 
-	return http.ListenAndServe(*apiEndpoint, mux)
+	//Live updates are streamed to browsers, which can't consume the services' gRPC streams, as Server-Sent Events or over WebSockets
+	streamer := live.NewStreamer(racing.NewRacingClient(racingConn), sports.NewSportsClient(sportsConn), *liveHeartbeat, allowedOrigin)
+	if err := mux.HandlePath(http.MethodGet, "/v1/live/races", streamer.Races(mux)); err != nil {
+		return err
+	}
+	if err := mux.HandlePath(http.MethodGet, "/v1/live/events", streamer.Events(mux)); err != nil {
+		return err
+	}
+
+	//Responses to requests with a read mask write only the fields wanted, rather than every field with the others empty
+	var routes http.Handler = readmask.Middleware(mux)
+
+	//Responses are cached behind authentication, so protected routes are never served to anonymous clients
+	if *cacheTTL > 0 {
+		var store cache.Store = cache.NewMemoryStore(*cacheSize)
+		if len(*cacheRedis) > 0 {
+			store = cache.NewRedisStore(*cacheRedis)
+		}
+		responseCache := cache.New(store, *cacheTTL, cachedRoutes, cacheInvalidations)
+		routes = responseCache.Middleware(routes)
+
+		//Scores can be updated by calling the sports service directly, bypassing the invalidation routes
+		go responseCache.WatchScores(ctx, sports.NewSportsClient(sportsConn), "sports", scoreWatchRetry)
+	}
+
+	handler := authenticator.Middleware(mux)(routes)
+
+	//Requests are rate limited before they are authenticated, so floods are turned away cheaply
+	if len(*rateLimits) > 0 {
+		limiter, err := ratelimit.NewLimiter(*rateLimits)
+		if err != nil {
+			return err
+		}
+		go limiter.Watch(ctx, *rateLimitsPoll)
+
+		handler = limiter.Middleware(mux)(handler)
+	}
+
+	//Health is served ahead of authentication and rate limiting, so orchestrators can always probe it
+	checker := health.NewChecker(*healthTimeout,
+		health.Backend{Name: "racing", Service: racing.Racing_ServiceDesc.ServiceName, Client: healthpb.NewHealthClient(racingConn)},
+		health.Backend{Name: "sports", Service: sports.Sports_ServiceDesc.ServiceName, Client: healthpb.NewHealthClient(sportsConn)},
+	)
+
+	root := http.NewServeMux()
+	root.Handle("/healthz", checker.LiveHandler())
+	root.Handle("/readyz", checker.ReadyHandler())
+	root.Handle("/", handler)
+
+	//The spec and explorer are public too, and only describe routes that still require access themselves
+	if *apiDocs {
+		docs, err := openapi.Handler()
+		if err != nil {
+			return err
+		}
+		root.Handle("/openapi.json", docs)
+		root.Handle("/docs", docs)
+		root.Handle("/redoc", docs)
+	}
+
+	if len(*metricsEndpoint) > 0 {
+		if err := metrics.Serve(*metricsEndpoint); err != nil {
+			return err
+		}
+	}
+
+	//Responses are compressed as they leave the handlers, after caching, which stores them as they are
+	var outer http.Handler = root
+	if *compression {
+		outer = compress.Middleware(outer)
+	}
+
+	//Preflight requests are answered before authentication and rate limiting, which browsers never send them through
+	if crossOrigin != nil {
+		outer = crossOrigin.Middleware(outer)
+	}
+
+	outer = security.Middleware(outer, *hstsMaxAge)
+
+	//Every request is given an id and logged, including those turned away by the handlers within
+	server := &http.Server{
+		Handler: logging.Middleware(metrics.NewHTTPMetrics(prometheus.DefaultRegisterer).Middleware(tracing.Middleware(outer))),
+	}
+
+	//Live update streams never finish by themselves, so they are ended for clients to resume elsewhere
+	server.RegisterOnShutdown(streamer.Shutdown)
+
+	listener, err := net.Listen("tcp", *apiEndpoint)
+	if err != nil {
+		return err
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	logging.Info("API server listening", "endpoint", *apiEndpoint)
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	logging.Info("shutting down API server", "timeout", shutdownTimeout.String())
+
+	//New connections are refused while in-flight requests finish, those still running after the
+	//timeout are cut off, and the connections to the services are closed once run returns
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logging.Warn("timed out draining in-flight requests, closing them", "error", err)
+		return server.Close()
+	}
+
+	return nil
+}
+
+// Services are dialled over TLS when a CA bundle or client certificate is configured
+func grpcCredentials() (grpc.DialOption, error) {
+	if len(*grpcTLSCA) == 0 && len(*grpcTLSCert) == 0 && len(*grpcTLSKey) == 0 {
+		return grpc.WithInsecure(), nil
+	}
+
+	creds, err := tlsconfig.ClientCredentials(tlsconfig.Files{
+		CertFile: *grpcTLSCert,
+		KeyFile:  *grpcTLSKey,
+		CAFile:   *grpcTLSCA,
+	}, *grpcTLSName)
+	if err != nil {
+		return nil, err
+	}
+
+	return grpc.WithTransportCredentials(creds), nil
+}
+
+// Values of comma separated settings, leaving out empty ones
+func list(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			values = append(values, v)
+		}
+	}
+	return values
 }
@@ -0,0 +1,210 @@
+// Package nexttogo lists the races and sporting events starting soonest across the racing and
+// sports services, merged by start time, serving them on a gateway route of its own.
+package nexttogo
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"git.neds.sh/matty/entain/api/outgoing"
+	"git.neds.sh/matty/entain/api/params"
+	"git.neds.sh/matty/entain/api/proto/racing"
+	"git.neds.sh/matty/entain/api/proto/sports"
+	"git.neds.sh/matty/entain/common/logging"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Number of items returned when no limit is requested, and the most that can be
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+)
+
+// How far ahead items are looked for when no window is requested, and the furthest they can be
+const (
+	defaultWindow = 24 * time.Hour
+	maxWindow     = 7 * 24 * time.Hour
+)
+
+// Step the time the window starts from is truncated to, so the requests made within it are the
+// same and the services can answer them from their caches
+const nowStep = time.Second
+
+// Item is a race or sporting event yet to start.
+type Item struct {
+	// Service the item belongs to, racing or sports.
+	Service string `json:"service"`
+	// Type is RACE or EVENT.
+	Type string `json:"type"`
+	// Id is encoded as a string, like ids elsewhere in the API.
+	Id int64 `json:"id,string"`
+	// Name of the race, or the teams playing in the event.
+	Name                string    `json:"name"`
+	AdvertisedStartTime time.Time `json:"advertisedStartTime"`
+}
+
+// Response holds the items starting soonest across both services, soonest first.
+type Response struct {
+	Items []*Item `json:"items"`
+	// Unavailable lists the services that couldn't be reached, whose items are missing.
+	Unavailable []string `json:"unavailable,omitempty"`
+}
+
+// Aggregator lists the races and events starting next across the racing and sports services.
+type Aggregator struct {
+	racing  racing.RacingClient
+	sports  sports.SportsClient
+	timeout time.Duration
+	now     func() time.Time
+}
+
+// NewAggregator creates a new aggregator over the racing and sports services, giving each
+// the timeout to respond before its items are left out.
+func NewAggregator(racingClient racing.RacingClient, sportsClient sports.SportsClient, timeout time.Duration) *Aggregator {
+	return &Aggregator{racing: racingClient, sports: sportsClient, timeout: timeout, now: time.Now}
+}
+
+// NextToGo lists the visible races and events starting within the window from now
+// concurrently, and merges them by start time. A service failing or timing out is reported
+// as unavailable with the items of the other, and only both failing fails the request.
+func (a *Aggregator) NextToGo(ctx context.Context, limit int64, window time.Duration) (*Response, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	} else if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	if window <= 0 {
+		window = defaultWindow
+	} else if window > maxWindow {
+		window = maxWindow
+	}
+
+	//Each service lists at most limit items soonest first, so the merged items hold the soonest overall
+	now := a.now().Truncate(nowStep)
+	from, before := timestamppb.New(now), timestamppb.New(now.Add(window))
+
+	var (
+		wg                       sync.WaitGroup
+		racingResults            *racing.ListRacesResponse
+		sportsResults            *sports.ListEventsResponse
+		racingError, sportsError error
+	)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		ctx, cancel := context.WithTimeout(ctx, a.timeout)
+		defer cancel()
+		racingResults, racingError = a.racing.ListRaces(ctx, &racing.ListRacesRequest{
+			Filter:   &racing.ListRacesRequestFilter{Visible: proto.Bool(true), StartFrom: from, StartBefore: before},
+			OrderBy:  "advertised_start_time",
+			PageSize: int32(limit),
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		ctx, cancel := context.WithTimeout(ctx, a.timeout)
+		defer cancel()
+		sportsResults, sportsError = a.sports.ListEvents(ctx, &sports.ListEventsRequest{
+			Filter:   &sports.ListEventsRequestFilter{StartFrom: from, StartBefore: before},
+			OrderBy:  "advertised_start_time",
+			PageSize: int32(limit),
+		})
+	}()
+	wg.Wait()
+
+	if racingError != nil && sportsError != nil {
+		return nil, status.Errorf(codes.Unavailable, "racing and sports services are both unavailable: racing: %s; sports: %s",
+			status.Convert(racingError).Message(), status.Convert(sportsError).Message())
+	}
+
+	response := &Response{Items: []*Item{}}
+
+	if racingError != nil {
+		logging.FromContext(ctx).Warn("leaving out unavailable service", "service", "racing", "error", racingError)
+		response.Unavailable = append(response.Unavailable, "racing")
+	} else {
+		for _, race := range racingResults.Races {
+			response.Items = append(response.Items, &Item{"racing", "RACE", race.Id, race.Name, race.AdvertisedStartTime.AsTime()})
+		}
+	}
+
+	if sportsError != nil {
+		logging.FromContext(ctx).Warn("leaving out unavailable service", "service", "sports", "error", sportsError)
+		response.Unavailable = append(response.Unavailable, "sports")
+	} else {
+		for _, event := range sportsResults.Events {
+			name := event.HomeTeam.GetName() + " v " + event.AwayTeam.GetName()
+			response.Items = append(response.Items, &Item{"sports", "EVENT", event.Id, name, event.AdvertisedStartTime.AsTime()})
+		}
+	}
+
+	//Ties are broken on the resource so the order is stable between requests
+	items := response.Items
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+
+		if !a.AdvertisedStartTime.Equal(b.AdvertisedStartTime) {
+			return a.AdvertisedStartTime.Before(b.AdvertisedStartTime)
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Id < b.Id
+	})
+
+	if int64(len(items)) > limit {
+		response.Items = items[:limit]
+	}
+
+	return response, nil
+}
+
+// Handler serves the next to go from the limit and window query parameters, the window being
+// a duration such as 2h, with errors written the same way as the gateway's generated handlers.
+func (a *Aggregator) Handler(mux *runtime.ServeMux) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+
+		p := params.New(r.URL.Query())
+		if err := p.Unknown([]string{"limit", "window"}); err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		limit, window := p.Int("limit", 64), p.Duration("window")
+		if err := p.Err(); err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		ctx, err := outgoing.Context(mux, r, "/gateway.Gateway/NextToGo")
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		response, err := a.NextToGo(ctx, limit, window)
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		body, err := outbound.Marshal(response)
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", outbound.ContentType(response))
+		w.Write(body)
+	}
+}
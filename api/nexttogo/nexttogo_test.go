@@ -0,0 +1,192 @@
+package nexttogo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"git.neds.sh/matty/entain/api/proto/racing"
+	"git.neds.sh/matty/entain/api/proto/sports"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Racing client returning fixed races, recording the request it was sent
+type mockRacingClient struct {
+	racing.RacingClient
+	request  *racing.ListRacesRequest
+	response *racing.ListRacesResponse
+	err      error
+}
+
+func (m *mockRacingClient) ListRaces(ctx context.Context, in *racing.ListRacesRequest, opts ...grpc.CallOption) (*racing.ListRacesResponse, error) {
+	m.request = in
+	return m.response, m.err
+}
+
+// Sports client returning fixed events, recording the request it was sent, or waiting for the
+// request to time out if blocked
+type mockSportsClient struct {
+	sports.SportsClient
+	request  *sports.ListEventsRequest
+	response *sports.ListEventsResponse
+	blocked  bool
+}
+
+func (m *mockSportsClient) ListEvents(ctx context.Context, in *sports.ListEventsRequest, opts ...grpc.CallOption) (*sports.ListEventsResponse, error) {
+	m.request = in
+	if m.blocked {
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return m.response, nil
+}
+
+var now = time.Date(2021, time.March, 3, 1, 0, 0, 0, time.UTC)
+
+func newTestAggregator(racingClient racing.RacingClient, sportsClient sports.SportsClient) *Aggregator {
+	aggregator := NewAggregator(racingClient, sportsClient, 50*time.Millisecond)
+	aggregator.now = func() time.Time { return now }
+	return aggregator
+}
+
+// Tests races and events are listed within the window and merged by start time, cut to the limit
+func TestNextToGoMergesResults(t *testing.T) {
+	racingClient := &mockRacingClient{response: &racing.ListRacesResponse{Races: []*racing.Race{
+		{Id: 7, Name: "Flemington Cup", AdvertisedStartTime: timestamppb.New(now.Add(2 * time.Minute))},
+		{Id: 2, Name: "Caulfield Stakes", AdvertisedStartTime: timestamppb.New(now.Add(10 * time.Minute))},
+	}}}
+	sportsClient := &mockSportsClient{response: &sports.ListEventsResponse{Events: []*sports.Event{
+		{
+			Id:                  4,
+			HomeTeam:            &sports.Reference{Id: 1, Name: "Brisbane Broncos"},
+			AwayTeam:            &sports.Reference{Id: 2, Name: "Gold Coast Titans"},
+			AdvertisedStartTime: timestamppb.New(now.Add(2 * time.Minute)),
+		},
+		{Id: 9, AdvertisedStartTime: timestamppb.New(now.Add(20 * time.Minute))},
+	}}}
+
+	response, err := newTestAggregator(racingClient, sportsClient).NextToGo(context.TODO(), 3, time.Hour)
+	if err != nil {
+		t.Fatalf("Error listing next to go: %v", err)
+	}
+
+	racingFilter, sportsFilter := racingClient.request.Filter, sportsClient.request.Filter
+	if !racingFilter.GetVisible() || !racingFilter.StartFrom.AsTime().Equal(now) || !racingFilter.StartBefore.AsTime().Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected visible races within the window to be listed, got %v", racingFilter)
+	}
+	if !sportsFilter.StartFrom.AsTime().Equal(now) || !sportsFilter.StartBefore.AsTime().Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected events within the window to be listed, got %v", sportsFilter)
+	}
+	if racingClient.request.PageSize != 3 || sportsClient.request.PageSize != 3 {
+		t.Errorf("Expected the limit to be sent to both services, got %d and %d", racingClient.request.PageSize, sportsClient.request.PageSize)
+	}
+
+	expected := []Item{
+		{"sports", "EVENT", 4, "Brisbane Broncos v Gold Coast Titans", now.Add(2 * time.Minute)},
+		{"racing", "RACE", 7, "Flemington Cup", now.Add(2 * time.Minute)},
+		{"racing", "RACE", 2, "Caulfield Stakes", now.Add(10 * time.Minute)},
+	}
+	if len(response.Items) != len(expected) || len(response.Unavailable) != 0 {
+		t.Fatalf("Expected %d items from both services, got %v", len(expected), response)
+	}
+	for i, item := range expected {
+		if *response.Items[i] != item {
+			t.Errorf("Items[%d] expected %v, got %v", i, item, *response.Items[i])
+		}
+	}
+}
+
+// Tests a service failing or timing out leaves out its items, and both failing fails the request
+func TestNextToGoPartialResults(t *testing.T) {
+	racingClient := &mockRacingClient{response: &racing.ListRacesResponse{Races: []*racing.Race{
+		{Id: 7, Name: "Flemington Cup", AdvertisedStartTime: timestamppb.New(now.Add(2 * time.Minute))},
+	}}}
+	sportsClient := &mockSportsClient{blocked: true}
+
+	response, err := newTestAggregator(racingClient, sportsClient).NextToGo(context.TODO(), 0, 0)
+	if err != nil {
+		t.Fatalf("Error listing next to go: %v", err)
+	}
+	if len(response.Items) != 1 || response.Items[0].Id != 7 || len(response.Unavailable) != 1 || response.Unavailable[0] != "sports" {
+		t.Errorf("Expected the races with sports unavailable, got %v", response)
+	}
+	if !sportsClient.request.Filter.StartBefore.AsTime().Equal(now.Add(defaultWindow)) {
+		t.Errorf("Expected the default window to be used, got %v", sportsClient.request.Filter)
+	}
+
+	racingClient.err = status.Error(codes.Unavailable, "connection refused")
+
+	_, err = newTestAggregator(racingClient, sportsClient).NextToGo(context.TODO(), 0, 0)
+	if status.Code(err) != codes.Unavailable || !strings.Contains(err.Error(), "racing: connection refused") || !strings.Contains(err.Error(), "sports: ") {
+		t.Errorf("Expected an unavailable error reporting both services, got %v", err)
+	}
+}
+
+// Tests requests made within the same second look for items from the same time, so they can
+// be answered from the services' caches
+func TestNextToGoTruncatesNow(t *testing.T) {
+	racingClient := &mockRacingClient{response: &racing.ListRacesResponse{}}
+	sportsClient := &mockSportsClient{response: &sports.ListEventsResponse{}}
+
+	aggregator := newTestAggregator(racingClient, sportsClient)
+	var requests []*racing.ListRacesRequest
+	for _, offset := range []time.Duration{0, 250 * time.Millisecond, 999 * time.Millisecond} {
+		aggregator.now = func() time.Time { return now.Add(offset) }
+		if _, err := aggregator.NextToGo(context.TODO(), 5, time.Hour); err != nil {
+			t.Fatalf("Error listing next to go: %v", err)
+		}
+		requests = append(requests, racingClient.request)
+	}
+
+	for i, request := range requests {
+		if !proto.Equal(request, requests[0]) || !request.Filter.StartFrom.AsTime().Equal(now) {
+			t.Errorf("Request[%d] expected to start from %v, got %v", i, now, request.Filter)
+		}
+	}
+}
+
+// Tests the handler writes items as JSON and rejects an invalid window or unknown parameters
+func TestHandler(t *testing.T) {
+	racingClient := &mockRacingClient{response: &racing.ListRacesResponse{Races: []*racing.Race{
+		{Id: 7, Name: "Flemington Cup", AdvertisedStartTime: timestamppb.New(now.Add(2 * time.Minute))},
+	}}}
+	sportsClient := &mockSportsClient{response: &sports.ListEventsResponse{}}
+
+	mux := runtime.NewServeMux()
+	if err := mux.HandlePath(http.MethodGet, "/v1/next-to-go", newTestAggregator(racingClient, sportsClient).Handler(mux)); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/next-to-go?limit=5&window=30m", nil))
+
+	expected := `{"items":[{"service":"racing","type":"RACE","id":"7","name":"Flemington Cup","advertisedStartTime":"2021-03-03T01:02:00Z"}]}`
+	if recorder.Code != http.StatusOK || recorder.Body.String() != expected {
+		t.Errorf("Expected %s, got %d %s", expected, recorder.Code, recorder.Body.String())
+	}
+	if !racingClient.request.Filter.StartBefore.AsTime().Equal(now.Add(30 * time.Minute)) {
+		t.Errorf("Expected window from parameters, got %v", racingClient.request.Filter)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/next-to-go?window=soon", nil))
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected bad request for an invalid window, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/next-to-go?limit=5&after=30m", nil))
+
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "unknown parameters after") {
+		t.Errorf("Expected bad request for an unknown parameter, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
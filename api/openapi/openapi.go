@@ -0,0 +1,139 @@
+// Package openapi serves the OpenAPI spec of the gateway, generated from the racing and sports
+// protos and merged with the routes the gateway serves itself, along with Swagger UI and Redoc
+// pages to explore it.
+package openapi
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Spec generated from the racing and sports protos by go generate in api/proto
+//
+//go:embed api.swagger.json
+var generatedSpec []byte
+
+// Spec of the routes served by the gateway rather than forwarded to a service
+//
+//go:embed gateway.swagger.json
+var gatewaySpec []byte
+
+//go:embed swagger.html
+var swaggerPage []byte
+
+//go:embed redoc.html
+var redocPage []byte
+
+// CDN the explorer pages load Swagger UI and Redoc from
+const cdn = "https://cdn.jsdelivr.net"
+
+// Inline scripts of the explorer pages, allowed to run by their hashes
+var inlineScript = regexp.MustCompile(`(?s)<script>(.*?)</script>`)
+
+// Sections of the specs merged, each a map by path, definition or scheme name
+var mergedSections = []string{"paths", "definitions", "securityDefinitions"}
+
+// Spec returns the generated spec merged with the spec of the gateway's own routes.
+func Spec() ([]byte, error) {
+	var merged, gateway map[string]interface{}
+	if err := json.Unmarshal(generatedSpec, &merged); err != nil {
+		return nil, fmt.Errorf("failed reading generated spec: %w", err)
+	}
+	if err := json.Unmarshal(gatewaySpec, &gateway); err != nil {
+		return nil, fmt.Errorf("failed reading gateway spec: %w", err)
+	}
+
+	merged["info"] = map[string]interface{}{
+		"title":       "Entain API",
+		"description": "Races and sporting events, served by the racing and sports services through the gateway.",
+		"version":     "v1",
+	}
+
+	for _, section := range mergedSections {
+		into, _ := merged[section].(map[string]interface{})
+		if into == nil {
+			into = make(map[string]interface{})
+			merged[section] = into
+		}
+
+		from, _ := gateway[section].(map[string]interface{})
+		for name, value := range from {
+			//The gateway's routes would shadow those forwarded to the services
+			if _, ok := into[name]; ok {
+				return nil, fmt.Errorf("%s %q is in both the generated and gateway specs", section, name)
+			}
+			into[name] = value
+		}
+	}
+
+	tags, _ := merged["tags"].([]interface{})
+	gatewayTags, _ := gateway["tags"].([]interface{})
+	merged["tags"] = append(tags, gatewayTags...)
+
+	return json.MarshalIndent(merged, "", "  ")
+}
+
+// Handler serves the merged spec at /openapi.json, Swagger UI at /docs and Redoc at /redoc.
+func Handler() (http.Handler, error) {
+	spec, err := Spec()
+	if err != nil {
+		return nil, err
+	}
+
+	policy := pagePolicy(swaggerPage, redocPage)
+
+	mux := http.NewServeMux()
+	mux.Handle("/openapi.json", page("application/json", spec, ""))
+	mux.Handle("/docs", page("text/html; charset=utf-8", swaggerPage, policy))
+	mux.Handle("/redoc", page("text/html; charset=utf-8", redocPage, policy))
+	return mux, nil
+}
+
+// Content security policy of the explorer pages, letting them load scripts, styles and fonts
+// from the CDN and fetch the spec. Swagger UI and Redoc both set inline styles, and Redoc
+// searches in a worker it starts from a blob.
+func pagePolicy(pages ...[]byte) string {
+	scripts := []string{cdn}
+	for _, p := range pages {
+		for _, match := range inlineScript.FindAllSubmatch(p, -1) {
+			hash := sha256.Sum256(match[1])
+			scripts = append(scripts, "'sha256-"+base64.StdEncoding.EncodeToString(hash[:])+"'")
+		}
+	}
+
+	return strings.Join([]string{
+		"default-src 'none'",
+		"script-src " + strings.Join(scripts, " "),
+		"style-src " + cdn + " 'unsafe-inline'",
+		"img-src 'self' data: " + cdn,
+		"font-src data: " + cdn,
+		"connect-src 'self'",
+		"worker-src blob:",
+		"frame-ancestors 'none'",
+		"base-uri 'none'",
+		"form-action 'none'",
+	}, "; ")
+}
+
+// Pages with a policy replace the gateway's, which lets nothing load
+func page(contentType string, body []byte, policy string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		if len(policy) > 0 {
+			w.Header().Set("Content-Security-Policy", policy)
+		}
+		w.Write(body)
+	})
+}
@@ -0,0 +1,102 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Collects every $ref within a spec
+func refs(value interface{}, found map[string]bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if ref, ok := child.(string); ok && key == "$ref" {
+				found[ref] = true
+			}
+			refs(child, found)
+		}
+	case []interface{}:
+		for _, child := range value {
+			refs(child, found)
+		}
+	}
+}
+
+// Tests the merged spec holds the routes of both services and the gateway, and every
+// definition referred to is defined
+func TestSpec(t *testing.T) {
+	body, err := Spec()
+	if err != nil {
+		t.Fatalf("Error merging spec: %v", err)
+	}
+
+	var spec struct {
+		Info        map[string]interface{}            `json:"info"`
+		Paths       map[string]interface{}            `json:"paths"`
+		Definitions map[string]interface{}            `json:"definitions"`
+		Security    map[string]map[string]interface{} `json:"securityDefinitions"`
+	}
+	if err := json.Unmarshal(body, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	if spec.Info["title"] != "Entain API" {
+		t.Errorf("Expected the merged spec to be titled, got %v", spec.Info)
+	}
+	for _, path := range []string{"/v1/list-races", "/v1/event/{id}", "/v1/search", "/v1/next-to-go"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("Expected path %s in the merged spec", path)
+		}
+	}
+	if spec.Security["bearer"]["name"] != "Authorization" {
+		t.Errorf("Expected the bearer scheme to be defined, got %v", spec.Security)
+	}
+
+	var whole interface{}
+	if err := json.Unmarshal(body, &whole); err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]bool)
+	refs(whole, found)
+	for ref := range found {
+		if _, ok := spec.Definitions[strings.TrimPrefix(ref, "#/definitions/")]; !ok {
+			t.Errorf("Expected %s to be defined", ref)
+		}
+	}
+}
+
+// Tests the spec and explorer pages are served, the pages with a policy allowing the CDN
+func TestHandler(t *testing.T) {
+	handler, err := Handler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, contentType := range map[string]string{
+		"/openapi.json": "application/json",
+		"/docs":         "text/html; charset=utf-8",
+		"/redoc":        "text/html; charset=utf-8",
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != contentType {
+			t.Errorf("Expected %s to be served as %s, got %d %s", path, contentType, recorder.Code, recorder.Header().Get("Content-Type"))
+		}
+		if path != "/openapi.json" && !strings.Contains(recorder.Body.String(), `"openapi.json"`) {
+			t.Errorf("Expected %s to load the spec", path)
+		}
+		if policy := recorder.Header().Get("Content-Security-Policy"); path != "/openapi.json" && !strings.Contains(policy, "script-src https://cdn.jsdelivr.net") {
+			t.Errorf("Expected %s to be allowed to load scripts from the CDN, got %q", path, policy)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/openapi.json", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected only reads to be allowed, got %d", recorder.Code)
+	}
+}
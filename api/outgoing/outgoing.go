@@ -0,0 +1,18 @@
+// Package outgoing builds the context the gateway's hand-written handlers call the services with,
+// so that they forward the same metadata as its generated handlers.
+package outgoing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+// Context returns the context to call the services with on behalf of a request, annotated by
+// the mux as it annotates the generated handlers' calls. The services are then sent the
+// authenticated subject and roles, the forwarded headers, and the request's grpc-timeout.
+// Methods are named like /gateway.Gateway/Search, after the route's OpenAPI operation.
+func Context(mux *runtime.ServeMux, r *http.Request, method string) (context.Context, error) {
+	return runtime.AnnotateContext(r.Context(), mux, r, method)
+}
@@ -0,0 +1,84 @@
+package outgoing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"git.neds.sh/matty/entain/api/auth"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var hmacSecret = []byte("test-secret-for-hs256-signing")
+
+// Serves a request through the authenticator, returning the context built to call the services
+func serve(t *testing.T, r *http.Request) (context.Context, error) {
+	mux := runtime.NewServeMux(runtime.WithMetadata(auth.Metadata))
+	authenticator := auth.NewAuthenticator([]*auth.Key{{Id: "hmac", Algorithm: "HS256", Material: hmacSecret}}, nil, auth.Public, "", "")
+
+	var ctx context.Context
+	var err error
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, err = Context(mux, r, "/gateway.Gateway/Search")
+	})
+	authenticator.Middleware(mux)(next).ServeHTTP(httptest.NewRecorder(), r)
+	return ctx, err
+}
+
+// Tests the authenticated subject and roles are forwarded to the services, as they are by the
+// generated handlers, and nothing is for anonymous requests
+func TestContext(t *testing.T) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "punter", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		Roles:            []string{"punter", "vip"},
+	})
+	signed, err := token.SignedString(hmacSecret)
+	if err != nil {
+		t.Fatalf("Error signing token: %v", err)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/v1/search?q=cup", nil)
+	request.Header.Set("Authorization", "Bearer "+signed)
+	ctx, err := serve(t, request)
+	if err != nil {
+		t.Fatalf("Error building context: %v", err)
+	}
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	subject, roles := md.Get(auth.SubjectMetadataKey), md.Get(auth.RolesMetadataKey)
+	if len(subject) != 1 || subject[0] != "punter" || len(roles) != 1 || roles[0] != "punter,vip" {
+		t.Errorf("Expected the subject and roles to be forwarded, got %v", md)
+	}
+	if method, _ := runtime.RPCMethod(ctx); method != "/gateway.Gateway/Search" {
+		t.Errorf("Expected the method to be named, got %q", method)
+	}
+
+	ctx, err = serve(t, httptest.NewRequest(http.MethodGet, "/v1/search?q=cup", nil))
+	if err != nil {
+		t.Fatalf("Error building context: %v", err)
+	}
+	if md, _ := metadata.FromOutgoingContext(ctx); len(md.Get(auth.SubjectMetadataKey)) > 0 {
+		t.Errorf("Expected no subject for an anonymous request, got %v", md)
+	}
+}
+
+// Tests the request's grpc-timeout is applied, and an invalid one rejected
+func TestTimeout(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/v1/search?q=cup", nil)
+	request.Header.Set("Grpc-Timeout", "5S")
+	ctx, err := serve(t, request)
+	if deadline, ok := ctx.Deadline(); err != nil || !ok || time.Until(deadline) > 5*time.Second {
+		t.Errorf("Expected a deadline within 5s, got %v (%v)", deadline, err)
+	}
+
+	request.Header.Set("Grpc-Timeout", "soon")
+	if _, err := serve(t, request); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected an invalid argument error, got %v", err)
+	}
+}
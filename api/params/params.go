@@ -0,0 +1,178 @@
+// Package params reads the query parameters of the gateway's GET routes, rejecting those a route
+// doesn't take, and keeping the first that is invalid so that a request is only built once.
+package params
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Params are query parameters being read, which are left empty when invalid, with the first
+// that is invalid returned by Err.
+type Params struct {
+	values url.Values
+	err    error
+}
+
+// New reads the query parameters given.
+func New(values url.Values) *Params {
+	return &Params{values: values}
+}
+
+// Err returns an invalid argument error for the first parameter that was invalid, or nil.
+func (p *Params) Err() error {
+	return p.err
+}
+
+// Get returns the first value of a parameter, or an empty string if it wasn't given.
+func (p *Params) Get(name string) string {
+	return p.values.Get(name)
+}
+
+// Unknown returns an invalid argument error naming the parameters given that aren't known, or
+// nil if there are none.
+func (p *Params) Unknown(known []string) error {
+	var unknown []string
+	for name := range p.values {
+		found := false
+		for _, k := range known {
+			found = found || name == k
+		}
+		if !found {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	sort.Strings(unknown)
+	return status.Errorf(codes.InvalidArgument, "unknown parameters %s, expected any of %s", strings.Join(unknown, ", "), strings.Join(known, ", "))
+}
+
+// Invalid records a value as invalid, unless another already was.
+func (p *Params) Invalid(name string, value string) {
+	if p.err == nil {
+		p.err = status.Errorf(codes.InvalidArgument, "invalid %s %q", name, value)
+	}
+}
+
+// List returns the values given as repeated parameters, comma separated, or both.
+func (p *Params) List(name string) []string {
+	var values []string
+	for _, value := range p.values[name] {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); len(part) > 0 {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
+
+// Ids returns the ids given as a list.
+func (p *Params) Ids(name string) []int64 {
+	var ids []int64
+	for _, value := range p.List(name) {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			p.Invalid(name, value)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Int returns an integer of a size in bits, or 0 if it wasn't given.
+func (p *Params) Int(name string, bits int) int64 {
+	value := p.values.Get(name)
+	if len(value) == 0 {
+		return 0
+	}
+
+	number, err := strconv.ParseInt(value, 10, bits)
+	if err != nil {
+		p.Invalid(name, value)
+	}
+	return number
+}
+
+// Uint parses an unsigned integer given by name, which needn't be a query parameter, such as an
+// id given in a header, or returns 0 if it is empty.
+func (p *Params) Uint(name string, value string) uint64 {
+	if len(value) == 0 {
+		return 0
+	}
+
+	number, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		p.Invalid(name, value)
+	}
+	return number
+}
+
+// OptionalBool returns a boolean, or nil if it wasn't given, so that it doesn't filter.
+func (p *Params) OptionalBool(name string) *bool {
+	value := p.values.Get(name)
+	if len(value) == 0 {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		p.Invalid(name, value)
+		return nil
+	}
+	return &b
+}
+
+// Timestamp returns a time given in RFC 3339, such as 2021-03-02T08:30:00Z, or nil if it
+// wasn't given.
+func (p *Params) Timestamp(name string) *timestamppb.Timestamp {
+	value := p.values.Get(name)
+	if len(value) == 0 {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		p.Invalid(name, value)
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// Duration returns a duration such as 2h or 90m, or 0 if it wasn't given.
+func (p *Params) Duration(name string) time.Duration {
+	value := p.values.Get(name)
+	if len(value) == 0 {
+		return 0
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		p.Invalid(name, value)
+		return 0
+	}
+	return d
+}
+
+// Mask returns field paths given comma separated, which the services check, or nil if none
+// were given.
+func (p *Params) Mask(name string) *fieldmaskpb.FieldMask {
+	paths := p.List(name)
+	if len(paths) == 0 {
+		return nil
+	}
+
+	return &fieldmaskpb.FieldMask{Paths: paths}
+}
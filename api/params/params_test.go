@@ -0,0 +1,85 @@
+package params
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Tests lists and ids are read from repeated parameters, comma separated, or both
+func TestIds(t *testing.T) {
+	p := New(url.Values{"ids": {"1, 2", "5"}, "types": {"STATUS,,SCORE"}})
+
+	if ids := p.Ids("ids"); !reflect.DeepEqual(ids, []int64{1, 2, 5}) {
+		t.Errorf("Expected ids [1 2 5], got %v", ids)
+	}
+	if types := p.List("types"); !reflect.DeepEqual(types, []string{"STATUS", "SCORE"}) {
+		t.Errorf("Expected types [STATUS SCORE], got %v", types)
+	}
+	if p.Ids("missing") != nil || p.Err() != nil {
+		t.Errorf("Expected no ids or error for a missing parameter, got %v", p.Err())
+	}
+}
+
+// Tests values are parsed by type, leaving those not given empty
+func TestValues(t *testing.T) {
+	p := New(url.Values{
+		"page_size":  {"10"},
+		"visible":    {"false"},
+		"start_from": {"2021-03-03T00:00:00+10:00"},
+		"read_mask":  {"id, name"},
+		"window":     {"90m"},
+	})
+
+	if p.Int("page_size", 32) != 10 || p.Uint("last_event_id", "12") != 12 {
+		t.Error("Expected integers to be parsed")
+	}
+	if visible := p.OptionalBool("visible"); visible == nil || *visible {
+		t.Errorf("Expected visible to be false, got %v", visible)
+	}
+	if start := p.Timestamp("start_from"); !start.AsTime().Equal(time.Date(2021, time.March, 2, 14, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the start in UTC, got %v", start.AsTime())
+	}
+	if window := p.Duration("window"); window != 90*time.Minute {
+		t.Errorf("Expected a window of 90m, got %v", window)
+	}
+	if mask := p.Mask("read_mask"); !reflect.DeepEqual(mask.GetPaths(), []string{"id", "name"}) {
+		t.Errorf("Expected paths [id name], got %v", mask.GetPaths())
+	}
+	if p.Int("min_capacity", 64) != 0 || p.OptionalBool("hidden") != nil || p.Timestamp("start_before") != nil || p.Mask("fields") != nil || p.Duration("timeout") != 0 {
+		t.Error("Expected parameters not given to be empty")
+	}
+	if p.Err() != nil {
+		t.Errorf("Expected no error, got %v", p.Err())
+	}
+}
+
+// Tests the first invalid value is reported as an invalid argument
+func TestInvalid(t *testing.T) {
+	p := New(url.Values{"ids": {"1,two"}, "page_size": {"99999999999"}})
+
+	p.Ids("ids")
+	p.Int("page_size", 32)
+
+	if status.Code(p.Err()) != codes.InvalidArgument || !strings.Contains(p.Err().Error(), `invalid ids "two"`) {
+		t.Errorf("Expected the invalid id to be reported, got %v", p.Err())
+	}
+}
+
+// Tests parameters a route doesn't take are named, in order
+func TestUnknown(t *testing.T) {
+	p := New(url.Values{"visible": {"true"}, "meeting_id": {"1"}, "colour": {"red"}})
+
+	err := p.Unknown([]string{"meeting_ids", "visible"})
+	if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "unknown parameters colour, meeting_id,") {
+		t.Errorf("Expected the unknown parameters to be named, got %v", err)
+	}
+	if err := p.Unknown([]string{"colour", "meeting_id", "visible"}); err != nil {
+		t.Errorf("Expected no error for known parameters, got %v", err)
+	}
+}
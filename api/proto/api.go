@@ -1,3 +1,4 @@
 package proto
 
 //go:generate protoc -I . --go_out . --go_opt paths=source_relative --go-grpc_out . --go-grpc_opt paths=source_relative --grpc-gateway_out . --grpc-gateway_opt paths=source_relative racing/racing.proto sports/sports.proto --experimental_allow_proto3_optional
+//go:generate protoc -I . --openapiv2_out ../openapi --openapiv2_opt allow_merge=true,merge_file_name=api racing/racing.proto sports/sports.proto --experimental_allow_proto3_optional
@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"git.neds.sh/matty/entain/common/httputil"
+)
+
+// Limit is a token bucket, refilled at Rate requests per second up to Burst requests.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst float64 `json:"burst"`
+}
+
+// Limits are the default limit of a client and the limits of routes with their own quota.
+// Routes are keyed by method and path, such as "GET /v1/race/*", where * matches any
+// single path segment. Requests to other routes share the default limit.
+type Limits struct {
+	Default *Limit            `json:"default"`
+	Routes  map[string]*Limit `json:"routes"`
+}
+
+// Client is a partner identified by an API key.
+type Client struct {
+	Name string `json:"name"`
+	Limits
+}
+
+// Config is the rate limit configuration loaded from the limits file. Clients are keyed by
+// API key, and their limits override the global limits. Requests without an API key are
+// limited per client address with the anonymous limits, falling back to the global limits.
+type Config struct {
+	Limits
+	Anonymous *Limits            `json:"anonymous"`
+	Clients   map[string]*Client `json:"clients"`
+}
+
+// LoadConfig reads and validates rate limit configuration from a JSON file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing rate limits %s: %w", path, err)
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid rate limits %s: %w", path, err)
+	}
+
+	return &config, nil
+}
+
+func (c *Config) validate() error {
+	if err := c.Limits.validate("global"); err != nil {
+		return err
+	}
+	if c.Anonymous != nil {
+		if err := c.Anonymous.validate("anonymous"); err != nil {
+			return err
+		}
+	}
+	for key, client := range c.Clients {
+		if client == nil {
+			//The key is a secret, so it isn't written to the logs the error goes to
+			return errors.New("an API key has no client")
+		}
+		if len(key) == 0 {
+			return fmt.Errorf("client %q has an empty API key", client.Name)
+		}
+		if err := client.Limits.validate("client " + client.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Limits) validate(owner string) error {
+	if l.Default != nil {
+		if err := l.Default.validate(); err != nil {
+			return fmt.Errorf("%s default limit: %w", owner, err)
+		}
+	}
+	for route, limit := range l.Routes {
+		if len(strings.Fields(route)) != 2 {
+			return fmt.Errorf("%s route %q must be a method and path", owner, route)
+		}
+		if limit == nil {
+			return fmt.Errorf("%s route %q has no limit", owner, route)
+		}
+		if err := limit.validate(); err != nil {
+			return fmt.Errorf("%s route %q limit: %w", owner, route, err)
+		}
+	}
+	return nil
+}
+
+func (l *Limit) validate() error {
+	if l.Rate < 0 || l.Burst < 0 {
+		return fmt.Errorf("rate and burst cannot be negative")
+	}
+	if l.Rate > 0 && l.Burst < 1 {
+		return fmt.Errorf("burst must allow at least one request")
+	}
+	return nil
+}
+
+// Find the limit of a request to a route, and the pattern of the route it is counted against.
+// A client's own limits take precedence over the global limits, and route limits over defaults.
+// No limit is returned when nothing limits the route.
+func (c *Config) limit(client *Limits, method string, path string) (*Limit, string) {
+	for _, limits := range []*Limits{client, &c.Limits} {
+		if limits == nil {
+			continue
+		}
+		//The most specific matching route wins, the one with the fewest wildcards
+		var matched string
+		for route := range limits.Routes {
+			if !httputil.MatchRoute(route, method, path) {
+				continue
+			}
+			if len(matched) == 0 || strings.Count(route, "*") < strings.Count(matched, "*") ||
+				(strings.Count(route, "*") == strings.Count(matched, "*") && route < matched) {
+				matched = route
+			}
+		}
+		if len(matched) > 0 {
+			return limits.Routes[matched], matched
+		}
+	}
+
+	for _, limits := range []*Limits{client, &c.Limits} {
+		if limits != nil && limits.Default != nil {
+			return limits.Default, "*"
+		}
+	}
+
+	return nil, ""
+}
@@ -0,0 +1,248 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"git.neds.sh/matty/entain/common/logging"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// APIKeyHeader is the header clients identify themselves with.
+const APIKeyHeader = "X-API-Key"
+
+// Buckets left idle for this long are full again, and are dropped to bound memory
+const idleBucketTimeout = 10 * time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Refill the bucket for the time passed since it was last used, and take a token if one is
+// available. The remaining tokens are returned, with the time until the next token when
+// none was taken.
+func (b *bucket) take(limit *Limit, now time.Time) (bool, float64, time.Duration) {
+	b.tokens = math.Min(limit.Burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, b.tokens, 0
+	}
+
+	if limit.Rate <= 0 {
+		return false, b.tokens, time.Duration(math.MaxInt64)
+	}
+	return false, b.tokens, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+}
+
+// Limiter applies token bucket rate limits per client and route, with its configuration
+// reloaded from the limits file when it changes.
+type Limiter struct {
+	path string
+	now  func() time.Time
+
+	mu        sync.Mutex
+	config    *Config
+	modified  time.Time
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewLimiter creates a limiter with the limits configured in a file.
+func NewLimiter(path string) (*Limiter, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Limiter{
+		path:     path,
+		now:      time.Now,
+		config:   config,
+		modified: info.ModTime(),
+		buckets:  make(map[string]*bucket),
+	}, nil
+}
+
+// Watch reloads the limits file whenever its modification time changes, checking on each
+// interval until the context is done. Invalid changes are logged and the previous limits kept.
+func (l *Limiter) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.reload(); err != nil {
+				logging.Warn("failed reloading rate limits", "path", l.path, "error", err)
+			}
+		}
+	}
+}
+
+func (l *Limiter) reload() error {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	modified := l.modified
+	l.mu.Unlock()
+
+	if info.ModTime().Equal(modified) {
+		return nil
+	}
+
+	config, err := LoadConfig(l.path)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	//The file is not re-read until it changes again, even if this version was invalid
+	l.modified = info.ModTime()
+	if err != nil {
+		return err
+	}
+
+	l.config = config
+	logging.Info("reloaded rate limits", "path", l.path)
+
+	return nil
+}
+
+// Result is the outcome of counting a request against its limit.
+type Result struct {
+	Allowed   bool
+	Limit     *Limit
+	Remaining float64
+	// RetryAfter is the time until the next request would be allowed, when this one was not.
+	RetryAfter time.Duration
+}
+
+// Allow counts a request by a client to a route against its limit. Clients are identified by
+// API key, or by address for anonymous clients with an empty key. Requests with unknown API
+// keys return an Unauthenticated error, and requests that nothing limits are allowed with
+// no Limit in their result.
+func (l *Limiter) Allow(apiKey string, address string, method string, path string) (*Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var client string
+	var limits *Limits
+	if len(apiKey) > 0 {
+		known, ok := l.config.Clients[apiKey]
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "unknown API key")
+		}
+		client, limits = "key:"+apiKey, &known.Limits
+	} else {
+		client, limits = "address:"+address, l.config.Anonymous
+	}
+
+	limit, route := l.config.limit(limits, method, path)
+	if limit == nil {
+		return &Result{Allowed: true}, nil
+	}
+
+	now := l.now()
+	l.sweep(now)
+
+	key := client + " " + route
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit.Burst, last: now}
+		l.buckets[key] = b
+	}
+
+	allowed, remaining, retryAfter := b.take(limit, now)
+
+	return &Result{Allowed: allowed, Limit: limit, Remaining: remaining, RetryAfter: retryAfter}, nil
+}
+
+// Drop buckets that have been idle long enough to have refilled, at most once a minute
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idleBucketTimeout {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Middleware rate limits requests before passing them to the next handler, setting the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers on limited routes.
+// Rejected requests are written as errors in the same format as the gateway mux writes them,
+// with a Retry-After header when they are over their limit.
+func (l *Limiter) Middleware(mux *runtime.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			address, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				address = r.RemoteAddr
+			}
+
+			result, err := l.Allow(r.Header.Get(APIKeyHeader), address, r.Method, r.URL.Path)
+			if err != nil {
+				writeError(mux, w, r, err)
+				return
+			}
+
+			if result.Limit != nil {
+				w.Header().Set("RateLimit-Limit", strconv.FormatFloat(result.Limit.Burst, 'f', -1, 64))
+				w.Header().Set("RateLimit-Remaining", strconv.Itoa(int(result.Remaining)))
+				w.Header().Set("RateLimit-Reset", strconv.Itoa(resetSeconds(result)))
+			}
+
+			if !result.Allowed {
+				if result.Limit.Rate > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+				}
+				writeError(mux, w, r, status.Error(codes.ResourceExhausted, "rate limit exceeded"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Seconds until the bucket is full again, or until the next request is allowed when it is empty
+func resetSeconds(result *Result) int {
+	if !result.Allowed {
+		if result.Limit.Rate <= 0 {
+			return 0
+		}
+		return int(math.Ceil(result.RetryAfter.Seconds()))
+	}
+	if result.Limit.Rate <= 0 {
+		return 0
+	}
+	return int(math.Ceil((result.Limit.Burst - result.Remaining) / result.Limit.Rate))
+}
+
+func writeError(mux *runtime.ServeMux, w http.ResponseWriter, r *http.Request, err error) {
+	_, outbound := runtime.MarshalerForRequest(mux, r)
+	runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+}
@@ -0,0 +1,162 @@
+package ratelimit
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+const testLimits = `{
+	"default": {"rate": 10, "burst": 10},
+	"routes": {
+		"POST /v1/list-races": {"rate": 1, "burst": 2}
+	},
+	"anonymous": {
+		"default": {"rate": 1, "burst": 1}
+	},
+	"clients": {
+		"partner-key": {
+			"name": "Partner",
+			"routes": {"GET /v1/race/*": {"rate": 0.5, "burst": 1}}
+		}
+	}
+}`
+
+// Create a limiter from limits written to a temporary file, with a clock the test controls
+func newTestLimiter(t *testing.T, limits string) (*Limiter, *time.Time, string) {
+	path := filepath.Join(t.TempDir(), "limits.json")
+	if err := ioutil.WriteFile(path, []byte(limits), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	limiter, err := NewLimiter(path)
+	if err != nil {
+		t.Fatalf("Error creating limiter: %v", err)
+	}
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	return limiter, &now, path
+}
+
+func serve(limiter *Limiter, method string, path string, apiKey string) *httptest.ResponseRecorder {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	request := httptest.NewRequest(method, path, nil)
+	if len(apiKey) > 0 {
+		request.Header.Set(APIKeyHeader, apiKey)
+	}
+
+	recorder := httptest.NewRecorder()
+	limiter.Middleware(runtime.NewServeMux())(next).ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+// Tests a route's bucket empties, is rejected with retry headers, and refills over time
+func TestRouteLimit(t *testing.T) {
+	limiter, now, _ := newTestLimiter(t, testLimits)
+
+	for i, remaining := range []string{"1", "0"} {
+		recorder := serve(limiter, http.MethodPost, "/v1/list-races", "partner-key")
+		if recorder.Code != http.StatusOK || recorder.Header().Get("RateLimit-Remaining") != remaining {
+			t.Fatalf("Request %d expected 200 with %s remaining, got %d with %s", i, remaining, recorder.Code, recorder.Header().Get("RateLimit-Remaining"))
+		}
+	}
+
+	recorder := serve(limiter, http.MethodPost, "/v1/list-races", "partner-key")
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 once the bucket is empty, got %d", recorder.Code)
+	}
+	if recorder.Header().Get("RateLimit-Limit") != "2" || recorder.Header().Get("Retry-After") != "1" || recorder.Header().Get("RateLimit-Reset") != "1" {
+		t.Errorf("Unexpected rate limit headers %v", recorder.Header())
+	}
+
+	//Other routes of the same client are counted separately
+	if recorder := serve(limiter, http.MethodPost, "/v1/list-events", "partner-key"); recorder.Code != http.StatusOK || recorder.Header().Get("RateLimit-Limit") != "10" {
+		t.Errorf("Expected other routes to use the default limit, got %d %v", recorder.Code, recorder.Header())
+	}
+
+	*now = now.Add(time.Second)
+	if recorder := serve(limiter, http.MethodPost, "/v1/list-races", "partner-key"); recorder.Code != http.StatusOK {
+		t.Errorf("Expected a request to be allowed once a token was refilled, got %d", recorder.Code)
+	}
+}
+
+// Tests clients are limited separately, with their own limits taking precedence
+func TestClientLimits(t *testing.T) {
+	limiter, _, _ := newTestLimiter(t, testLimits)
+
+	if recorder := serve(limiter, http.MethodGet, "/v1/race/3", "partner-key"); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected first request allowed, got %d", recorder.Code)
+	}
+	if recorder := serve(limiter, http.MethodGet, "/v1/race/4", "partner-key"); recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "2" {
+		t.Errorf("Expected ids of a route to share the client's bucket, got %d %v", recorder.Code, recorder.Header())
+	}
+
+	//Anonymous clients have their own bucket and limits
+	if recorder := serve(limiter, http.MethodGet, "/v1/race/3", ""); recorder.Code != http.StatusOK || recorder.Header().Get("RateLimit-Limit") != "1" {
+		t.Errorf("Expected anonymous request allowed with the anonymous limit, got %d %v", recorder.Code, recorder.Header())
+	}
+
+	if recorder := serve(limiter, http.MethodGet, "/v1/race/3", "stolen-key"); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected unknown API key to be rejected, got %d", recorder.Code)
+	}
+}
+
+// Tests changes to the limits file are picked up, and invalid changes ignored
+func TestReload(t *testing.T) {
+	limiter, _, path := newTestLimiter(t, testLimits)
+
+	write := func(limits string, modified time.Time) {
+		if err := ioutil.WriteFile(path, []byte(limits), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"default": {"rate": 1, "burst": 3}}`, time.Now().Add(time.Minute))
+	if err := limiter.reload(); err != nil {
+		t.Fatalf("Error reloading: %v", err)
+	}
+	if recorder := serve(limiter, http.MethodPost, "/v1/list-races", ""); recorder.Header().Get("RateLimit-Limit") != "3" {
+		t.Errorf("Expected reloaded limit of 3, got %v", recorder.Header())
+	}
+
+	write(`{"default": {"rate": -1}}`, time.Now().Add(2*time.Minute))
+	if err := limiter.reload(); err == nil {
+		t.Error("Expected invalid limits to fail to reload")
+	}
+	if recorder := serve(limiter, http.MethodPost, "/v1/list-races", ""); recorder.Header().Get("RateLimit-Limit") != "3" {
+		t.Errorf("Expected previous limits to be kept, got %v", recorder.Header())
+	}
+}
+
+// Tests limits files with missing or invalid limits are rejected rather than loaded
+func TestInvalidConfig(t *testing.T) {
+	for _, limits := range []string{
+		`{"default": {"rate": -1}}`,
+		`{"routes": {"/v1/list-races": {"rate": 1, "burst": 1}}}`,
+		`{"routes": {"POST /v1/list-races": null}}`,
+		`{"clients": {"partner-key": null}}`,
+		`{"clients": {"": {"name": "Partner"}}}`,
+	} {
+		path := filepath.Join(t.TempDir(), "limits.json")
+		if err := ioutil.WriteFile(path, []byte(limits), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadConfig(path); err == nil {
+			t.Errorf("Expected %s to be rejected", limits)
+		}
+	}
+}
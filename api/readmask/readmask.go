@@ -0,0 +1,192 @@
+// Package readmask writes the responses to requests with a read mask with only the fields the
+// mask names, rather than every field as the gateway otherwise writes them, with those left out
+// empty.
+package readmask
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Largest body looked through for a read mask, larger bodies are passed on as they are
+const maxBody = 1 << 20
+
+// Middleware writes the responses to requests with a read_mask query parameter, or a readMask
+// or read_mask field in their JSON body, with only the fields of the resources in them that
+// the mask names. Fields named are written even when they have their default values, such as
+// visible when it is false, so they can be told apart from those left out.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths := maskPaths(r)
+		if len(paths) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		body := recorder.body.Bytes()
+		if recorder.status == http.StatusOK {
+			if masked, err := mask(body, paths); err == nil {
+				body = masked
+			}
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(recorder.status)
+		w.Write(body)
+	})
+}
+
+// The paths of the read mask of a request, or nil if it has none
+func maskPaths(r *http.Request) []string {
+	if value := r.URL.Query().Get("read_mask"); len(value) > 0 {
+		return splitPaths(value)
+	}
+
+	if r.Body == nil || r.ContentLength > maxBody {
+		return nil
+	}
+
+	//The body read is put back in front of the rest for the gateway
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil || len(body) > maxBody {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return nil
+	}
+	for _, name := range []string{"readMask", "read_mask"} {
+		var value string
+		if raw, ok := fields[name]; ok && json.Unmarshal(raw, &value) == nil && len(value) > 0 {
+			return splitPaths(value)
+		}
+	}
+	return nil
+}
+
+// Paths are given comma separated, with their fields named as in protos or in JSON
+func splitPaths(value string) []string {
+	var paths []string
+	for _, path := range strings.Split(value, ",") {
+		if path = strings.TrimSpace(path); len(path) > 0 {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Write a response with only the fields the paths name of the resources in it, which are the
+// objects, or arrays of objects, held by its top level fields
+func mask(body []byte, paths []string) ([]byte, error) {
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	tree := make(node)
+	for _, path := range paths {
+		tree.add(strings.Split(path, "."))
+	}
+
+	for name, raw := range response {
+		var resource map[string]interface{}
+		var resources []map[string]interface{}
+		switch {
+		case decode(raw, &resource) == nil && resource != nil:
+			tree.keep(resource)
+			response[name], _ = json.Marshal(resource)
+		case decode(raw, &resources) == nil:
+			for _, resource := range resources {
+				tree.keep(resource)
+			}
+			response[name], _ = json.Marshal(resources)
+		}
+	}
+
+	return json.Marshal(response)
+}
+
+// Decode JSON keeping numbers as they were written, so that they are written back unchanged
+func decode(raw json.RawMessage, value interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	return decoder.Decode(value)
+}
+
+// Fields named by a mask by their JSON names, each with those named within it, or none if it
+// is wanted whole
+type node map[string]node
+
+func (n node) add(path []string) {
+	name := jsonName(path[0])
+	child, ok := n[name]
+	if ok && len(child) == 0 {
+		//The whole field is already wanted
+		return
+	}
+	if len(path) == 1 {
+		n[name] = node{}
+		return
+	}
+	if !ok {
+		child = make(node)
+		n[name] = child
+	}
+	child.add(path[1:])
+}
+
+// Keep only the fields of an object that are named, and those named within them
+func (n node) keep(object map[string]interface{}) {
+	for name, value := range object {
+		child, ok := n[name]
+		if !ok {
+			delete(object, name)
+			continue
+		}
+		if nested, isObject := value.(map[string]interface{}); isObject && len(child) > 0 {
+			child.keep(nested)
+		}
+	}
+}
+
+// The JSON name of a field, which is its proto name in lower camel case
+func jsonName(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) > 0 {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// A body partly read into memory, closing the original body when done
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Holds the response written, to be masked before it is written on
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
@@ -0,0 +1,89 @@
+package readmask
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.neds.sh/matty/entain/api/proto/racing"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+// Tests responses are masked only when requests have a read mask, and their bodies are passed
+// on whole
+func TestMiddleware(t *testing.T) {
+	response := `{"race":{"id":"1","name":"Flemington Cup","status":"OPEN","visible":false}}`
+
+	tests := []struct {
+		method   string
+		target   string
+		body     string
+		expected string
+	}{
+		{http.MethodGet, "/v1/race/1?read_mask=name,status", "", `{"race":{"name":"Flemington Cup","status":"OPEN"}}`},
+		{http.MethodGet, "/v1/race/1", "", response},
+		{http.MethodPost, "/v1/list-races", `{"filter":{"visible":true},"readMask":"name"}`, `{"race":{"name":"Flemington Cup"}}`},
+		{http.MethodPost, "/v1/list-races", `{"read_mask":"id"}`, `{"race":{"id":"1"}}`},
+		{http.MethodPost, "/v1/list-races", `{"filter":{"visible":true},"readMask":""}`, response},
+		{http.MethodPost, "/v1/list-races", `not json`, response},
+	}
+
+	for _, test := range tests {
+		var body string
+		handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			read, _ := ioutil.ReadAll(r.Body)
+			body = string(read)
+			w.Write([]byte(response))
+		}))
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(test.method, test.target, strings.NewReader(test.body)))
+
+		if recorder.Body.String() != test.expected {
+			t.Errorf("%s %s %s expected %s, got %s", test.method, test.target, test.body, test.expected, recorder.Body.String())
+		}
+		if body != test.body {
+			t.Errorf("Expected body %q to be passed on, got %q", test.body, body)
+		}
+	}
+}
+
+// Tests fields named by the mask are written with their default values, and those it leaves
+// out aren't, through the gateway's own marshaling
+func TestMaskedDefaults(t *testing.T) {
+	mux := runtime.NewServeMux()
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+		body, _ := outbound.Marshal(&racing.ListRacesResponse{Races: []*racing.Race{
+			{Id: 7, Visible: false, Status: "CLOSED"},
+			{Id: 8, Visible: true},
+		}})
+		w.Write(body)
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/races?read_mask=id,visible,advertised_start_time,status", nil))
+
+	expected := `{"races":[{"advertisedStartTime":null,"id":"7","status":"CLOSED","visible":false},{"advertisedStartTime":null,"id":"8","status":"","visible":true}]}`
+	if recorder.Body.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, recorder.Body.String())
+	}
+}
+
+// Tests error responses are written as they are
+func TestErrorsUnmasked(t *testing.T) {
+	response := `{"code":3,"message":"invalid read mask"}`
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(response))
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/race/1?read_mask=colour", nil))
+
+	if recorder.Code != http.StatusBadRequest || recorder.Body.String() != response {
+		t.Errorf("Expected the error to be written unchanged, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
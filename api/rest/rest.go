@@ -0,0 +1,107 @@
+// Package rest serves GET routes listing races and events from query parameters, so that lists
+// can be bookmarked and cached by CDNs, by mapping the parameters onto the services' list requests.
+package rest
+
+import (
+	"context"
+	"net/http"
+
+	"git.neds.sh/matty/entain/api/outgoing"
+	"git.neds.sh/matty/entain/api/params"
+	"git.neds.sh/matty/entain/api/proto/racing"
+	"git.neds.sh/matty/entain/api/proto/sports"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/protobuf/proto"
+)
+
+// Parameters taken by every list route
+var listParams = []string{"order_by", "page_size", "start_from", "start_before", "read_mask"}
+
+// Races serves races listed by the meeting_ids, visible, status, start_from, start_before,
+// order_by, page_size and read_mask query parameters.
+func Races(mux *runtime.ServeMux, client racing.RacingClient) runtime.HandlerFunc {
+	return handler(mux, "/gateway.Gateway/Races", append([]string{"meeting_ids", "visible", "status"}, listParams...), func(ctx context.Context, p *params.Params) (proto.Message, error) {
+		request := &racing.ListRacesRequest{
+			Filter: &racing.ListRacesRequestFilter{
+				MeetingIds:  p.Ids("meeting_ids"),
+				Visible:     p.OptionalBool("visible"),
+				Status:      p.Get("status"),
+				StartFrom:   p.Timestamp("start_from"),
+				StartBefore: p.Timestamp("start_before"),
+			},
+			OrderBy:  p.Get("order_by"),
+			PageSize: int32(p.Int("page_size", 32)),
+			ReadMask: p.Mask("read_mask"),
+		}
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+
+		return client.ListRaces(ctx, request)
+	})
+}
+
+// Events serves events listed by the sport_ids, team_ids, competition_ids, location_ids,
+// min_capacity, status, query, start_from, start_before, order_by, page_size and read_mask
+// query parameters.
+func Events(mux *runtime.ServeMux, client sports.SportsClient) runtime.HandlerFunc {
+	known := append([]string{"sport_ids", "team_ids", "competition_ids", "location_ids", "min_capacity", "status", "query"}, listParams...)
+	return handler(mux, "/gateway.Gateway/Events", known, func(ctx context.Context, p *params.Params) (proto.Message, error) {
+		request := &sports.ListEventsRequest{
+			Filter: &sports.ListEventsRequestFilter{
+				SportIds:       p.Ids("sport_ids"),
+				TeamIds:        p.Ids("team_ids"),
+				CompetitionIds: p.Ids("competition_ids"),
+				LocationIds:    p.Ids("location_ids"),
+				MinCapacity:    p.Int("min_capacity", 64),
+				Status:         p.Get("status"),
+				Query:          p.Get("query"),
+				StartFrom:      p.Timestamp("start_from"),
+				StartBefore:    p.Timestamp("start_before"),
+			},
+			OrderBy:  p.Get("order_by"),
+			PageSize: int32(p.Int("page_size", 32)),
+			ReadMask: p.Mask("read_mask"),
+		}
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+
+		return client.ListEvents(ctx, request)
+	})
+}
+
+// Serves the response of a call made from the query parameters, rejecting parameters the
+// route doesn't take, with errors written the same way as the gateway's generated handlers
+func handler(mux *runtime.ServeMux, method string, known []string, call func(ctx context.Context, p *params.Params) (proto.Message, error)) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+
+		p := params.New(r.URL.Query())
+		if err := p.Unknown(known); err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		ctx, err := outgoing.Context(mux, r, method)
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		response, err := call(ctx, p)
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		body, err := outbound.Marshal(response)
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", outbound.ContentType(response))
+		w.Write(body)
+	}
+}
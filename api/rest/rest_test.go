@@ -0,0 +1,132 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"git.neds.sh/matty/entain/api/proto/racing"
+	"git.neds.sh/matty/entain/api/proto/sports"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Racing client returning fixed races, recording the request it was sent
+type mockRacingClient struct {
+	racing.RacingClient
+	request  *racing.ListRacesRequest
+	response *racing.ListRacesResponse
+}
+
+func (m *mockRacingClient) ListRaces(ctx context.Context, in *racing.ListRacesRequest, opts ...grpc.CallOption) (*racing.ListRacesResponse, error) {
+	m.request = in
+	return m.response, nil
+}
+
+// Sports client returning no events, recording the request it was sent
+type mockSportsClient struct {
+	sports.SportsClient
+	request *sports.ListEventsRequest
+}
+
+func (m *mockSportsClient) ListEvents(ctx context.Context, in *sports.ListEventsRequest, opts ...grpc.CallOption) (*sports.ListEventsResponse, error) {
+	m.request = in
+	return &sports.ListEventsResponse{}, nil
+}
+
+func newTestMux(t *testing.T, racingClient racing.RacingClient, sportsClient sports.SportsClient) *runtime.ServeMux {
+	mux := runtime.NewServeMux()
+	if err := mux.HandlePath(http.MethodGet, "/v1/races", Races(mux, racingClient)); err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.HandlePath(http.MethodGet, "/v1/events", Events(mux, sportsClient)); err != nil {
+		t.Fatal(err)
+	}
+	return mux
+}
+
+// Tests query parameters are mapped onto the list races request, and the races written as JSON
+func TestRaces(t *testing.T) {
+	racingClient := &mockRacingClient{response: &racing.ListRacesResponse{Races: []*racing.Race{{Id: 7, Name: "Flemington Cup"}}}}
+	mux := newTestMux(t, racingClient, &mockSportsClient{})
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/races?meeting_ids=1,2&meeting_ids=5&visible=true&status=OPEN&start_from=2021-03-02T08:30:00Z&order_by=advertised_start_time&page_size=10&read_mask=id,name", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected races to be listed, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	expected := &racing.ListRacesRequest{
+		Filter: &racing.ListRacesRequestFilter{
+			MeetingIds: []int64{1, 2, 5},
+			Visible:    proto.Bool(true),
+			Status:     "OPEN",
+			StartFrom:  timestamppb.New(time.Date(2021, time.March, 2, 8, 30, 0, 0, time.UTC)),
+		},
+		OrderBy:  "advertised_start_time",
+		PageSize: 10,
+		ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"id", "name"}},
+	}
+	if !proto.Equal(racingClient.request, expected) {
+		t.Errorf("Expected request %v, got %v", expected, racingClient.request)
+	}
+}
+
+// Tests query parameters are mapped onto the list events request
+func TestEvents(t *testing.T) {
+	sportsClient := &mockSportsClient{}
+	mux := newTestMux(t, &mockRacingClient{}, sportsClient)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/events?sport_ids=1&team_ids=3,4&min_capacity=30000&status=OPEN&query=broncos&start_before=2021-03-03T00:00:00%2B10:00", nil))
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"events":[]}` {
+		t.Fatalf("Expected events to be listed, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	expected := &sports.ListEventsRequest{
+		Filter: &sports.ListEventsRequestFilter{
+			SportIds:    []int64{1},
+			TeamIds:     []int64{3, 4},
+			MinCapacity: 30000,
+			Status:      "OPEN",
+			Query:       "broncos",
+			StartBefore: timestamppb.New(time.Date(2021, time.March, 2, 14, 0, 0, 0, time.UTC)),
+		},
+	}
+	if !proto.Equal(sportsClient.request, expected) {
+		t.Errorf("Expected request %v, got %v", expected, sportsClient.request)
+	}
+}
+
+// Tests invalid and unknown parameters are rejected before the services are called
+func TestInvalidParameters(t *testing.T) {
+	for _, target := range []string{
+		"/v1/races?meeting_ids=1,two",
+		"/v1/races?visible=maybe",
+		"/v1/races?page_size=99999999999",
+		"/v1/races?start_from=yesterday",
+		"/v1/races?meeting_id=1",
+		"/v1/events?min_capacity=lots",
+		"/v1/events?visible=true",
+	} {
+		racingClient, sportsClient := &mockRacingClient{}, &mockSportsClient{}
+		mux := newTestMux(t, racingClient, sportsClient)
+
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected bad request for %s, got %d", target, recorder.Code)
+		}
+		if racingClient.request != nil || sportsClient.request != nil {
+			t.Errorf("Expected %s not to be sent to the services", target)
+		}
+	}
+}
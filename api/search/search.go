@@ -0,0 +1,171 @@
+package search
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+
+	"git.neds.sh/matty/entain/api/outgoing"
+	"git.neds.sh/matty/entain/api/params"
+	"git.neds.sh/matty/entain/api/proto/racing"
+	"git.neds.sh/matty/entain/api/proto/sports"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+// Number of merged results returned when no limit is requested, and the most that can be
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// Result is a single match from the racing or sports search index.
+type Result struct {
+	// Service the matched resource belongs to, racing or sports.
+	Service string `json:"service"`
+	Type    string `json:"type"`
+	// Id is encoded as a string, like ids elsewhere in the API.
+	Id          int64  `json:"id,string"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Score is the relevance of the match relative to the best from the same service, up to 1.
+	Score float64 `json:"score"`
+}
+
+// Response holds the merged results of a search, best matches first.
+type Response struct {
+	Results []*Result `json:"results"`
+}
+
+// Searcher searches the racing and sports services and merges their ranked results.
+type Searcher struct {
+	racing racing.RacingClient
+	sports sports.SportsClient
+}
+
+// NewSearcher creates a new searcher over the racing and sports services.
+func NewSearcher(racingClient racing.RacingClient, sportsClient sports.SportsClient) *Searcher {
+	return &Searcher{racing: racingClient, sports: sportsClient}
+}
+
+// Search queries both services concurrently and merges their results by score. Each service
+// returns at most limit results, so the merged results hold the best limit matches overall.
+// The services score matches against their own indexes, whose scores depend on how many
+// documents each holds and how often terms appear in them, so each service's scores are taken
+// relative to its best match before they are compared.
+func (s *Searcher) Search(ctx context.Context, query string, limit int64) (*Response, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	} else if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	var (
+		wg                       sync.WaitGroup
+		racingResults            *racing.SearchResponse
+		sportsResults            *sports.SearchResponse
+		racingError, sportsError error
+	)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		racingResults, racingError = s.racing.Search(ctx, &racing.SearchRequest{Query: query, Limit: limit})
+	}()
+	go func() {
+		defer wg.Done()
+		sportsResults, sportsError = s.sports.Search(ctx, &sports.SearchRequest{Query: query, Limit: limit})
+	}()
+	wg.Wait()
+
+	if racingError != nil {
+		return nil, racingError
+	}
+	if sportsError != nil {
+		return nil, sportsError
+	}
+
+	results := []*Result{}
+	var racingBest, sportsBest float64
+	for _, result := range racingResults.Results {
+		racingBest = math.Max(racingBest, result.Score)
+	}
+	for _, result := range racingResults.Results {
+		results = append(results, &Result{"racing", result.Type, result.Id, result.Title, result.Description, relative(result.Score, racingBest)})
+	}
+	for _, result := range sportsResults.Results {
+		sportsBest = math.Max(sportsBest, result.Score)
+	}
+	for _, result := range sportsResults.Results {
+		results = append(results, &Result{"sports", result.Type, result.Id, result.Title, result.Description, relative(result.Score, sportsBest)})
+	}
+
+	//Ties are broken on the resource so the order is stable between requests
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Id < b.Id
+	})
+
+	if int64(len(results)) > limit {
+		results = results[:limit]
+	}
+
+	return &Response{Results: results}, nil
+}
+
+// A score relative to the best from the same service, or 0 if it isn't positive
+func relative(score, best float64) float64 {
+	if score <= 0 || best <= 0 {
+		return 0
+	}
+	return score / best
+}
+
+// Handler serves searches from the q and limit query parameters, with errors written
+// the same way as the gateway's generated handlers.
+func (s *Searcher) Handler(mux *runtime.ServeMux) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+
+		p := params.New(r.URL.Query())
+		if err := p.Unknown([]string{"q", "limit"}); err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		query, limit := p.Get("q"), p.Int("limit", 64)
+		if err := p.Err(); err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		ctx, err := outgoing.Context(mux, r, "/gateway.Gateway/Search")
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		response, err := s.Search(ctx, query, limit)
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		body, err := outbound.Marshal(response)
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", outbound.ContentType(response))
+		w.Write(body)
+	}
+}
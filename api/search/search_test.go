@@ -0,0 +1,165 @@
+package search
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.neds.sh/matty/entain/api/proto/racing"
+	"git.neds.sh/matty/entain/api/proto/sports"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Racing client returning fixed search results, recording the request it was sent
+type mockRacingClient struct {
+	racing.RacingClient
+	request  *racing.SearchRequest
+	response *racing.SearchResponse
+	err      error
+}
+
+func (m *mockRacingClient) Search(ctx context.Context, in *racing.SearchRequest, opts ...grpc.CallOption) (*racing.SearchResponse, error) {
+	m.request = in
+	return m.response, m.err
+}
+
+// Sports client returning fixed search results, recording the request it was sent
+type mockSportsClient struct {
+	sports.SportsClient
+	request  *sports.SearchRequest
+	response *sports.SearchResponse
+	err      error
+}
+
+func (m *mockSportsClient) Search(ctx context.Context, in *sports.SearchRequest, opts ...grpc.CallOption) (*sports.SearchResponse, error) {
+	m.request = in
+	return m.response, m.err
+}
+
+// Tests results from both services are merged by score, relative to the best from each, and
+// cut to the limit
+func TestSearchMergesResults(t *testing.T) {
+	racingClient := &mockRacingClient{response: &racing.SearchResponse{Results: []*racing.SearchResult{
+		{Type: "RACE", Id: 7, Title: "Flemington", Score: 5},
+		{Type: "RACE", Id: 2, Title: "Flemington Cup", Score: 2},
+	}}}
+	sportsClient := &mockSportsClient{response: &sports.SearchResponse{Results: []*sports.SearchResult{
+		{Type: "LOCATION", Id: 4, Title: "Flemington", Score: 5},
+		{Type: "TEAM", Id: 9, Title: "Flemington Foxes", Score: 3},
+	}}}
+
+	response, err := NewSearcher(racingClient, sportsClient).Search(context.TODO(), "flemington", 3)
+	if err != nil {
+		t.Fatalf("Error searching: %v", err)
+	}
+
+	if racingClient.request.Limit != 3 || sportsClient.request.Limit != 3 {
+		t.Errorf("Expected the limit to be sent to both services, got %d and %d", racingClient.request.Limit, sportsClient.request.Limit)
+	}
+
+	expected := []Result{
+		{"sports", "LOCATION", 4, "Flemington", "", 1},
+		{"racing", "RACE", 7, "Flemington", "", 1},
+		{"sports", "TEAM", 9, "Flemington Foxes", "", 0.6},
+	}
+	if len(response.Results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(response.Results))
+	}
+	for i, result := range expected {
+		if *response.Results[i] != result {
+			t.Errorf("Result[%d] expected %v, got %v", i, result, *response.Results[i])
+		}
+	}
+}
+
+// Tests results are interleaved by relevance when one service scores on a larger scale
+func TestSearchScoreScales(t *testing.T) {
+	racingClient := &mockRacingClient{response: &racing.SearchResponse{Results: []*racing.SearchResult{
+		{Type: "RACE", Id: 7, Title: "Flemington", Score: 40},
+		{Type: "MEETING", Id: 2, Title: "Flemington Cup Day", Score: 30},
+		{Type: "RACE", Id: 3, Title: "Flemington Plate", Score: 10},
+	}}}
+	sportsClient := &mockSportsClient{response: &sports.SearchResponse{Results: []*sports.SearchResult{
+		{Type: "LOCATION", Id: 4, Title: "Flemington", Score: 2},
+		{Type: "TEAM", Id: 9, Title: "Flemington Foxes", Score: 1.8},
+		{Type: "EVENT", Id: 5, Title: "Foxes at Flemington", Score: 0.2},
+	}}}
+
+	response, err := NewSearcher(racingClient, sportsClient).Search(context.TODO(), "flemington", 4)
+	if err != nil {
+		t.Fatalf("Error searching: %v", err)
+	}
+
+	expected := []Result{
+		{"sports", "LOCATION", 4, "Flemington", "", 1},
+		{"racing", "RACE", 7, "Flemington", "", 1},
+		{"sports", "TEAM", 9, "Flemington Foxes", "", 0.9},
+		{"racing", "MEETING", 2, "Flemington Cup Day", "", 0.75},
+	}
+	if len(response.Results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(response.Results))
+	}
+	for i, result := range expected {
+		if *response.Results[i] != result {
+			t.Errorf("Result[%d] expected %v, got %v", i, result, *response.Results[i])
+		}
+	}
+}
+
+// Tests a failure from either service fails the search with its status
+func TestSearchServiceError(t *testing.T) {
+	racingClient := &mockRacingClient{response: &racing.SearchResponse{}}
+	sportsClient := &mockSportsClient{err: status.Error(codes.InvalidArgument, "query is required")}
+
+	_, err := NewSearcher(racingClient, sportsClient).Search(context.TODO(), "", 0)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected invalid argument error, got %v", err)
+	}
+
+	if racingClient.request.Limit != defaultLimit {
+		t.Errorf("Expected the default limit to be sent, got %d", racingClient.request.Limit)
+	}
+}
+
+// Tests the handler writes results as JSON and rejects an invalid limit or unknown parameters
+func TestHandler(t *testing.T) {
+	racingClient := &mockRacingClient{response: &racing.SearchResponse{Results: []*racing.SearchResult{
+		{Type: "RACE", Id: 7, Title: "Flemington", Description: "Race 7", Score: 1.5},
+	}}}
+	sportsClient := &mockSportsClient{response: &sports.SearchResponse{}}
+
+	mux := runtime.NewServeMux()
+	if err := mux.HandlePath(http.MethodGet, "/v1/search", NewSearcher(racingClient, sportsClient).Handler(mux)); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/search?q=race+7&limit=5", nil))
+
+	expected := `{"results":[{"service":"racing","type":"RACE","id":"7","title":"Flemington","description":"Race 7","score":1}]}`
+	if recorder.Code != http.StatusOK || recorder.Body.String() != expected {
+		t.Errorf("Expected %s, got %d %s", expected, recorder.Code, recorder.Body.String())
+	}
+	if racingClient.request.Query != "race 7" || racingClient.request.Limit != 5 {
+		t.Errorf("Expected query and limit from parameters, got %v", racingClient.request)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/search?q=race&limit=many", nil))
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected bad request for an invalid limit, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/search?q=race&page_size=5", nil))
+
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "unknown parameters page_size") {
+		t.Errorf("Expected bad request for an unknown parameter, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,37 @@
+// Package security sets the standard security headers on responses of the gateway, telling
+// browsers not to sniff, frame or run anything in them.
+package security
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ContentSecurityPolicy of API responses, which are data rather than pages, so nothing in them
+// may be loaded or run. Handlers serving pages set their own policy instead.
+const ContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'"
+
+// Middleware sets the security headers before passing requests on, so they are on every
+// response, errors included. HSTS is only sent when hstsMaxAge is above 0, for gateways
+// served over HTTPS, as browsers then refuse plain HTTP to the host until it expires.
+func Middleware(next http.Handler, hstsMaxAge time.Duration) http.Handler {
+	hsts := ""
+	if hstsMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(hstsMaxAge.Seconds())) + "; includeSubDomains"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("Content-Security-Policy", ContentSecurityPolicy)
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("Referrer-Policy", "no-referrer")
+		header.Set("Cross-Origin-Opener-Policy", "same-origin")
+		if len(hsts) > 0 {
+			header.Set("Strict-Transport-Security", hsts)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,50 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Tests the security headers are set, and a handler can set its own content security policy
+func TestMiddleware(t *testing.T) {
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/docs" {
+			w.Header().Set("Content-Security-Policy", "script-src https://cdn.jsdelivr.net")
+		}
+	}), 0)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/races", nil))
+
+	header := recorder.Header()
+	if header.Get("Content-Security-Policy") != ContentSecurityPolicy ||
+		header.Get("X-Content-Type-Options") != "nosniff" ||
+		header.Get("X-Frame-Options") != "DENY" ||
+		header.Get("Referrer-Policy") != "no-referrer" {
+		t.Errorf("Expected security headers, got %v", header)
+	}
+	if len(header.Get("Strict-Transport-Security")) > 0 {
+		t.Errorf("Expected no HSTS unless configured, got %v", header)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+	if recorder.Header().Get("Content-Security-Policy") != "script-src https://cdn.jsdelivr.net" {
+		t.Errorf("Expected the page's own policy, got %v", recorder.Header())
+	}
+}
+
+// Tests HSTS is sent when configured
+func TestHSTS(t *testing.T) {
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), 365*24*time.Hour)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/races", nil))
+
+	if recorder.Header().Get("Strict-Transport-Security") != "max-age=31536000; includeSubDomains" {
+		t.Errorf("Expected HSTS, got %v", recorder.Header())
+	}
+}
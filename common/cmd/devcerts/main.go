@@ -0,0 +1,65 @@
+// Command devcerts generates a local certificate authority with certificates for the services
+// and the gateway, for trying out TLS and mutual TLS locally.
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"git.neds.sh/matty/entain/common/devca"
+)
+
+var (
+	outDir   = flag.String("out", "./certs", "Directory the certificates and keys are written to")
+	hosts    = flag.String("hosts", "localhost,127.0.0.1", "Comma separated DNS names and IP addresses the certificates are for")
+	validFor = flag.Duration("valid-for", 30*24*time.Hour, "How long the certificates are valid for")
+)
+
+// Certificates issued, each written as <name>.pem and <name>-key.pem
+var names = []string{"racing", "sports", "api"}
+
+func main() {
+	flag.Parse()
+
+	if err := run(); err != nil {
+		log.Fatalf("failed generating certificates: %s\n", err)
+	}
+}
+
+func run() error {
+	if err := os.MkdirAll(*outDir, 0700); err != nil {
+		return err
+	}
+
+	authority, err := devca.NewAuthority("Entain development CA", *validFor)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(*outDir, "ca.pem"), authority.CertificatePEM, 0644); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		certificate, key, err := authority.Issue(name, strings.Split(*hosts, ","), *validFor)
+		if err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(*outDir, name+".pem"), certificate, 0644); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(*outDir, name+"-key.pem"), key, 0600); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("wrote CA and certificates for %s to %s\n", strings.Join(names, ", "), *outDir)
+
+	return nil
+}
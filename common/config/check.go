@@ -0,0 +1,89 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Required checks a value is set.
+func Required(value string) error {
+	if len(value) == 0 {
+		return errors.New("required")
+	}
+	return nil
+}
+
+// Optional applies a check only when a value is set.
+func Optional(check Check) Check {
+	return func(value string) error {
+		if len(value) == 0 {
+			return nil
+		}
+		return check(value)
+	}
+}
+
+// Endpoint checks a value is a host and port to listen on or dial, such as localhost:9000.
+func Endpoint(value string) error {
+	_, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// URL checks a value is an absolute http or https URL.
+func URL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+		return errors.New("expected an http or https URL")
+	}
+	return nil
+}
+
+// Positive checks a value is a duration greater than zero.
+func Positive(value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	if d <= 0 {
+		return errors.New("must be greater than zero")
+	}
+	return nil
+}
+
+// Ratio checks a value is a number from 0 to 1.
+func Ratio(value string) error {
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	if ratio < 0 || ratio > 1 {
+		return errors.New("must be from 0 to 1")
+	}
+	return nil
+}
+
+// OneOf checks a value is one of a set, ignoring case.
+func OneOf(allowed ...string) Check {
+	return func(value string) error {
+		for _, a := range allowed {
+			if strings.EqualFold(value, a) {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected one of %s", strings.Join(allowed, ", "))
+	}
+}
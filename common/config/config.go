@@ -0,0 +1,216 @@
+// Package config loads the settings of the gateway and services from a YAML or TOML file,
+// environment variables and command line flags, in increasing order of precedence, and
+// validates them at startup.
+//
+// Settings are declared as flags, and files and environment variables set them by flag name.
+// The flag --grpc-endpoint of the racing service is set by the grpc-endpoint key of the file,
+// or the RACING_GRPC_ENDPOINT environment variable.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Where the value of a setting came from, in increasing order of precedence
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// Check validates the value of a setting.
+type Check func(value string) error
+
+// Loader sets the flags of a flag set from a file and the environment, as well as the command line.
+type Loader struct {
+	flags   *flag.FlagSet
+	prefix  string
+	file    *string
+	print   *bool
+	checks  map[string][]Check
+	sources map[string]string
+}
+
+// New creates a loader for the flags of a flag set, reading environment variables named
+// with a prefix, such as RACING. It adds the --config and --print-config flags to the set.
+func New(flags *flag.FlagSet, prefix string) *Loader {
+	return &Loader{
+		flags:   flags,
+		prefix:  prefix,
+		file:    flags.String("config", "", "YAML or TOML file of settings by flag name, overridden by environment variables and flags"),
+		print:   flags.Bool("print-config", false, "Print the effective settings and where each came from, then exit"),
+		checks:  make(map[string][]Check),
+		sources: make(map[string]string),
+	}
+}
+
+// Check adds checks the value of a flag must pass once loaded.
+func (l *Loader) Check(name string, checks ...Check) {
+	l.checks[name] = append(l.checks[name], checks...)
+}
+
+// EnvName returns the environment variable a flag is set by.
+func (l *Loader) EnvName(name string) string {
+	return l.prefix + "_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Load parses the command line arguments, then sets the flags they didn't from the config
+// file and environment, and validates every flag with checks.
+func (l *Loader) Load(args []string) error {
+	if err := l.flags.Parse(args); err != nil {
+		return err
+	}
+
+	l.flags.VisitAll(func(f *flag.Flag) {
+		l.sources[f.Name] = sourceDefault
+	})
+	l.flags.Visit(func(f *flag.Flag) {
+		l.sources[f.Name] = sourceFlag
+	})
+
+	//The config file can itself be named in the environment, so it is read from first
+	if err := l.setFromEnv("config"); err != nil {
+		return err
+	}
+
+	if len(*l.file) > 0 {
+		settings, err := readFile(*l.file)
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(settings))
+		for name := range settings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if name == "config" || name == "print-config" {
+				return fmt.Errorf("%s: %s can't be set in a config file", *l.file, name)
+			}
+			if err := l.set(name, settings[name], sourceFile); err != nil {
+				return fmt.Errorf("%s: %w", *l.file, err)
+			}
+		}
+	}
+
+	var err error
+	l.flags.VisitAll(func(f *flag.Flag) {
+		if err == nil {
+			err = l.setFromEnv(f.Name)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return l.validate()
+}
+
+func (l *Loader) setFromEnv(name string) error {
+	value, ok := os.LookupEnv(l.EnvName(name))
+	if !ok {
+		return nil
+	}
+	if err := l.set(name, value, sourceEnv); err != nil {
+		return fmt.Errorf("%s: %w", l.EnvName(name), err)
+	}
+	return nil
+}
+
+// Set a flag from a source, unless it was set by one with higher precedence
+func (l *Loader) set(name string, value string, source string) error {
+	f := l.flags.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("unknown setting %s", name)
+	}
+	if precedence(l.sources[name]) > precedence(source) {
+		return nil
+	}
+
+	if err := f.Value.Set(value); err != nil {
+		return fmt.Errorf("invalid value %q for %s: %w", value, name, err)
+	}
+	l.sources[name] = source
+
+	return nil
+}
+
+func precedence(source string) int {
+	switch source {
+	case sourceFile:
+		return 1
+	case sourceEnv:
+		return 2
+	case sourceFlag:
+		return 3
+	}
+	return 0
+}
+
+// Every failed check is reported, so that a bad config can be fixed in one go
+func (l *Loader) validate() error {
+	names := make([]string, 0, len(l.checks))
+	for name := range l.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		f := l.flags.Lookup(name)
+		if f == nil {
+			problems = append(problems, fmt.Sprintf("unknown setting %s", name))
+			continue
+		}
+
+		value := f.Value.String()
+		for _, check := range l.checks[name] {
+			if err := check(value); err != nil {
+				problems = append(problems, fmt.Sprintf("invalid %s %q from %s: %s", name, value, l.sources[name], err))
+				break
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// PrintRequested reports whether the effective settings should be printed instead of running.
+func (l *Loader) PrintRequested() bool {
+	return *l.print
+}
+
+// Print writes the effective settings as YAML, which can be used as a config file, noting
+// where each came from.
+func (l *Loader) Print(w io.Writer) error {
+	var err error
+	l.flags.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+
+		source := l.sources[f.Name]
+		switch source {
+		case sourceFile:
+			source = "file " + *l.file
+		case sourceEnv:
+			source = "env " + l.EnvName(f.Name)
+		}
+
+		_, err = fmt.Fprintf(w, "%s: %s # %s\n", f.Name, strconv.Quote(f.Value.String()), source)
+	})
+	return err
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testSettings struct {
+	loader   *Loader
+	endpoint *string
+	interval *time.Duration
+	ratio    *float64
+	certFile *string
+}
+
+func newTestSettings() *testSettings {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+
+	s := &testSettings{
+		loader:   New(flags, "TEST"),
+		endpoint: flags.String("grpc-endpoint", "localhost:9000", ""),
+		interval: flags.Duration("health-check-interval", 5*time.Second, ""),
+		ratio:    flags.Float64("trace-sample-ratio", 1, ""),
+		certFile: flags.String("tls-cert-file", "", ""),
+	}
+	s.loader.Check("grpc-endpoint", Required, Endpoint)
+	s.loader.Check("health-check-interval", Positive)
+	s.loader.Check("trace-sample-ratio", Ratio)
+
+	return s
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func setEnv(t *testing.T, name string, value string) {
+	os.Setenv(name, value)
+	t.Cleanup(func() { os.Unsetenv(name) })
+}
+
+// Tests flags override the environment, which overrides the file, which overrides defaults
+func TestPrecedence(t *testing.T) {
+	path := writeFile(t, "racing.yaml", `
+grpc-endpoint: localhost:9010
+health-check-interval: 10s
+trace-sample-ratio: 0.5
+tls:
+  cert-file: ./certs/racing.pem
+`)
+	setEnv(t, "TEST_HEALTH_CHECK_INTERVAL", "20s")
+	setEnv(t, "TEST_GRPC_ENDPOINT", "localhost:9020")
+
+	s := newTestSettings()
+	if err := s.loader.Load([]string{"--config", path, "--grpc-endpoint", "localhost:9030"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if *s.endpoint != "localhost:9030" || *s.interval != 20*time.Second || *s.ratio != 0.5 || *s.certFile != "./certs/racing.pem" {
+		t.Errorf("Unexpected settings %s %s %v %s", *s.endpoint, *s.interval, *s.ratio, *s.certFile)
+	}
+
+	var printed bytes.Buffer
+	if err := s.loader.Print(&printed); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `grpc-endpoint: "localhost:9030" # flag
+health-check-interval: "20s" # env TEST_HEALTH_CHECK_INTERVAL
+tls-cert-file: "./certs/racing.pem" # file ` + path + `
+trace-sample-ratio: "0.5" # file ` + path + `
+`
+	if printed.String() != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, printed.String())
+	}
+}
+
+// Tests TOML files are read the same as YAML, and can be named in the environment
+func TestTOML(t *testing.T) {
+	path := writeFile(t, "racing.toml", `
+grpc-endpoint = "localhost:9010"
+trace-sample-ratio = 0.25
+
+[tls]
+cert-file = "./certs/racing.pem"
+`)
+	setEnv(t, "TEST_CONFIG", path)
+
+	s := newTestSettings()
+	if err := s.loader.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if *s.endpoint != "localhost:9010" || *s.ratio != 0.25 || *s.certFile != "./certs/racing.pem" {
+		t.Errorf("Unexpected settings %s %v %s", *s.endpoint, *s.ratio, *s.certFile)
+	}
+}
+
+// Tests mistakes are reported, every failed check at once
+func TestInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown.yaml": "grpc-endpont: localhost:9000\n",
+		"badtype.yaml": "health-check-interval: often\n",
+		"list.yaml":    "grpc-endpoint: [a, b]\n",
+		"config.json":  "{}",
+	} {
+		s := newTestSettings()
+		if err := s.loader.Load([]string{"--config", writeFile(t, name, content)}); err == nil {
+			t.Errorf("Expected an error loading %s", name)
+		}
+	}
+
+	s := newTestSettings()
+	err := s.loader.Load([]string{"--grpc-endpoint", "localhost", "--health-check-interval", "0s", "--trace-sample-ratio", "2"})
+	if err == nil {
+		t.Fatal("Expected the settings to be invalid")
+	}
+	for _, name := range []string{"grpc-endpoint", "health-check-interval", "trace-sample-ratio"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected %s to be reported, got %s", name, err)
+		}
+	}
+}
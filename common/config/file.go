@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Read the settings in a YAML or TOML file by flag name, with nested keys joined by hyphens,
+// so that tls: {cert-file: ...} sets --tls-cert-file
+func readFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &decoded)
+	case ".toml":
+		err = toml.Unmarshal(data, &decoded)
+	default:
+		return nil, fmt.Errorf("%s: config files must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	settings := make(map[string]string)
+	if err := flatten(settings, "", decoded); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return settings, nil
+}
+
+func flatten(settings map[string]string, prefix string, value interface{}) error {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range value {
+			if err := flatten(settings, join(prefix, key), nested); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		//YAML maps can have keys of any type
+		for key, nested := range value {
+			if err := flatten(settings, join(prefix, fmt.Sprint(key)), nested); err != nil {
+				return err
+			}
+		}
+	case []interface{}, []map[string]interface{}:
+		return fmt.Errorf("%s can't be a list", prefix)
+	case nil:
+		//Empty values leave the setting as it was
+	default:
+		settings[prefix] = fmt.Sprint(value)
+	}
+	return nil
+}
+
+func join(prefix string, key string) string {
+	if len(prefix) == 0 {
+		return key
+	}
+	return prefix + "-" + key
+}
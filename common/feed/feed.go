@@ -0,0 +1,190 @@
+// Package feed broadcasts the updates a service publishes to the streams watching them, holding
+// the latest so that watchers reconnecting can resume after the last update they received.
+package feed
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrLagged is returned to watchers that fell too far behind the updates being published,
+// which can resume after the last update they received.
+var ErrLagged = errors.New("watcher fell behind the updates published")
+
+// ErrClosed is returned to watchers once the feed is closed, such as when the service is
+// shutting down, which can resume after the last update received elsewhere.
+var ErrClosed = errors.New("feed closed")
+
+// Updates published but not yet taken by a watcher before it is dropped as lagging
+const watcherBuffer = 256
+
+// Update is a message published to a feed, with the id it was given.
+type Update struct {
+	// Id is increasing, so watchers can resume after the last they received.
+	Id      uint64
+	Message proto.Message
+}
+
+// Feed holds the latest updates published, and passes each on to the watchers.
+type Feed struct {
+	mu       sync.Mutex
+	capacity int
+	first    uint64
+	next     uint64
+	held     []Update
+	watchers map[*Watcher]bool
+	closed   bool
+}
+
+// New creates a feed holding up to capacity of the latest updates for watchers to resume
+// after.
+func New(capacity int) *Feed {
+	//Ids start from the time the feed is created, so they keep increasing when the service
+	//restarts, and ids from before the restart are known to be from another run
+	first := uint64(time.Now().UnixNano() / int64(time.Microsecond))
+
+	return &Feed{
+		capacity: capacity,
+		first:    first,
+		next:     first,
+		watchers: make(map[*Watcher]bool),
+	}
+}
+
+// Publish gives a message the next id and passes it on to the watchers. Watchers too far
+// behind to take it are dropped.
+func (f *Feed) Publish(message proto.Message) Update {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	update := Update{Id: f.next, Message: message}
+	f.next++
+
+	f.held = append(f.held, update)
+	if len(f.held) > f.capacity {
+		f.held = append(f.held[:0:0], f.held[len(f.held)-f.capacity:]...)
+	}
+
+	for watcher := range f.watchers {
+		select {
+		case watcher.updates <- update:
+		default:
+			delete(f.watchers, watcher)
+			close(watcher.updates)
+		}
+	}
+
+	return update
+}
+
+// Watch starts watching the updates published after the one with the id, replaying those
+// held, or only those published from now if the id is 0. Resumed is false when updates since
+// the id are no longer held, or it is from another run, in which case no updates are replayed
+// and the watcher must assume it has missed some.
+func (f *Feed) Watch(afterId uint64) (watcher *Watcher, resumed bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	watcher = &Watcher{feed: f, updates: make(chan Update, watcherBuffer)}
+	//Watchers of a closed feed are ended by Next straight away, with nothing missed yet
+	if f.closed {
+		close(watcher.updates)
+		return watcher, true
+	}
+	f.watchers[watcher] = true
+
+	if f.next > f.first {
+		watcher.latest = f.next - 1
+	}
+
+	if afterId == 0 {
+		return watcher, true
+	}
+
+	oldest := f.next
+	if len(f.held) > 0 {
+		oldest = f.held[0].Id
+	}
+	if afterId < f.first || afterId >= f.next || afterId+1 < oldest {
+		return watcher, false
+	}
+
+	for _, update := range f.held {
+		if update.Id > afterId {
+			watcher.replay = append(watcher.replay, update)
+		}
+	}
+	return watcher, true
+}
+
+// Close ends every watcher, and those that start watching after, which then receive ErrClosed.
+func (f *Feed) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	for watcher := range f.watchers {
+		delete(f.watchers, watcher)
+		close(watcher.updates)
+	}
+}
+
+// Watcher receives the updates published to a feed after it started watching.
+type Watcher struct {
+	feed    *Feed
+	latest  uint64
+	replay  []Update
+	updates chan Update
+}
+
+// Latest returns the id of the latest update published when the watcher started, or 0 if none
+// had been. Watchers that missed updates can resume after it once they have caught up.
+func (w *Watcher) Latest() uint64 {
+	return w.latest
+}
+
+// Next waits for the next update, replaying those held first. ErrLagged is returned if the
+// watcher fell behind, ErrClosed once the feed is closed, or the context's error once it is done.
+func (w *Watcher) Next(ctx context.Context) (Update, error) {
+	if len(w.replay) > 0 {
+		update := w.replay[0]
+		w.replay = w.replay[1:]
+		return update, nil
+	}
+
+	select {
+	case update, ok := <-w.updates:
+		if !ok {
+			return Update{}, w.err()
+		}
+		return update, nil
+	case <-ctx.Done():
+		return Update{}, ctx.Err()
+	}
+}
+
+// Close stops watching the feed.
+func (w *Watcher) Close() {
+	w.feed.mu.Lock()
+	defer w.feed.mu.Unlock()
+
+	if w.feed.watchers[w] {
+		delete(w.feed.watchers, w)
+		close(w.updates)
+	}
+}
+
+// Watchers' channels are closed when they lag, or the feed is closed
+func (w *Watcher) err() error {
+	w.feed.mu.Lock()
+	defer w.feed.mu.Unlock()
+
+	if w.feed.closed {
+		return ErrClosed
+	}
+	return ErrLagged
+}
@@ -0,0 +1,108 @@
+package feed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func next(t *testing.T, watcher *Watcher) Update {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	update, err := watcher.Next(ctx)
+	if err != nil {
+		t.Fatalf("Error waiting for update: %v", err)
+	}
+	return update
+}
+
+// Tests watchers receive the updates published after they started watching, in order
+func TestWatch(t *testing.T) {
+	f := New(10)
+	f.Publish(wrapperspb.String("before"))
+
+	watcher, resumed := f.Watch(0)
+	defer watcher.Close()
+	if !resumed {
+		t.Errorf("Expected watching from now to be resumed")
+	}
+
+	first := f.Publish(wrapperspb.String("first"))
+	second := f.Publish(wrapperspb.String("second"))
+	if second.Id != first.Id+1 {
+		t.Errorf("Expected increasing ids, got %d then %d", first.Id, second.Id)
+	}
+
+	for _, expected := range []Update{first, second} {
+		if update := next(t, watcher); update.Id != expected.Id || update.Message.(*wrapperspb.StringValue).Value != expected.Message.(*wrapperspb.StringValue).Value {
+			t.Errorf("Expected update %v, got %v", expected, update)
+		}
+	}
+}
+
+// Tests watchers resuming after an id are replayed the updates held since, unless some aren't
+func TestResume(t *testing.T) {
+	f := New(2)
+	first := f.Publish(wrapperspb.String("first"))
+	second := f.Publish(wrapperspb.String("second"))
+	third := f.Publish(wrapperspb.String("third"))
+
+	watcher, resumed := f.Watch(first.Id)
+	if !resumed || next(t, watcher).Id != second.Id || next(t, watcher).Id != third.Id {
+		t.Errorf("Expected the updates after %d to be replayed", first.Id)
+	}
+	watcher.Close()
+
+	fourth := f.Publish(wrapperspb.String("fourth"))
+
+	//The update after the first is no longer held, the one before it is from another run, and
+	//the one after the fourth hasn't been published
+	for _, afterId := range []uint64{first.Id, first.Id - 1, fourth.Id + 1} {
+		watcher, resumed := f.Watch(afterId)
+		if resumed || len(watcher.replay) > 0 || watcher.Latest() != fourth.Id {
+			t.Errorf("Expected resuming after %d not to be possible, and to resume after %d instead", afterId, fourth.Id)
+		}
+		watcher.Close()
+	}
+}
+
+// Tests watchers that fall behind are dropped, and the feed isn't held up by them
+func TestLagged(t *testing.T) {
+	f := New(1)
+	watcher, _ := f.Watch(0)
+
+	for i := 0; i < watcherBuffer+1; i++ {
+		f.Publish(wrapperspb.String("update"))
+	}
+
+	var err error
+	for i := 0; i <= watcherBuffer && err == nil; i++ {
+		_, err = watcher.Next(context.Background())
+	}
+	if err != ErrLagged {
+		t.Errorf("Expected the watcher to have lagged, got %v", err)
+	}
+
+	//Closing a dropped watcher does nothing
+	watcher.Close()
+}
+
+// Tests closing the feed ends its watchers, and those that start watching after
+func TestClose(t *testing.T) {
+	f := New(10)
+	watcher, _ := f.Watch(0)
+	f.Close()
+
+	if _, err := watcher.Next(context.Background()); err != ErrClosed {
+		t.Errorf("Expected the watcher to be closed, got %v", err)
+	}
+
+	watcher, _ = f.Watch(0)
+	if _, err := watcher.Next(context.Background()); err != ErrClosed {
+		t.Errorf("Expected watching a closed feed to be closed, got %v", err)
+	}
+	watcher.Close()
+}
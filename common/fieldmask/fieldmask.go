@@ -0,0 +1,85 @@
+// Package fieldmask applies the read masks of requests to the messages the services return,
+// so that clients are sent only the fields they ask for.
+package fieldmask
+
+import (
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// Validate checks every path of a mask names a field of the message, or a field nested in one.
+func Validate(mask *fieldmaskpb.FieldMask, message proto.Message) error {
+	_, err := fieldmaskpb.New(message, mask.GetPaths()...)
+	return err
+}
+
+// Fields returns the top level fields named by a mask in order, or nil if the mask is empty
+// and every field is wanted.
+func Fields(mask *fieldmaskpb.FieldMask) []string {
+	seen := make(map[string]bool)
+	var fields []string
+	for _, path := range mask.GetPaths() {
+		field := strings.SplitN(path, ".", 2)[0]
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Prune clears every field of a message not named by a mask, leaving it unchanged if the mask
+// is empty. Paths into repeated and map fields keep the whole field.
+func Prune(message proto.Message, mask *fieldmaskpb.FieldMask) {
+	if len(mask.GetPaths()) == 0 || message == nil {
+		return
+	}
+
+	tree := make(node)
+	for _, path := range mask.GetPaths() {
+		tree.add(strings.Split(path, "."))
+	}
+	tree.prune(message.ProtoReflect())
+}
+
+// Fields named by a mask, each with those named within it, or none if it is wanted whole
+type node map[string]node
+
+func (n node) add(path []string) {
+	child, ok := n[path[0]]
+	if ok && len(child) == 0 {
+		//The whole field is already wanted
+		return
+	}
+	if len(path) == 1 {
+		n[path[0]] = node{}
+		return
+	}
+	if !ok {
+		child = make(node)
+		n[path[0]] = child
+	}
+	child.add(path[1:])
+}
+
+func (n node) prune(message protoreflect.Message) {
+	if !message.IsValid() {
+		return
+	}
+
+	message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		child, ok := n[string(field.Name())]
+		switch {
+		case !ok:
+			message.Clear(field)
+		case len(child) > 0 && field.Message() != nil && !field.IsList() && !field.IsMap():
+			child.prune(value.Message())
+		}
+		return true
+	})
+}
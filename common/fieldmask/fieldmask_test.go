@@ -0,0 +1,68 @@
+package fieldmask
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func sampleFile() *descriptorpb.FileDescriptorProto {
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("racing.proto"),
+		Package: proto.String("racing"),
+		Options: &descriptorpb.FileOptions{
+			GoPackage:   proto.String("/racing"),
+			JavaPackage: proto.String("sh.neds.racing"),
+		},
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Race")}},
+	}
+}
+
+// Tests paths are checked against the message, and reduced to the top level fields they name
+func TestValidateAndFields(t *testing.T) {
+	mask := &fieldmaskpb.FieldMask{Paths: []string{"package", "options.go_package", "name", "options"}}
+	if err := Validate(mask, &descriptorpb.FileDescriptorProto{}); err != nil {
+		t.Errorf("Expected mask to be valid, got %v", err)
+	}
+	if fields := Fields(mask); !reflect.DeepEqual(fields, []string{"name", "options", "package"}) {
+		t.Errorf("Expected the top level fields in order, got %v", fields)
+	}
+
+	if err := Validate(&fieldmaskpb.FieldMask{Paths: []string{"options.colour"}}, &descriptorpb.FileDescriptorProto{}); err == nil {
+		t.Error("Expected an unknown field to be rejected")
+	}
+	if err := Validate(nil, &descriptorpb.FileDescriptorProto{}); err != nil || Fields(nil) != nil {
+		t.Errorf("Expected an empty mask to want every field, got %v", err)
+	}
+}
+
+// Tests fields not named are cleared, within nested messages too
+func TestPrune(t *testing.T) {
+	file := sampleFile()
+	Prune(file, &fieldmaskpb.FieldMask{Paths: []string{"name", "options.go_package", "message_type.name"}})
+
+	expected := &descriptorpb.FileDescriptorProto{
+		Name:        proto.String("racing.proto"),
+		Options:     &descriptorpb.FileOptions{GoPackage: proto.String("/racing")},
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Race")}},
+	}
+	if !proto.Equal(file, expected) {
+		t.Errorf("Expected %v, got %v", expected, file)
+	}
+
+	//A field wanted whole isn't narrowed by a path within it
+	file = sampleFile()
+	Prune(file, &fieldmaskpb.FieldMask{Paths: []string{"options", "options.go_package"}})
+	if file.Options.GetJavaPackage() == "" || file.GetName() != "" {
+		t.Errorf("Expected only the whole options to be kept, got %v", file)
+	}
+
+	file = sampleFile()
+	Prune(file, nil)
+	if !proto.Equal(file, sampleFile()) {
+		t.Errorf("Expected an empty mask to keep every field, got %v", file)
+	}
+}
@@ -0,0 +1,132 @@
+// Package health serves the standard grpc.health.v1 service for a gRPC server, with the
+// serving status following checks of the dependencies the server needs, such as its database.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"git.neds.sh/matty/entain/common/logging"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Check returns an error when a dependency of the server is unavailable.
+type Check func(ctx context.Context) error
+
+// Monitor serves the health of a gRPC server and the services it registers, as determined by
+// a check. Check requests run the check on demand, while watchers are notified of changes found
+// by the checks run periodically by Run.
+type Monitor struct {
+	*health.Server
+
+	check    Check
+	timeout  time.Duration
+	services []string
+
+	mu      sync.Mutex
+	checked bool
+	serving bool
+	stopped bool
+}
+
+// NewMonitor creates a monitor of the overall server health and the named services, all of
+// which report the outcome of the same check. Checks taking longer than the timeout fail.
+// Everything is reported as not serving until a check first succeeds.
+func NewMonitor(check Check, timeout time.Duration, services ...string) *Monitor {
+	m := &Monitor{
+		Server:   health.NewServer(),
+		check:    check,
+		timeout:  timeout,
+		services: append([]string{""}, services...),
+	}
+
+	for _, service := range m.services {
+		m.Server.SetServingStatus(service, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+
+	return m
+}
+
+// Check runs the check, and reports the health of the server or one of its services.
+func (m *Monitor) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if !m.known(in.Service) {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", in.Service)
+	}
+
+	m.update(ctx)
+
+	return m.Server.Check(ctx, in)
+}
+
+// Run checks health on each interval until the context is done, after which everything is
+// reported as not serving, so that clients stop sending requests to a server shutting down.
+func (m *Monitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m.update(ctx)
+
+		select {
+		case <-ctx.Done():
+			m.Shutdown()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown reports everything as not serving, ignoring later checks.
+func (m *Monitor) Shutdown() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stopped = true
+	m.Server.Shutdown()
+}
+
+func (m *Monitor) known(service string) bool {
+	for _, known := range m.services {
+		if known == service {
+			return true
+		}
+	}
+	return false
+}
+
+// Run the check and set the status of everything monitored, logging when it changes
+func (m *Monitor) update(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	err := m.check(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopped {
+		return
+	}
+
+	serving := err == nil
+	if !m.checked || serving != m.serving {
+		if serving {
+			logging.Info("health check passed, serving")
+		} else {
+			logging.Warn("health check failed, not serving", "error", err)
+		}
+	}
+	m.checked, m.serving = true, serving
+
+	servingStatus := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		servingStatus = healthpb.HealthCheckResponse_SERVING
+	}
+	for _, service := range m.services {
+		m.Server.SetServingStatus(service, servingStatus)
+	}
+}
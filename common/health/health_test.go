@@ -0,0 +1,65 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Tests the status follows the check on demand, for the server and its services
+func TestCheck(t *testing.T) {
+	var checkErr error
+	monitor := NewMonitor(func(ctx context.Context) error { return checkErr }, time.Second, "racing.Racing")
+
+	for _, service := range []string{"", "racing.Racing"} {
+		response, err := monitor.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil || response.Status != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Expected %q serving, got %v %v", service, response, err)
+		}
+	}
+
+	checkErr = errors.New("database is locked")
+	response, err := monitor.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "racing.Racing"})
+	if err != nil || response.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected not serving once the check fails, got %v %v", response, err)
+	}
+
+	if _, err := monitor.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "sports.Sports"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for an unknown service, got %v", err)
+	}
+}
+
+// Tests slow checks fail, and that nothing is serving once the monitor is stopped
+func TestRun(t *testing.T) {
+	monitor := NewMonitor(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, 10*time.Millisecond)
+
+	response, err := monitor.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || response.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected a check exceeding its timeout to fail, got %v %v", response, err)
+	}
+
+	monitor.check = func(ctx context.Context) error { return nil }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		monitor.Run(ctx, time.Hour)
+		close(done)
+	}()
+
+	cancel()
+	<-done
+
+	response, err = monitor.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || response.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected not serving after the monitor stopped, got %v %v", response, err)
+	}
+}
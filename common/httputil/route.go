@@ -0,0 +1,27 @@
+package httputil
+
+import "strings"
+
+// MatchRoute reports whether a request's method and path match a route, given as a method and
+// path such as POST /v1/event/*/score. Path segments of * match any single segment, and
+// methods are matched ignoring case.
+func MatchRoute(route string, method string, path string) bool {
+	fields := strings.Fields(route)
+	if len(fields) != 2 || !strings.EqualFold(fields[0], method) {
+		return false
+	}
+
+	routeSegments := strings.Split(strings.Trim(fields[1], "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(routeSegments) != len(pathSegments) {
+		return false
+	}
+
+	for i, segment := range routeSegments {
+		if segment != "*" && segment != pathSegments[i] {
+			return false
+		}
+	}
+
+	return true
+}
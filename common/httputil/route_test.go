@@ -0,0 +1,28 @@
+package httputil
+
+import "testing"
+
+// Tests routes match on their method and on each path segment, with * matching any one segment
+func TestMatchRoute(t *testing.T) {
+	for _, test := range []struct {
+		route, method, path string
+		matches             bool
+	}{
+		{"POST /v1/list-races", "POST", "/v1/list-races", true},
+		{"post /v1/list-races", "POST", "/v1/list-races", true},
+		{"POST /v1/list-races", "GET", "/v1/list-races", false},
+		{"POST /v1/list-races/", "POST", "v1/list-races", true},
+		{"POST /v1/event/*/score", "POST", "/v1/event/12/score", true},
+		{"POST /v1/event/*/score", "POST", "/v1/event/12/13/score", false},
+		{"POST /v1/event/*/score", "POST", "/v1/event/12", false},
+		{"GET /v1/race/*", "GET", "/v1/race/7", true},
+		{"GET /v1/race/*", "GET", "/v1/races", false},
+		{"GET /", "GET", "/", true},
+		{"/v1/list-races", "POST", "/v1/list-races", false},
+		{"", "POST", "/", false},
+	} {
+		if MatchRoute(test.route, test.method, test.path) != test.matches {
+			t.Errorf("Expected %q matching %s %s to be %t", test.route, test.method, test.path, test.matches)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Package identity carries the caller identity the gateway authenticates to the services, and
+// requires the roles methods need in the services, trusting the identity forwarded only from
+// clients that authenticated themselves with a certificate.
+package identity
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys the authenticated subject and roles are forwarded to backend services with
+const (
+	SubjectMetadataKey = "x-auth-subject"
+	RolesMetadataKey   = "x-auth-roles"
+)
+
+// AdminRole is the role required by admin writes, such as updating scores.
+const AdminRole = "admin"
+
+// Authorizer requires the callers of methods to hold roles, read from the identity forwarded
+// with each call by a trusted client.
+type Authorizer struct {
+	roles          map[string]string
+	trustedClients map[string]bool
+	trustPlaintext bool
+}
+
+// NewAuthorizer creates an Authorizer requiring the role given for each full method name, such
+// as /sports.Sports/UpdateScore. Identities are trusted from clients presenting a verified
+// certificate with one of the trusted common names, over mutual TLS, or from any client when
+// trusting plaintext, which is only safe when nothing but the gateway can reach the service.
+func NewAuthorizer(roles map[string]string, trustedClients []string, trustPlaintext bool) *Authorizer {
+	trusted := make(map[string]bool, len(trustedClients))
+	for _, name := range trustedClients {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			trusted[name] = true
+		}
+	}
+
+	return &Authorizer{roles: roles, trustedClients: trusted, trustPlaintext: trustPlaintext}
+}
+
+// UnaryServerInterceptor rejects calls to methods requiring a role that aren't forwarded by a
+// trusted client, or whose caller doesn't hold the role.
+func (a *Authorizer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := a.authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (a *Authorizer) authorize(ctx context.Context, method string) error {
+	role, ok := a.roles[method]
+	if !ok {
+		return nil
+	}
+
+	if !a.trusted(ctx) {
+		return status.Error(codes.Unauthenticated, "caller identity is only accepted from trusted clients over mutual TLS")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, roles := range md.Get(RolesMetadataKey) {
+		for _, held := range strings.Split(roles, ",") {
+			if strings.TrimSpace(held) == role {
+				return nil
+			}
+		}
+	}
+
+	return status.Errorf(codes.PermissionDenied, "%s role required", role)
+}
+
+// Clients are trusted when they presented a certificate that was verified, for a trusted name
+func (a *Authorizer) trusted(ctx context.Context) bool {
+	if a.trustPlaintext {
+		return true
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.PeerCertificates) == 0 {
+		return false
+	}
+
+	return a.trustedClients[info.State.PeerCertificates[0].Subject.CommonName]
+}
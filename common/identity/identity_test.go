@@ -0,0 +1,73 @@
+package identity
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const updateScore = "/sports.Sports/UpdateScore"
+
+// A call from a client that presented a certificate with a name, verified or not, forwarding roles
+func callContext(name string, verified bool, roles string) context.Context {
+	certificate := &x509.Certificate{Subject: pkix.Name{CommonName: name}}
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{certificate}}
+	if verified {
+		state.VerifiedChains = [][]*x509.Certificate{{certificate}}
+	}
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(SubjectMetadataKey, "user-1", RolesMetadataKey, roles))
+}
+
+// Call a method through an authorizer's interceptor, returning the code it ended with
+func call(ctx context.Context, authorizer *Authorizer, method string) codes.Code {
+	_, err := authorizer.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	return status.Code(err)
+}
+
+// Tests roles are only accepted when forwarded by trusted clients over mutual TLS
+func TestAuthorizer(t *testing.T) {
+	authorizer := NewAuthorizer(map[string]string{updateScore: AdminRole}, []string{"api"}, false)
+
+	for _, test := range []struct {
+		name     string
+		ctx      context.Context
+		method   string
+		expected codes.Code
+	}{
+		{"admin from the gateway", callContext("api", true, "reader,admin"), updateScore, codes.OK},
+		{"reader from the gateway", callContext("api", true, "reader"), updateScore, codes.PermissionDenied},
+		{"admin from another client", callContext("racing", true, "admin"), updateScore, codes.Unauthenticated},
+		{"admin with an unverified certificate", callContext("api", false, "admin"), updateScore, codes.Unauthenticated},
+		{"admin over plaintext", metadata.NewIncomingContext(context.Background(), metadata.Pairs(RolesMetadataKey, "admin")), updateScore, codes.Unauthenticated},
+		{"anyone reading", context.Background(), "/sports.Sports/ListEvents", codes.OK},
+	} {
+		if code := call(test.ctx, authorizer, test.method); code != test.expected {
+			t.Errorf("Expected %s for %s, got %s", test.expected, test.name, code)
+		}
+	}
+}
+
+// Tests roles are accepted from any client when plaintext is trusted
+func TestAuthorizerPlaintext(t *testing.T) {
+	authorizer := NewAuthorizer(map[string]string{updateScore: AdminRole}, nil, true)
+
+	if code := call(metadata.NewIncomingContext(context.Background(), metadata.Pairs(RolesMetadataKey, "admin")), authorizer, updateScore); code != codes.OK {
+		t.Errorf("Expected the admin to be accepted, got %s", code)
+	}
+	if code := call(context.Background(), authorizer, updateScore); code != codes.PermissionDenied {
+		t.Errorf("Expected a caller without roles to be denied, got %s", code)
+	}
+}
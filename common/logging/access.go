@@ -0,0 +1,206 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"git.neds.sh/matty/entain/common/httputil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// RequestIDHeader is the HTTP header request ids are accepted from and returned in.
+	RequestIDHeader = "X-Request-Id"
+	// RequestIDMetadata is the gRPC metadata key request ids are forwarded to the services in.
+	RequestIDMetadata = "x-request-id"
+)
+
+// Longest request id accepted from callers, longer ids are replaced
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a context carrying the id of the request it is for.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the id of the request a context is for, empty if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// FromContext returns the default logger, adding the request id of the context if it has one.
+func FromContext(ctx context.Context) *Logger {
+	if id := RequestIDFromContext(ctx); len(id) > 0 {
+		return Default().With("request_id", id)
+	}
+	return Default()
+}
+
+// NewRequestID generates a random request id.
+func NewRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Request ids from callers are accepted if they are short and printable, so they can't
+// inject anything into logs or headers
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware assigns each request an id, accepting the caller's from the X-Request-Id header
+// if it is valid and generating one otherwise, and returns it in the same header. Each request
+// is logged once it is served, with its status, size and how long it took.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		recorder := httputil.NewResponseRecorder(w)
+		next.ServeHTTP(recorder, r.WithContext(ContextWithRequestID(r.Context(), id)))
+
+		Default().log(levelForHTTPStatus(recorder.Status), "http request",
+			[]interface{}{
+				"request_id", id,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", recorder.Status,
+				"bytes", recorder.Bytes,
+				"duration_ms", time.Since(start),
+				"remote_addr", r.RemoteAddr,
+				"user_agent", r.UserAgent(),
+			})
+	})
+}
+
+func levelForHTTPStatus(status int) Level {
+	if status >= http.StatusInternalServerError {
+		return LevelError
+	}
+	return LevelInfo
+}
+
+// UnaryClientInterceptor forwards the request id of the context to the server in metadata.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if id := RequestIDFromContext(ctx); len(id) > 0 {
+			ctx = metadata.AppendToOutgoingContext(ctx, RequestIDMetadata, id)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor forwards the request id of the context to the server in metadata
+// when a stream is opened, such as the watch streams behind the gateway's live updates.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if id := RequestIDFromContext(ctx); len(id) > 0 {
+			ctx = metadata.AppendToOutgoingContext(ctx, RequestIDMetadata, id)
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// UnaryServerInterceptor takes the request id forwarded by the client, generating one for
+// clients that didn't, and logs each request once it is handled.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		ctx, id := serverRequestID(ctx)
+
+		resp, err := handler(ctx, req)
+		logRPC(id, info.FullMethod, start, err)
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor logs each stream once it ends, with the request id of its client.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx, id := serverRequestID(stream.Context())
+
+		err := handler(srv, &requestIDStream{ServerStream: stream, ctx: ctx})
+		logRPC(id, info.FullMethod, start, err)
+
+		return err
+	}
+}
+
+func serverRequestID(ctx context.Context) (context.Context, string) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDMetadata); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	if !validRequestID(id) {
+		id = NewRequestID()
+	}
+
+	return ContextWithRequestID(ctx, id), id
+}
+
+func logRPC(id string, method string, start time.Time, err error) {
+	code := status.Code(err)
+
+	fields := []interface{}{
+		"request_id", id,
+		"method", method,
+		"code", code.String(),
+		"duration_ms", time.Since(start),
+	}
+
+	level := LevelInfo
+	if err != nil {
+		fields = append(fields, "error", err)
+		if isServerFailure(err) {
+			level = LevelError
+		}
+	}
+
+	Default().log(level, "grpc request", fields)
+}
+
+// Codes that indicate the server failed, rather than the client asking for something it can't have
+func isServerFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented, codes.Internal, codes.Unavailable, codes.DataLoss:
+		return true
+	}
+	return false
+}
+
+// Streams handed to handlers carry the request id in their context
+type requestIDStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *requestIDStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,227 @@
+// Package logging writes structured logs as lines of JSON, with levels and fields, so that
+// logs from the gateway and services can be searched and correlated by request id.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses a level by name, such as info.
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, expected one of %s", name, strings.Join(levelNames, ", "))
+}
+
+// Logger writes entries at or above its level as JSON lines, each with the time, level,
+// message and fields. Fields are given as alternating keys and values.
+type Logger struct {
+	out    *output
+	level  Level
+	fields []interface{}
+}
+
+// Loggers derived with With share their output, so that lines are never interleaved
+type output struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+// New creates a logger writing entries at or above a level.
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{out: &output{w: w, now: time.Now}, level: level}
+}
+
+// With returns a logger adding fields to every entry.
+func (l *Logger) With(fields ...interface{}) *Logger {
+	return &Logger{
+		out:    l.out,
+		level:  l.level,
+		fields: append(append([]interface{}(nil), l.fields...), fields...),
+	}
+}
+
+// Enabled reports whether entries at a level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+// Debug logs details useful when diagnosing problems.
+func (l *Logger) Debug(msg string, fields ...interface{}) {
+	l.log(LevelDebug, msg, fields)
+}
+
+// Info logs normal operation.
+func (l *Logger) Info(msg string, fields ...interface{}) {
+	l.log(LevelInfo, msg, fields)
+}
+
+// Warn logs problems that were recovered from.
+func (l *Logger) Warn(msg string, fields ...interface{}) {
+	l.log(LevelWarn, msg, fields)
+}
+
+// Error logs failures.
+func (l *Logger) Error(msg string, fields ...interface{}) {
+	l.log(LevelError, msg, fields)
+}
+
+func (l *Logger) log(level Level, msg string, fields []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	var line bytes.Buffer
+	line.WriteString(`{"time":`)
+	writeValue(&line, l.out.now().UTC().Format(time.RFC3339Nano))
+	line.WriteString(`,"level":`)
+	writeValue(&line, level.String())
+	line.WriteString(`,"msg":`)
+	writeValue(&line, msg)
+	writeFields(&line, l.fields)
+	writeFields(&line, fields)
+	line.WriteString("}\n")
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+
+	_, _ = l.out.w.Write(line.Bytes())
+}
+
+// Write fields in the order given, with a trailing key without a value logged as missing
+func writeFields(line *bytes.Buffer, fields []interface{}) {
+	for i := 0; i < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+
+		var value interface{} = "<missing>"
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+
+		line.WriteByte(',')
+		writeValue(line, key)
+		line.WriteByte(':')
+		writeValue(line, value)
+	}
+}
+
+func writeValue(line *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		//Durations are logged in milliseconds, which is easier to query than Go's duration strings
+		value = float64(v) / float64(time.Millisecond)
+	case fmt.Stringer:
+		value = v.String()
+	}
+
+	//Values are encoded without escaping HTML, which makes messages like <missing> unreadable
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		encoded.Reset()
+		_ = encoder.Encode(fmt.Sprint(value))
+	}
+	line.Write(bytes.TrimRight(encoded.Bytes(), "\n"))
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultLogger = New(os.Stderr, LevelInfo)
+)
+
+// Default returns the logger used by the package level functions.
+func Default() *Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+
+	return defaultLogger
+}
+
+// SetDefault sets the logger used by the package level functions.
+func SetDefault(l *Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultLogger = l
+}
+
+// Configure sets the default logger to write to stderr at a level given by name, and
+// routes the standard library logger through it, so that logs from dependencies are JSON too.
+func Configure(level string) error {
+	parsed, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	logger := New(os.Stderr, parsed)
+	SetDefault(logger)
+
+	log.SetFlags(0)
+	log.SetOutput(&stdWriter{logger: logger})
+
+	return nil
+}
+
+// Each line written by the standard library logger is logged as an info message
+type stdWriter struct {
+	logger *Logger
+}
+
+func (w *stdWriter) Write(p []byte) (int, error) {
+	w.logger.Info(strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
+
+// Debug logs to the default logger.
+func Debug(msg string, fields ...interface{}) {
+	Default().log(LevelDebug, msg, fields)
+}
+
+// Info logs to the default logger.
+func Info(msg string, fields ...interface{}) {
+	Default().log(LevelInfo, msg, fields)
+}
+
+// Warn logs to the default logger.
+func Warn(msg string, fields ...interface{}) {
+	Default().log(LevelWarn, msg, fields)
+}
+
+// Error logs to the default logger.
+func Error(msg string, fields ...interface{}) {
+	Default().log(LevelError, msg, fields)
+}
@@ -0,0 +1,193 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Sets the default logger to write to a buffer for the duration of a test
+func newTestLogger(t *testing.T, level Level) *bytes.Buffer {
+	var out bytes.Buffer
+	logger := New(&out, level)
+	logger.out.now = func() time.Time { return time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC) }
+
+	previous := Default()
+	SetDefault(logger)
+	t.Cleanup(func() { SetDefault(previous) })
+
+	return &out
+}
+
+func decodeLines(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Expected a JSON line, got %s: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Tests entries are written as JSON lines with their fields in order, below the level dropped
+func TestLogger(t *testing.T) {
+	out := newTestLogger(t, LevelInfo)
+
+	Debug("dropped")
+	Default().With("service", "racing").Warn("failed checking", "error", errors.New("database is locked"), "took", 1500*time.Microsecond, "dangling")
+
+	expected := `{"time":"2021-02-03T04:05:06Z","level":"warn","msg":"failed checking","service":"racing","error":"database is locked","took":1.5,"dangling":"<missing>"}` + "\n"
+	if out.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, out.String())
+	}
+}
+
+// Tests levels are parsed by name
+func TestParseLevel(t *testing.T) {
+	if level, err := ParseLevel("WARN"); err != nil || level != LevelWarn {
+		t.Errorf("Expected warn, got %v %v", level, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+}
+
+// Tests a request id is accepted at the gateway, forwarded to the server and logged by both
+func TestRequestIDPropagation(t *testing.T) {
+	out := newTestLogger(t, LevelInfo)
+
+	server := UnaryServerInterceptor()
+	client := UnaryClientInterceptor()
+
+	//The client's outgoing metadata is handed to the server as incoming metadata
+	var handled string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		ctx = metadata.NewIncomingContext(context.Background(), md)
+
+		_, err := server(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			handled = RequestIDFromContext(ctx)
+			return nil, status.Error(codes.NotFound, "race not found")
+		})
+		return err
+	}
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = client(r.Context(), "/racing.Racing/GetRace", nil, nil, nil, invoker)
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("{}"))
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/v1/races/7", nil)
+	request.Header.Set(RequestIDHeader, "abc-123")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Header().Get(RequestIDHeader) != "abc-123" || handled != "abc-123" {
+		t.Fatalf("Expected the caller's request id to be returned and forwarded, got %q and %q", response.Header().Get(RequestIDHeader), handled)
+	}
+
+	entries := decodeLines(t, out)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 access logs, got %d", len(entries))
+	}
+
+	//The server finishes first
+	rpc, access := entries[0], entries[1]
+	if rpc["msg"] != "grpc request" || rpc["request_id"] != "abc-123" || rpc["method"] != "/racing.Racing/GetRace" || rpc["code"] != "NotFound" || rpc["level"] != "info" {
+		t.Errorf("Unexpected gRPC access log %v", rpc)
+	}
+	if access["msg"] != "http request" || access["request_id"] != "abc-123" || access["path"] != "/v1/races/7" || access["status"] != float64(404) || access["bytes"] != float64(2) {
+		t.Errorf("Unexpected HTTP access log %v", access)
+	}
+	if _, ok := access["duration_ms"].(float64); !ok {
+		t.Errorf("Expected the latency in milliseconds, got %v", access["duration_ms"])
+	}
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// Tests the request id is forwarded when a stream is opened, and logged by the server
+func TestStreamRequestIDPropagation(t *testing.T) {
+	out := newTestLogger(t, LevelInfo)
+
+	server := StreamServerInterceptor()
+	client := StreamClientInterceptor()
+
+	//The client's outgoing metadata is handed to the server as incoming metadata
+	var handled string
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		stream := &testServerStream{ctx: metadata.NewIncomingContext(context.Background(), md)}
+
+		err := server(nil, stream, &grpc.StreamServerInfo{FullMethod: method, IsServerStream: true}, func(srv interface{}, stream grpc.ServerStream) error {
+			handled = RequestIDFromContext(stream.Context())
+			return nil
+		})
+		return nil, err
+	}
+
+	ctx := ContextWithRequestID(context.Background(), "abc-123")
+	if _, err := client(ctx, &grpc.StreamDesc{ServerStreams: true}, nil, "/racing.Racing/WatchRaces", streamer); err != nil {
+		t.Fatal(err)
+	}
+
+	if handled != "abc-123" {
+		t.Fatalf("Expected the request id to be forwarded, got %q", handled)
+	}
+
+	entries := decodeLines(t, out)
+	if len(entries) != 1 || entries[0]["request_id"] != "abc-123" || entries[0]["method"] != "/racing.Racing/WatchRaces" {
+		t.Errorf("Unexpected gRPC access logs %v", entries)
+	}
+}
+
+// Tests request ids are generated for callers that don't send a valid one
+func TestRequestIDGenerated(t *testing.T) {
+	out := newTestLogger(t, LevelInfo)
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	for _, supplied := range []string{"", "has spaces", "new\nline", strings.Repeat("a", maxRequestIDLength+1)} {
+		request := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		request.Header.Set(RequestIDHeader, supplied)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		id := response.Header().Get(RequestIDHeader)
+		if len(id) != 32 || id == supplied {
+			t.Errorf("Expected a generated request id in place of %q, got %q", supplied, id)
+		}
+	}
+
+	for _, entry := range decodeLines(t, out) {
+		if entry["level"] != "error" {
+			t.Errorf("Expected server failures logged as errors, got %v", entry["level"])
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Types of gRPC methods, as labelled by grpc_type
+const (
+	unary        = "unary"
+	clientStream = "client_stream"
+	serverStream = "server_stream"
+	bidiStream   = "bidi_stream"
+)
+
+// Every code a request can be handled with, so that their series exist before they are seen
+var allCodes = []codes.Code{
+	codes.OK, codes.Canceled, codes.Unknown, codes.InvalidArgument, codes.DeadlineExceeded,
+	codes.NotFound, codes.AlreadyExists, codes.PermissionDenied, codes.ResourceExhausted,
+	codes.FailedPrecondition, codes.Aborted, codes.OutOfRange, codes.Unimplemented,
+	codes.Internal, codes.Unavailable, codes.DataLoss, codes.Unauthenticated,
+}
+
+// ServerMetrics records the requests handled by a gRPC server, with the names and labels of
+// go-grpc-prometheus so that dashboards and alerts written for it work unchanged.
+type ServerMetrics struct {
+	started  *prometheus.CounterVec
+	handled  *prometheus.CounterVec
+	received *prometheus.CounterVec
+	sent     *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewServerMetrics creates the gRPC server metrics, registering them with a registerer.
+func NewServerMetrics(registerer prometheus.Registerer) *ServerMetrics {
+	labels := []string{"grpc_type", "grpc_service", "grpc_method"}
+
+	m := &ServerMetrics{
+		started: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_started_total",
+			Help: "Total number of RPCs started on the server.",
+		}, labels),
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Total number of RPCs completed on the server, regardless of success or failure.",
+		}, append(labels, "grpc_code")),
+		received: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_msg_received_total",
+			Help: "Total number of RPC stream messages received on the server.",
+		}, labels),
+		sent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_msg_sent_total",
+			Help: "Total number of gRPC stream messages sent by the server.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Histogram of response latency (seconds) of gRPC that had been application-level handled by the server.",
+			Buckets: DefaultBuckets,
+		}, labels),
+	}
+	registerer.MustRegister(m.started, m.handled, m.received, m.sent, m.duration)
+
+	return m
+}
+
+// InitializeMetrics creates the series of every method registered with a server, at zero, so
+// that methods which haven't been called yet are still reported.
+func (m *ServerMetrics) InitializeMetrics(server *grpc.Server) {
+	for service, info := range server.GetServiceInfo() {
+		for _, method := range info.Methods {
+			typ := methodType(method.IsClientStream, method.IsServerStream)
+
+			m.started.WithLabelValues(typ, service, method.Name)
+			m.received.WithLabelValues(typ, service, method.Name)
+			m.sent.WithLabelValues(typ, service, method.Name)
+			m.duration.WithLabelValues(typ, service, method.Name)
+			for _, code := range allCodes {
+				m.handled.WithLabelValues(typ, service, method.Name, code.String())
+			}
+		}
+	}
+}
+
+// UnaryServerInterceptor records unary requests.
+func (m *ServerMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		r := m.start(unary, info.FullMethod)
+		r.received()
+
+		resp, err := handler(ctx, req)
+		if err == nil {
+			r.sent()
+		}
+		r.finish(err)
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor records streaming requests, and the messages sent and received on
+// them, once the stream ends.
+func (m *ServerMetrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		r := m.start(methodType(info.IsClientStream, info.IsServerStream), info.FullMethod)
+
+		err := handler(srv, &monitoredStream{ServerStream: stream, request: r})
+		r.finish(err)
+
+		return err
+	}
+}
+
+// A request being handled, with the label values it is recorded by
+type request struct {
+	metrics *ServerMetrics
+	labels  []string
+	start   time.Time
+}
+
+func (m *ServerMetrics) start(typ string, fullMethod string) *request {
+	service, method := splitMethod(fullMethod)
+
+	r := &request{metrics: m, labels: []string{typ, service, method}, start: time.Now()}
+	m.started.WithLabelValues(r.labels...).Inc()
+
+	return r
+}
+
+func (r *request) received() {
+	r.metrics.received.WithLabelValues(r.labels...).Inc()
+}
+
+func (r *request) sent() {
+	r.metrics.sent.WithLabelValues(r.labels...).Inc()
+}
+
+func (r *request) finish(err error) {
+	r.metrics.handled.WithLabelValues(append(r.labels, status.Code(err).String())...).Inc()
+	r.metrics.duration.WithLabelValues(r.labels...).Observe(time.Since(r.start).Seconds())
+}
+
+// Streams count the messages sent and received on them
+type monitoredStream struct {
+	grpc.ServerStream
+	request *request
+}
+
+func (s *monitoredStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.request.sent()
+	}
+	return err
+}
+
+func (s *monitoredStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.request.received()
+	}
+	return err
+}
+
+func methodType(isClientStream bool, isServerStream bool) string {
+	switch {
+	case isClientStream && isServerStream:
+		return bidiStream
+	case isClientStream:
+		return clientStream
+	case isServerStream:
+		return serverStream
+	default:
+		return unary
+	}
+}
+
+// Split a full method name of the form /package.Service/Method
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
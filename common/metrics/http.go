@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.neds.sh/matty/entain/common/httputil"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HTTPMetrics records the requests served by an HTTP server, by method, route and status code.
+type HTTPMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewHTTPMetrics creates the HTTP server metrics, registering them with a registerer.
+func NewHTTPMetrics(registerer prometheus.Registerer) *HTTPMetrics {
+	m := &HTTPMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Requests served over HTTP, by method, route and status code.",
+		}, []string{"method", "route", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Time taken serving requests over HTTP, by method, route and status code.",
+			Buckets: DefaultBuckets,
+		}, []string{"method", "route", "code"}),
+	}
+	registerer.MustRegister(m.requests, m.duration)
+
+	return m
+}
+
+// Middleware records the requests served by the next handler.
+func (m *HTTPMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := httputil.NewResponseRecorder(w)
+
+		next.ServeHTTP(recorder, r)
+
+		route := Route(r.URL.Path)
+		code := strconv.Itoa(recorder.Status)
+
+		m.requests.WithLabelValues(r.Method, route, code).Inc()
+		m.duration.WithLabelValues(r.Method, route, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Route returns the route a path was requested through, with numeric ids replaced by {id},
+// so that requests for different resources are recorded together.
+func Route(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if _, err := strconv.ParseInt(segment, 10, 64); err == nil {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
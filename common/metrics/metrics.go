@@ -0,0 +1,44 @@
+// Package metrics records request metrics with the Prometheus client, and serves them for
+// scraping.
+package metrics
+
+import (
+	"net"
+	"net/http"
+
+	"git.neds.sh/matty/entain/common/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultBuckets are histogram bucket upper bounds suited to request latencies in seconds.
+var DefaultBuckets = prometheus.DefBuckets
+
+// Handler serves the metrics registered with the default registerer, in the text exposition
+// format or OpenMetrics, as the scraper accepts.
+func Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+}
+
+// Serve serves the metrics registered with the default registerer at /metrics on an endpoint
+// in the background, returning an error straight away if the endpoint can't be listened on.
+func Serve(endpoint string) error {
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logging.Error("failed serving metrics", "error", err)
+		}
+	}()
+
+	logging.Info("metrics server listening", "endpoint", endpoint)
+
+	return nil
+}
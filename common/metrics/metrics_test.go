@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func expectValue(t *testing.T, collector prometheus.Collector, expected float64, name string) {
+	if value := testutil.ToFloat64(collector); value != expected {
+		t.Errorf("Expected %s to be %v, got %v", name, expected, value)
+	}
+}
+
+// Tests unary gRPC requests are recorded by method and code
+func TestServerMetrics(t *testing.T) {
+	m := NewServerMetrics(prometheus.NewRegistry())
+	interceptor := m.UnaryServerInterceptor()
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/racing.Racing/GetRace"}
+	for _, err := range []error{nil, nil, status.Error(codes.NotFound, "race not found"), errors.New("failed")} {
+		_, _ = interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, err
+		})
+	}
+
+	expectValue(t, m.started.WithLabelValues("unary", "racing.Racing", "GetRace"), 4, "started")
+	expectValue(t, m.handled.WithLabelValues("unary", "racing.Racing", "GetRace", "OK"), 2, "handled OK")
+	expectValue(t, m.handled.WithLabelValues("unary", "racing.Racing", "GetRace", "NotFound"), 1, "handled NotFound")
+	expectValue(t, m.handled.WithLabelValues("unary", "racing.Racing", "GetRace", "Unknown"), 1, "handled Unknown")
+	expectValue(t, m.received.WithLabelValues("unary", "racing.Racing", "GetRace"), 4, "received")
+	expectValue(t, m.sent.WithLabelValues("unary", "racing.Racing", "GetRace"), 2, "sent")
+
+	if count := testutil.CollectAndCount(m.duration); count != 1 {
+		t.Errorf("Expected 1 handling time series, got %d", count)
+	}
+}
+
+type fakeStream struct {
+	grpc.ServerStream
+}
+
+func (s *fakeStream) SendMsg(m interface{}) error {
+	return nil
+}
+
+// Tests the messages sent on a server stream are counted
+func TestServerMetricsStream(t *testing.T) {
+	m := NewServerMetrics(prometheus.NewRegistry())
+	interceptor := m.StreamServerInterceptor()
+
+	info := &grpc.StreamServerInfo{FullMethod: "/racing.Racing/WatchRaces", IsServerStream: true}
+	err := interceptor(nil, &fakeStream{}, info, func(srv interface{}, stream grpc.ServerStream) error {
+		for i := 0; i < 3; i++ {
+			if err := stream.SendMsg(nil); err != nil {
+				return err
+			}
+		}
+		return status.Error(codes.Canceled, "client went away")
+	})
+	if status.Code(err) != codes.Canceled {
+		t.Fatalf("Expected the handler's error, got %v", err)
+	}
+
+	expectValue(t, m.started.WithLabelValues("server_stream", "racing.Racing", "WatchRaces"), 1, "started")
+	expectValue(t, m.sent.WithLabelValues("server_stream", "racing.Racing", "WatchRaces"), 3, "sent")
+	expectValue(t, m.handled.WithLabelValues("server_stream", "racing.Racing", "WatchRaces", "Canceled"), 1, "handled Canceled")
+}
+
+// Tests HTTP requests are recorded by route, with ids grouped together
+func TestHTTPMetrics(t *testing.T) {
+	m := NewHTTPMetrics(prometheus.NewRegistry())
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/404") {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		_, _ = w.Write([]byte("{}"))
+	}))
+
+	for _, path := range []string{"/v1/race/1", "/v1/race/2", "/v1/race/404"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	expectValue(t, m.requests.WithLabelValues("GET", "/v1/race/{id}", "200"), 2, "200 requests")
+	expectValue(t, m.requests.WithLabelValues("GET", "/v1/race/{id}", "404"), 1, "404 requests")
+}
+
+// Tests metrics are served in OpenMetrics to scrapers that accept it
+func TestHandler(t *testing.T) {
+	for accept, contentType := range map[string]string{
+		"": "text/plain",
+		"application/openmetrics-text; version=0.0.1": "application/openmetrics-text",
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		request.Header.Set("Accept", accept)
+		recorder := httptest.NewRecorder()
+
+		Handler().ServeHTTP(recorder, request)
+
+		if !strings.HasPrefix(recorder.Header().Get("Content-Type"), contentType) {
+			t.Errorf("Expected content type %s accepting %q, got %s", contentType, accept, recorder.Header().Get("Content-Type"))
+		}
+	}
+}
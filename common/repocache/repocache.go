@@ -0,0 +1,169 @@
+// Package repocache is a read-through cache for the repositories of the services, holding the
+// most recently used results for a TTL, and loading each missing result once no matter how
+// many requests for it arrive together.
+package repocache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LoadTimeout is how long a load is given to finish, as it no longer ends when the requests
+// waiting on it are cancelled.
+const LoadTimeout = 30 * time.Second
+
+// Loader loads a result on a miss, returning when it must expire by if sooner than the TTL,
+// such as when a race in it closes, or the zero time.
+type Loader func(ctx context.Context) (value interface{}, expires time.Time, err error)
+
+// Cache holds up to a maximum number of results, evicting the least recently used.
+type Cache struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	maxEntries  int
+	recent      *list.List
+	entries     map[string]*list.Element
+	loading     map[string]*load
+	generation  uint64
+	loadTimeout time.Duration
+	now         func() time.Time
+}
+
+type entry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// A load in progress, which requests for the same key wait on
+type load struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// New creates a cache of up to a maximum number of results, each held for at most the TTL.
+func New(maxEntries int, ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:         ttl,
+		maxEntries:  maxEntries,
+		recent:      list.New(),
+		entries:     make(map[string]*list.Element),
+		loading:     make(map[string]*load),
+		loadTimeout: LoadTimeout,
+		now:         time.Now,
+	}
+}
+
+// Get returns the result cached under a key, loading it on a miss. Concurrent misses for the
+// same key share a single load, which carries the values of the context of the request that
+// started it, such as its trace, but not its cancellation, so that a request going away doesn't
+// fail the others waiting on its load. Each request stops waiting when its own context is done.
+// Errors are returned to every waiting caller but not cached.
+func (c *Cache) Get(ctx context.Context, key string, loader Loader) (interface{}, error) {
+	c.mu.Lock()
+
+	if element, ok := c.entries[key]; ok {
+		e := element.Value.(*entry)
+		if c.now().Before(e.expires) {
+			c.recent.MoveToFront(element)
+			c.mu.Unlock()
+			return e.value, nil
+		}
+		c.remove(element)
+	}
+
+	l, ok := c.loading[key]
+	if !ok {
+		l = &load{done: make(chan struct{})}
+		c.loading[key] = l
+		go c.load(detached{ctx}, key, l, loader, c.generation)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return l.value, l.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Cache) load(ctx context.Context, key string, l *load, loader Loader, generation uint64) {
+	ctx, cancel := context.WithTimeout(ctx, c.loadTimeout)
+	defer cancel()
+
+	var expires time.Time
+	l.value, expires, l.err = loader(ctx)
+
+	c.mu.Lock()
+	delete(c.loading, key)
+	//Results loaded across an invalidation may be stale, so they are returned but not kept
+	if l.err == nil && generation == c.generation {
+		c.add(key, l.value, expires)
+	}
+	c.mu.Unlock()
+
+	close(l.done)
+}
+
+// A context holding the values of another, but never cancelled and without its deadline
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (detached) Err() error {
+	return nil
+}
+
+// Invalidate drops the result cached under a key.
+func (c *Cache) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.generation++
+}
+
+// Purge drops every cached result.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.recent.Init()
+	c.entries = make(map[string]*list.Element)
+	c.generation++
+}
+
+func (c *Cache) add(key string, value interface{}, expires time.Time) {
+	now := c.now()
+	if deadline := now.Add(c.ttl); expires.IsZero() || expires.After(deadline) {
+		expires = deadline
+	}
+	if !expires.After(now) {
+		return
+	}
+
+	c.entries[key] = c.recent.PushFront(&entry{key: key, value: value, expires: expires})
+
+	for c.recent.Len() > c.maxEntries {
+		c.remove(c.recent.Back())
+	}
+}
+
+func (c *Cache) remove(element *list.Element) {
+	c.recent.Remove(element)
+	delete(c.entries, element.Value.(*entry).key)
+}
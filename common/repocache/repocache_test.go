@@ -0,0 +1,184 @@
+package repocache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestCache(maxEntries int, now *time.Time) *Cache {
+	c := New(maxEntries, time.Minute)
+	c.now = func() time.Time { return *now }
+	return c
+}
+
+// A loader counting its calls, returning its key
+func counting(calls *int32, value string, expires time.Time) Loader {
+	return func(ctx context.Context) (interface{}, time.Time, error) {
+		atomic.AddInt32(calls, 1)
+		return value, expires, nil
+	}
+}
+
+// Tests results are cached for the TTL, or until they must expire if sooner
+func TestExpiry(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(10, &now)
+
+	var calls int32
+	_, _ = c.Get(context.Background(), "races", counting(&calls, "races", time.Time{}))
+	_, _ = c.Get(context.Background(), "race 1", counting(&calls, "race 1", now.Add(10*time.Second)))
+
+	now = now.Add(10 * time.Second)
+	_, _ = c.Get(context.Background(), "races", counting(&calls, "races", time.Time{}))
+	_, _ = c.Get(context.Background(), "race 1", counting(&calls, "race 1", time.Time{}))
+	if calls != 3 {
+		t.Errorf("Expected only the result past its expiry to be reloaded, got %d loads", calls)
+	}
+
+	now = now.Add(time.Minute)
+	_, _ = c.Get(context.Background(), "races", counting(&calls, "races", time.Time{}))
+	if calls != 4 {
+		t.Errorf("Expected the result to be reloaded after the TTL, got %d loads", calls)
+	}
+}
+
+// Tests the least recently used result is evicted, and errors aren't cached
+func TestEviction(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(2, &now)
+
+	var calls int32
+	for _, key := range []string{"a", "b", "a", "c", "a", "b"} {
+		_, _ = c.Get(context.Background(), key, counting(&calls, key, time.Time{}))
+	}
+	if calls != 4 {
+		t.Errorf("Expected a, b, c and b again to be loaded, got %d loads", calls)
+	}
+
+	failed := func(ctx context.Context) (interface{}, time.Time, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, time.Time{}, errors.New("database is locked")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(context.Background(), "d", failed); err == nil {
+			t.Error("Expected the load error to be returned")
+		}
+	}
+	if calls != 6 {
+		t.Errorf("Expected errors not to be cached, got %d loads", calls)
+	}
+}
+
+// Tests concurrent misses share a load, and loads across an invalidation aren't kept
+func TestSingleflight(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(10, &now)
+
+	var calls int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, time.Time, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return "event 1", time.Time{}, nil
+	}
+
+	var wg, calling sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		calling.Add(1)
+		go func() {
+			defer wg.Done()
+			calling.Done()
+			if value, err := c.Get(context.Background(), "event 1", loader); err != nil || value != "event 1" {
+				t.Errorf("Unexpected result %v %v", value, err)
+			}
+		}()
+	}
+
+	<-started
+	calling.Wait()
+	time.Sleep(10 * time.Millisecond)
+
+	//The score is updated while the event is loading
+	c.Invalidate("event 1")
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected concurrent misses to share a load, got %d loads", calls)
+	}
+
+	_, _ = c.Get(context.Background(), "event 1", loader)
+	if calls != 2 {
+		t.Errorf("Expected the result loaded before the update not to be kept, got %d loads", calls)
+	}
+}
+
+type contextKey struct{}
+
+// Tests a load carries on for the requests waiting on it when the one that started it is
+// cancelled, keeping its context's values but not its cancellation
+func TestDetachedLoad(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(10, &now)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, time.Time, error) {
+		close(started)
+		<-release
+		if ctx.Err() != nil {
+			return nil, time.Time{}, ctx.Err()
+		}
+		return ctx.Value(contextKey{}), time.Time{}, nil
+	}
+
+	leader, cancel := context.WithCancel(context.WithValue(context.Background(), contextKey{}, "trace 1"))
+	leaderErr := make(chan error)
+	go func() {
+		_, err := c.Get(leader, "event 1", loader)
+		leaderErr <- err
+	}()
+	<-started
+
+	waiter := make(chan interface{})
+	go func() {
+		value, err := c.Get(context.Background(), "event 1", loader)
+		if err != nil {
+			t.Errorf("Expected the waiter not to fail, got %v", err)
+		}
+		waiter <- value
+	}()
+
+	cancel()
+	if err := <-leaderErr; err != context.Canceled {
+		t.Errorf("Expected the cancelled request to stop waiting, got %v", err)
+	}
+
+	close(release)
+	if value := <-waiter; value != "trace 1" {
+		t.Errorf("Expected the load to keep its context's values, got %v", value)
+	}
+}
+
+// Tests loads are given their own timeout
+func TestLoadTimeout(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(10, &now)
+	c.loadTimeout = 10 * time.Millisecond
+
+	_, err := c.Get(context.Background(), "event 1", func(ctx context.Context) (interface{}, time.Time, error) {
+		<-ctx.Done()
+		return nil, time.Time{}, ctx.Err()
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected the load to time out, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+// Package sqlquery runs the repositories' database queries, timing them for metrics and
+// tracing them as part of the requests that made them.
+package sqlquery
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"git.neds.sh/matty/entain/common/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Queries are traced with the global tracer provider, so that they are recorded once tracing
+// is configured
+var tracer = otel.Tracer("git.neds.sh/matty/entain/common/sqlquery")
+
+// Queries runs queries, recording them by name.
+type Queries struct {
+	duration *prometheus.HistogramVec
+}
+
+// NewQueries creates the database query metrics, registering them with a registerer.
+func NewQueries(registerer prometheus.Registerer) *Queries {
+	q := &Queries{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "db_query_duration_seconds",
+			Help:    "Time taken running database queries and reading their rows, by query and outcome.",
+			Buckets: metrics.DefaultBuckets,
+		}, []string{"query", "outcome"}),
+	}
+	registerer.MustRegister(q.duration)
+
+	return q
+}
+
+// Query runs a query returning rows. Rows are read as they are iterated, so the query is
+// recorded until the returned function is called once they have been read, which closes them.
+func (q *Queries) Query(ctx context.Context, db *sql.DB, name string, query string, args ...interface{}) (*sql.Rows, func(), error) {
+	ctx, finish := q.start(ctx, name, query)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		finish(err)
+		return nil, nil, err
+	}
+
+	return rows, func() {
+		closeErr := rows.Close()
+		if err := rows.Err(); err != nil {
+			closeErr = err
+		}
+		finish(closeErr)
+	}, nil
+}
+
+// Exec prepares and runs a statement.
+func (q *Queries) Exec(ctx context.Context, db *sql.DB, name string, statement string, args ...interface{}) error {
+	ctx, finish := q.start(ctx, name, statement)
+
+	prepared, err := db.PrepareContext(ctx, statement)
+	if err == nil {
+		_, err = prepared.ExecContext(ctx, args...)
+		prepared.Close()
+	}
+
+	finish(err)
+
+	return err
+}
+
+// Start a span for a query, returning a function that records how it went once it is finished
+func (q *Queries) start(ctx context.Context, name string, query string) (context.Context, func(error)) {
+	start := time.Now()
+
+	ctx, span := tracer.Start(ctx, "db "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemSqlite,
+			semconv.DBOperationKey.String(name),
+			semconv.DBStatementKey.String(query),
+		),
+	)
+
+	return ctx, func(err error) {
+		outcome := "success"
+		if err != nil {
+			outcome = "error"
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		q.duration.WithLabelValues(name, outcome).Observe(time.Since(start).Seconds())
+		span.End()
+	}
+}
@@ -0,0 +1,338 @@
+// Package tlsconfig builds TLS configuration for the gRPC links between the gateway and the
+// services from PEM files, reloading certificates and CA bundles when their files change.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"git.neds.sh/matty/entain/common/logging"
+	"google.golang.org/grpc/credentials"
+)
+
+// Files are checked for changes at most this often, rather than on every handshake
+var checkInterval = time.Second
+
+// Files are the PEM files TLS is configured from.
+type Files struct {
+	// CertFile and KeyFile hold the certificate presented to peers and its private key.
+	CertFile string
+	KeyFile  string
+	// CAFile holds the certificate authorities peers are verified against.
+	CAFile string
+}
+
+// ServerConfig returns TLS configuration for a server presenting the certificate in files.
+// When the CA file is set, clients must present a certificate it issued, for mutual TLS.
+func ServerConfig(files Files) (*tls.Config, error) {
+	if len(files.CertFile) == 0 || len(files.KeyFile) == 0 {
+		return nil, errors.New("a certificate and key are required to serve TLS")
+	}
+
+	keyPair, err := newKeyPair(files.CertFile, files.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return keyPair.certificate()
+		},
+	}
+
+	if len(files.CAFile) == 0 {
+		return config, nil
+	}
+
+	authorities, err := newPool(files.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	//Each handshake is configured with the current client CAs, so that they can be rotated
+	mutual := config.Clone()
+	mutual.ClientAuth = tls.RequireAndVerifyClientCert
+	mutual.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		pool, err := authorities.pool()
+		if err != nil {
+			return nil, err
+		}
+
+		handshake := config.Clone()
+		handshake.ClientAuth = tls.RequireAndVerifyClientCert
+		handshake.ClientCAs = pool
+		return handshake, nil
+	}
+
+	return mutual, nil
+}
+
+// ClientConfig returns TLS configuration for dialling servers, verified against the CA file
+// or the system roots when it is not set. The certificate in files is presented to servers
+// that ask for one when it is set, for mutual TLS. The server name overrides the name
+// servers are verified against, which is otherwise the host dialled. Hosts that are IP
+// addresses aren't sent to servers, so they can only be verified without a server name by
+// dialling with ClientCredentials.
+func ClientConfig(files Files, serverName string) (*tls.Config, error) {
+	config, verify, err := clientConfig(files, serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	if verify != nil {
+		config.VerifyConnection = verify(serverName)
+	}
+	return config, nil
+}
+
+// ClientCredentials returns gRPC transport credentials dialling servers with the
+// configuration of ClientConfig, verifying them against the host dialled, including IP
+// addresses, when the server name is not set.
+func ClientCredentials(files Files, serverName string) (credentials.TransportCredentials, error) {
+	config, verify, err := clientConfig(files, serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	if verify != nil {
+		config.VerifyConnection = verify(serverName)
+	}
+	return &clientCredentials{TransportCredentials: credentials.NewTLS(config), config: config, verify: verify}, nil
+}
+
+// Build the configuration for dialling servers, with a function verifying servers against a
+// name when they are verified against the CA file rather than by the standard verification
+func clientConfig(files Files, serverName string) (*tls.Config, func(name string) func(tls.ConnectionState) error, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+	}
+
+	if len(files.CertFile) > 0 || len(files.KeyFile) > 0 {
+		keyPair, err := newKeyPair(files.CertFile, files.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return keyPair.certificate()
+		}
+	}
+
+	if len(files.CAFile) == 0 {
+		return config, nil, nil
+	}
+
+	authorities, err := newPool(files.CAFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	//The standard verification only supports a fixed set of roots, so servers are verified
+	//here instead against the current CAs, so that they can be rotated
+	config.InsecureSkipVerify = true
+	verify := func(name string) func(tls.ConnectionState) error {
+		return func(state tls.ConnectionState) error {
+			pool, err := authorities.pool()
+			if err != nil {
+				return err
+			}
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("server presented no certificate")
+			}
+
+			//The name sent to the server is empty when the host is an IP address, which
+			//would verify any certificate the CA issued
+			dnsName := name
+			if len(dnsName) == 0 {
+				dnsName = state.ServerName
+			}
+			if len(dnsName) == 0 {
+				return errors.New("no server name to verify the server's certificate against")
+			}
+
+			options := x509.VerifyOptions{
+				Roots:         pool,
+				DNSName:       dnsName,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, intermediate := range state.PeerCertificates[1:] {
+				options.Intermediates.AddCert(intermediate)
+			}
+
+			_, err = state.PeerCertificates[0].Verify(options)
+			return err
+		}
+	}
+
+	return config, verify, nil
+}
+
+// Credentials verifying servers against the host of the authority dialled when there is no
+// server name, which the standard credentials only pass to the handshake in the configuration
+type clientCredentials struct {
+	credentials.TransportCredentials
+	config *tls.Config
+	verify func(name string) func(tls.ConnectionState) error
+}
+
+func (c *clientCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	if c.verify == nil || len(c.config.ServerName) > 0 {
+		return c.TransportCredentials.ClientHandshake(ctx, authority, conn)
+	}
+
+	host, _, err := net.SplitHostPort(authority)
+	if err != nil {
+		host = authority
+	}
+
+	config := c.config.Clone()
+	config.ServerName = host
+	config.VerifyConnection = c.verify(host)
+	return credentials.NewTLS(config).ClientHandshake(ctx, authority, conn)
+}
+
+func (c *clientCredentials) Clone() credentials.TransportCredentials {
+	return &clientCredentials{TransportCredentials: c.TransportCredentials.Clone(), config: c.config.Clone(), verify: c.verify}
+}
+
+// A value loaded from files, reloaded when any of their modification times change. Failed
+// reloads are logged and the last good value kept, as files that are being replaced may be
+// briefly inconsistent, such as a new certificate alongside its old key.
+type watched struct {
+	paths []string
+	load  func() (interface{}, error)
+
+	mu       sync.Mutex
+	value    interface{}
+	modTimes []time.Time
+	checked  time.Time
+}
+
+func newWatched(load func() (interface{}, error), paths ...string) (*watched, error) {
+	w := &watched{paths: paths, load: load}
+
+	if _, err := w.get(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *watched) get() (interface{}, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	if w.value != nil && now.Sub(w.checked) < checkInterval {
+		return w.value, nil
+	}
+	w.checked = now
+
+	modTimes := make([]time.Time, len(w.paths))
+	changed := w.value == nil
+	for i, path := range w.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return w.fallback(err)
+		}
+		modTimes[i] = info.ModTime()
+		changed = changed || !modTimes[i].Equal(w.modTimes[i])
+	}
+
+	if !changed {
+		return w.value, nil
+	}
+
+	value, err := w.load()
+	if err != nil {
+		return w.fallback(err)
+	}
+
+	if w.value != nil {
+		logging.Info("reloaded TLS files", "paths", w.paths)
+	}
+	w.value, w.modTimes = value, modTimes
+
+	return value, nil
+}
+
+func (w *watched) fallback(err error) (interface{}, error) {
+	if w.value == nil {
+		return nil, err
+	}
+
+	logging.Warn("failed reloading TLS files, keeping previous", "paths", w.paths, "error", err)
+	return w.value, nil
+}
+
+type keyPair struct {
+	*watched
+}
+
+func newKeyPair(certFile string, keyFile string) (*keyPair, error) {
+	if len(certFile) == 0 || len(keyFile) == 0 {
+		return nil, errors.New("a certificate and key must be given together")
+	}
+
+	w, err := newWatched(func() (interface{}, error) {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading key pair %s: %w", certFile, err)
+		}
+		return &certificate, nil
+	}, certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &keyPair{w}, nil
+}
+
+func (k *keyPair) certificate() (*tls.Certificate, error) {
+	value, err := k.get()
+	if err != nil {
+		return nil, err
+	}
+	return value.(*tls.Certificate), nil
+}
+
+type pool struct {
+	*watched
+}
+
+func newPool(caFile string) (*pool, error) {
+	w, err := newWatched(func() (interface{}, error) {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		certificates := x509.NewCertPool()
+		if !certificates.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		return certificates, nil
+	}, caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pool{w}, nil
+}
+
+func (p *pool) pool() (*x509.CertPool, error) {
+	value, err := p.get()
+	if err != nil {
+		return nil, err
+	}
+	return value.(*x509.CertPool), nil
+}
@@ -0,0 +1,271 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.neds.sh/matty/entain/common/devca"
+	"google.golang.org/grpc/credentials"
+)
+
+// Write a certificate and key issued by an authority for localhost, returning their files
+func writeKeyPair(t *testing.T, dir string, authority *devca.Authority, name string, modified time.Time) Files {
+	return writeHostKeyPair(t, dir, authority, name, []string{"localhost", "127.0.0.1"}, modified)
+}
+
+// Write a certificate and key issued by an authority for hosts, returning their files
+func writeHostKeyPair(t *testing.T, dir string, authority *devca.Authority, name string, hosts []string, modified time.Time) Files {
+	certificate, key, err := authority.Issue(name, hosts, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := Files{CertFile: filepath.Join(dir, name+".pem"), KeyFile: filepath.Join(dir, name+"-key.pem")}
+	for path, data := range map[string][]byte{files.CertFile: certificate, files.KeyFile: key} {
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return files
+}
+
+func writeCA(t *testing.T, dir string, authority *devca.Authority) string {
+	path := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(path, authority.CertificatePEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newAuthority(t *testing.T) *devca.Authority {
+	authority, err := devca.NewAuthority("Test CA", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authority
+}
+
+// Run a handshake between a client and server over a loopback connection, returning the
+// name on the server's certificate as seen by the client
+func handshake(t *testing.T, serverConfig *tls.Config, clientConfig *tls.Config) (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		server := tls.Server(conn, serverConfig)
+		serverErr <- server.Handshake()
+		server.Close()
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := tls.Client(conn, clientConfig)
+	defer client.Close()
+
+	clientErr := client.Handshake()
+	if clientErr != nil {
+		//Closing unblocks a server still waiting on a client that gave up
+		client.Close()
+	}
+	if err := <-serverErr; err != nil {
+		return "", err
+	}
+	if clientErr != nil {
+		return "", clientErr
+	}
+
+	return client.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+}
+
+// Run a handshake between a gRPC client dialling the loopback address by IP and a server,
+// returning the client's error
+func credentialsHandshake(t *testing.T, serverConfig *tls.Config, clientCredentials credentials.TransportCredentials) error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	serverDone := make(chan struct{})
+	go func() {
+		defer close(serverDone)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		server := tls.Server(conn, serverConfig)
+		_ = server.Handshake()
+		server.Close()
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, _, err := clientCredentials.ClientHandshake(context.Background(), listener.Addr().String(), conn)
+	if client != nil {
+		client.Close()
+	}
+	conn.Close()
+	<-serverDone
+
+	return err
+}
+
+// Tests mutual TLS only admits clients presenting a certificate from the CA
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	authority := newAuthority(t)
+	caFile := writeCA(t, dir, authority)
+
+	serverFiles := writeKeyPair(t, dir, authority, "sports", time.Now())
+	serverFiles.CAFile = caFile
+	serverConfig, err := ServerConfig(serverFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientFiles := writeKeyPair(t, dir, authority, "api", time.Now())
+	clientFiles.CAFile = caFile
+	clientConfig, err := ClientConfig(clientFiles, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name, err := handshake(t, serverConfig, clientConfig); err != nil || name != "sports" {
+		t.Errorf("Expected handshake with sports, got %q %v", name, err)
+	}
+
+	anonymousConfig, err := ClientConfig(Files{CAFile: caFile}, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handshake(t, serverConfig, anonymousConfig); err == nil {
+		t.Error("Expected client without a certificate to be rejected")
+	}
+
+	untrustedConfig, err := ClientConfig(Files{CAFile: writeCA(t, t.TempDir(), newAuthority(t))}, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handshake(t, serverConfig, untrustedConfig); err == nil {
+		t.Error("Expected server certificate from another CA to be rejected")
+	}
+
+	wrongNameConfig, err := ClientConfig(clientFiles, "racing.internal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handshake(t, serverConfig, wrongNameConfig); err == nil {
+		t.Error("Expected server certificate for another name to be rejected")
+	}
+}
+
+// Tests servers dialled by IP address are verified against it, which isn't sent to them as
+// the server name
+func TestIPAddress(t *testing.T) {
+	dir := t.TempDir()
+	authority := newAuthority(t)
+	caFile := writeCA(t, dir, authority)
+
+	hostConfig, err := ServerConfig(writeHostKeyPair(t, dir, authority, "sports", []string{"localhost"}, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipConfig, err := ServerConfig(writeHostKeyPair(t, dir, authority, "racing", []string{"127.0.0.1"}, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientCredentials, err := ClientCredentials(Files{CAFile: caFile}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := credentialsHandshake(t, hostConfig, clientCredentials); err == nil {
+		t.Error("Expected server certificate without the IP address to be rejected")
+	}
+	if err := credentialsHandshake(t, ipConfig, clientCredentials); err != nil {
+		t.Errorf("Expected server certificate for the IP address to be accepted, got %v", err)
+	}
+
+	ipNameConfig, err := ClientConfig(Files{CAFile: caFile}, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handshake(t, hostConfig, ipNameConfig); err == nil {
+		t.Error("Expected server certificate without the IP address named to be rejected")
+	}
+
+	namelessConfig, err := ClientConfig(Files{CAFile: caFile}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handshake(t, ipConfig, namelessConfig); err == nil {
+		t.Error("Expected server certificate to be rejected without a name to verify it against")
+	}
+}
+
+// Tests a replaced certificate is served without recreating the configuration
+func TestReload(t *testing.T) {
+	checkInterval = 0
+	defer func() { checkInterval = time.Second }()
+
+	dir := t.TempDir()
+	authority := newAuthority(t)
+	caFile := writeCA(t, dir, authority)
+
+	serverFiles := writeKeyPair(t, dir, authority, "sports", time.Now().Add(-time.Hour))
+	serverConfig, err := ServerConfig(serverFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientConfig, err := ClientConfig(Files{CAFile: caFile}, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//The new certificate is written over the old files under the same name
+	rotated := writeKeyPair(t, t.TempDir(), authority, "sports-rotated", time.Now())
+	for from, to := range map[string]string{rotated.CertFile: serverFiles.CertFile, rotated.KeyFile: serverFiles.KeyFile} {
+		if err := os.Rename(from, to); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if name, err := handshake(t, serverConfig, clientConfig); err != nil || name != "sports-rotated" {
+		t.Errorf("Expected rotated certificate to be served, got %q %v", name, err)
+	}
+
+	//A broken replacement is ignored in favour of the last good certificate
+	if err := ioutil.WriteFile(serverFiles.KeyFile, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(serverFiles.KeyFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if name, err := handshake(t, serverConfig, clientConfig); err != nil || name != "sports-rotated" {
+		t.Errorf("Expected last good certificate to be served, got %q %v", name, err)
+	}
+}
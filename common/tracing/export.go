@@ -0,0 +1,139 @@
+package tracing
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// NewOTLPExporter creates an exporter sending spans to an OTLP/HTTP receiver, such as an
+// OpenTelemetry collector, at its base URL.
+func NewOTLPExporter(endpoint string) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(u.Path, "/") + "/v1/traces"),
+	}
+	switch u.Scheme {
+	case "http":
+		options = append(options, otlptracehttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("OTLP endpoint %s must be an http or https URL", endpoint)
+	}
+
+	return otlptracehttp.New(context.Background(), options...)
+}
+
+// NewWriterExporter creates an exporter writing each batch of spans as a line of OTLP JSON,
+// for reading locally or replaying to a collector later.
+func NewWriterExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	return otlptrace.New(context.Background(), &writerClient{writer: w})
+}
+
+// NewFileExporter creates an exporter appending spans as lines of OTLP JSON to a file, or
+// writing them to stdout when the path is -.
+func NewFileExporter(path string) (sdktrace.SpanExporter, error) {
+	if path == "-" {
+		return NewWriterExporter(os.Stdout)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return otlptrace.New(context.Background(), &writerClient{writer: file, closer: file})
+}
+
+// The OTLP exporter transforms spans to their protobuf messages and uploads them with a client,
+// which here writes them as a line of the JSON encoding of an export request
+type writerClient struct {
+	mu     sync.Mutex
+	writer io.Writer
+	closer io.Closer
+}
+
+func (c *writerClient) Start(ctx context.Context) error {
+	return nil
+}
+
+func (c *writerClient) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closer == nil {
+		return nil
+	}
+	return c.closer.Close()
+}
+
+func (c *writerClient) UploadTraces(ctx context.Context, spans []*tracepb.ResourceSpans) error {
+	body, err := encodeJSON(&collectorpb.ExportTraceServiceRequest{ResourceSpans: spans})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err = c.writer.Write(append(body, '\n'))
+	return err
+}
+
+// Fields of the OTLP JSON encoding holding ids, which are hex encoded rather than base64 as
+// protojson encodes bytes
+var idFields = map[string]bool{"traceId": true, "spanId": true, "parentSpanId": true}
+
+// Encode an export request in the OTLP JSON encoding
+func encodeJSON(request *collectorpb.ExportTraceServiceRequest) ([]byte, error) {
+	body, err := protojson.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return nil, err
+	}
+	hexIDs(decoded)
+
+	return json.Marshal(decoded)
+}
+
+func hexIDs(value interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for field, nested := range value {
+			if s, ok := nested.(string); ok && idFields[field] {
+				if id, err := base64.StdEncoding.DecodeString(s); err == nil {
+					value[field] = hex.EncodeToString(id)
+				}
+				continue
+			}
+			hexIDs(nested)
+		}
+	case []interface{}:
+		for _, nested := range value {
+			hexIDs(nested)
+		}
+	}
+}
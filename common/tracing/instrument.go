@@ -0,0 +1,19 @@
+package tracing
+
+import (
+	"net/http"
+
+	"git.neds.sh/matty/entain/common/metrics"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Middleware traces the requests served by the next handler, continuing traces propagated by
+// callers in the traceparent header. Spans are named by method and route, with ids grouped
+// together as they are in metrics.
+func Middleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http",
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			return r.Method + " " + metrics.Route(r.URL.Path)
+		}),
+	)
+}
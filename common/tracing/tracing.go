@@ -0,0 +1,68 @@
+// Package tracing sets up OpenTelemetry tracing of requests as they pass from the gateway to
+// the services and their databases. Trace context is propagated between processes with the
+// W3C traceparent header, and spans exported with OTLP, so that traces can be collected by any
+// OpenTelemetry collector or written to a file.
+package tracing
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// Config selects where traces are exported, with tracing disabled when nothing is selected.
+type Config struct {
+	// Service is the name spans are recorded under.
+	Service string
+	// OTLPEndpoint is the base URL of an OTLP/HTTP receiver, such as http://localhost:4318.
+	OTLPEndpoint string
+	// File is a file spans are appended to as lines of OTLP JSON, or - for stdout.
+	File string
+	// SampleRatio is the ratio of traces started by the service that are sampled.
+	SampleRatio float64
+}
+
+// Configure sets the global tracer provider to export spans to where the config selects, and
+// the global propagator to W3C trace context. Traces propagated from a caller are sampled when
+// the caller's are. No provider is returned when tracing is disabled, although trace context
+// is still propagated.
+func Configure(config Config) (*sdktrace.TracerProvider, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var exporters []sdktrace.SpanExporter
+
+	if len(config.OTLPEndpoint) > 0 {
+		exporter, err := NewOTLPExporter(config.OTLPEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, exporter)
+	}
+
+	if len(config.File) > 0 {
+		exporter, err := NewFileExporter(config.File)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, exporter)
+	}
+
+	if len(exporters) == 0 {
+		return nil, nil
+	}
+
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(config.Service))),
+	}
+	for _, exporter := range exporters {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+
+	return provider, nil
+}
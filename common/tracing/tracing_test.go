@@ -0,0 +1,237 @@
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// Sets a global tracer provider recording spans, restoring the previous one after the test
+func newTestProvider(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	return recorder
+}
+
+// Serves the health service over an in-memory connection, with both ends traced
+func newTestConn(t *testing.T) *grpc.ClientConn {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(otelgrpc.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(otelgrpc.StreamServerInterceptor()),
+	)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(listener)
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+	})
+
+	return conn
+}
+
+// Find the client and server spans of a call
+func callSpans(t *testing.T, spans []sdktrace.ReadOnlySpan) (sdktrace.ReadOnlySpan, sdktrace.ReadOnlySpan) {
+	var clientSpan, serverSpan sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		switch span.SpanKind() {
+		case trace.SpanKindClient:
+			clientSpan = span
+		case trace.SpanKindServer:
+			if strings.HasPrefix(span.Name(), "grpc.") {
+				serverSpan = span
+			}
+		}
+	}
+	if clientSpan == nil || serverSpan == nil {
+		t.Fatalf("Expected client and server spans, got %d spans", len(spans))
+	}
+	return clientSpan, serverSpan
+}
+
+// Tests a request is traced from the gateway through a gRPC call to the server
+func TestPropagation(t *testing.T) {
+	recorder := newTestProvider(t)
+	client := healthpb.NewHealthClient(newTestConn(t))
+
+	//The health server doesn't know the service, so the call fails
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = client.Check(r.Context(), &healthpb.HealthCheckRequest{Service: "unknown"})
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	request := httptest.NewRequest(http.MethodPost, "/v1/event/12/score", nil)
+	request.Header.Set("traceparent", traceparent)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(spans))
+	}
+
+	//The HTTP span ends last
+	httpSpan := spans[2]
+	clientSpan, serverSpan := callSpans(t, spans)
+	if httpSpan.Name() != "POST /v1/event/{id}/score" || httpSpan.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected the HTTP span to continue the caller's trace, got %s with parent %s", httpSpan.Name(), httpSpan.Parent().SpanID())
+	}
+	if clientSpan.Parent().SpanID() != httpSpan.SpanContext().SpanID() || serverSpan.Parent().SpanID() != clientSpan.SpanContext().SpanID() {
+		t.Error("Expected each span to be the child of the one before")
+	}
+	if serverSpan.Status().Code != codes.Error || httpSpan.Status().Code != codes.Error {
+		t.Errorf("Expected failures to be recorded, got %v and %v", serverSpan.Status(), httpSpan.Status())
+	}
+}
+
+// Tests streams are traced from the client to the server
+func TestStreamPropagation(t *testing.T) {
+	recorder := newTestProvider(t)
+	client := healthpb.NewHealthClient(newTestConn(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	//Both spans end once the stream has ended at each end
+	for deadline := time.Now().Add(5 * time.Second); len(recorder.Ended()) < 2 && time.Now().Before(deadline); {
+		_, _ = stream.Recv()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	clientSpan, serverSpan := callSpans(t, recorder.Ended())
+	if serverSpan.Name() != "grpc.health.v1.Health/Watch" || serverSpan.Parent().SpanID() != clientSpan.SpanContext().SpanID() {
+		t.Errorf("Expected the server span %s to be the child of the client's", serverSpan.Name())
+	}
+}
+
+// Tests spans are written to files in the OTLP JSON encoding, sampling traces started by the
+// service by the ratio and those propagated from callers as theirs are
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+
+	provider, err := Configure(Config{Service: "racing", File: path, SampleRatio: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	tracer := otel.Tracer("test")
+	_, unsampled := tracer.Start(context.Background(), "unsampled")
+	unsampled.End()
+
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier{"traceparent": traceparent})
+	_, sampled := tracer.Start(ctx, "db races.list", trace.WithSpanKind(trace.SpanKindClient))
+	sampled.End()
+
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Count(string(written), "\n") != 1 {
+		t.Fatalf("Expected one line of spans, got %s", written)
+	}
+	for _, expected := range []string{
+		`"key":"service.name","value":{"stringValue":"racing"}`,
+		`"name":"db races.list"`,
+		`"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`,
+		`"parentSpanId":"00f067aa0ba902b7"`,
+	} {
+		if !strings.Contains(string(written), expected) {
+			t.Errorf("Expected %s in the OTLP JSON, got %s", expected, written)
+		}
+	}
+	if strings.Contains(string(written), "unsampled") {
+		t.Errorf("Expected only the propagated sampled span, got %s", written)
+	}
+}
+
+// Tests spans are sent to OTLP/HTTP receivers at their base URL
+func TestOTLPExporter(t *testing.T) {
+	var received collectorpb.ExportTraceServiceRequest
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/otlp/v1/traces" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		_ = proto.Unmarshal(body, &received)
+	}))
+	defer receiver.Close()
+
+	provider, err := Configure(Config{Service: "sports", OTLPEndpoint: receiver.URL + "/otlp/", SampleRatio: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	_, span := otel.Tracer("test").Start(context.Background(), "db events.list")
+	span.End()
+
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received.ResourceSpans) != 1 {
+		t.Errorf("Expected spans received, got %v", received.ResourceSpans)
+	}
+}
+
+// Tests endpoints that aren't HTTP URLs are rejected
+func TestOTLPExporterScheme(t *testing.T) {
+	if _, err := NewOTLPExporter("grpc://localhost:4317"); err == nil {
+		t.Error("Expected an error for a non-HTTP endpoint")
+	}
+}
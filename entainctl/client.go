@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"git.neds.sh/matty/entain/api/proto/racing"
+	"git.neds.sh/matty/entain/api/proto/sports"
+	"google.golang.org/grpc"
+)
+
+// Client calls the racing and sports services, through the gateway or directly over gRPC.
+type Client interface {
+	ListRaces(ctx context.Context, in *racing.ListRacesRequest) (*racing.ListRacesResponse, error)
+	GetRace(ctx context.Context, in *racing.GetRaceRequest) (*racing.GetRaceResponse, error)
+	// WatchRaces passes each update to receive until the stream ends, returning nil if it
+	// ended without an error.
+	WatchRaces(ctx context.Context, in *racing.WatchRacesRequest, receive func(*racing.WatchRacesResponse) error) error
+
+	ListEvents(ctx context.Context, in *sports.ListEventsRequest) (*sports.ListEventsResponse, error)
+	GetEvent(ctx context.Context, in *sports.GetEventRequest) (*sports.GetEventResponse, error)
+	// WatchEvents passes each update to receive until the stream ends, returning nil if it
+	// ended without an error.
+	WatchEvents(ctx context.Context, in *sports.WatchEventsRequest, receive func(*sports.WatchEventsResponse) error) error
+	UpdateScore(ctx context.Context, in *sports.UpdateScoreRequest) (*sports.UpdateScoreResponse, error)
+
+	Close() error
+}
+
+// grpcClient calls the services' gRPC endpoints directly, bypassing the gateway's
+// authentication, rate limiting and caching.
+type grpcClient struct {
+	racingConn *grpc.ClientConn
+	sportsConn *grpc.ClientConn
+	racing     racing.RacingClient
+	sports     sports.SportsClient
+}
+
+// NewGRPCClient dials the racing and sports services' gRPC endpoints.
+func NewGRPCClient(racingEndpoint string, sportsEndpoint string, opts ...grpc.DialOption) (Client, error) {
+	racingConn, err := grpc.Dial(racingEndpoint, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	sportsConn, err := grpc.Dial(sportsEndpoint, opts...)
+	if err != nil {
+		racingConn.Close()
+		return nil, err
+	}
+
+	return &grpcClient{
+		racingConn: racingConn,
+		sportsConn: sportsConn,
+		racing:     racing.NewRacingClient(racingConn),
+		sports:     sports.NewSportsClient(sportsConn),
+	}, nil
+}
+
+func (c *grpcClient) ListRaces(ctx context.Context, in *racing.ListRacesRequest) (*racing.ListRacesResponse, error) {
+	return c.racing.ListRaces(ctx, in)
+}
+
+func (c *grpcClient) GetRace(ctx context.Context, in *racing.GetRaceRequest) (*racing.GetRaceResponse, error) {
+	return c.racing.GetRace(ctx, in)
+}
+
+func (c *grpcClient) WatchRaces(ctx context.Context, in *racing.WatchRacesRequest, receive func(*racing.WatchRacesResponse) error) error {
+	stream, err := c.racing.WatchRaces(ctx, in)
+	if err != nil {
+		return err
+	}
+
+	for {
+		response, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := receive(response); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *grpcClient) ListEvents(ctx context.Context, in *sports.ListEventsRequest) (*sports.ListEventsResponse, error) {
+	return c.sports.ListEvents(ctx, in)
+}
+
+func (c *grpcClient) GetEvent(ctx context.Context, in *sports.GetEventRequest) (*sports.GetEventResponse, error) {
+	return c.sports.GetEvent(ctx, in)
+}
+
+func (c *grpcClient) WatchEvents(ctx context.Context, in *sports.WatchEventsRequest, receive func(*sports.WatchEventsResponse) error) error {
+	stream, err := c.sports.WatchEvents(ctx, in)
+	if err != nil {
+		return err
+	}
+
+	for {
+		response, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := receive(response); err != nil {
+			return err
+		}
+	}
+}
+
+// Scores are only recorded through the gateway, which authenticates the admin and forwards
+// their identity to the service over mutual TLS
+func (c *grpcClient) UpdateScore(ctx context.Context, in *sports.UpdateScoreRequest) (*sports.UpdateScoreResponse, error) {
+	return nil, errors.New("scores can only be recorded through the gateway, with --transport gateway")
+}
+
+func (c *grpcClient) Close() error {
+	c.sportsConn.Close()
+	return c.racingConn.Close()
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.neds.sh/matty/entain/api/proto/racing"
+	"git.neds.sh/matty/entain/api/proto/sports"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// How long a watch waits before resuming a stream that ended
+const resumeDelay = 3 * time.Second
+
+// errUsage is returned for invalid arguments, once the command's usage has been written.
+var errUsage = errors.New("invalid arguments")
+
+// Command is a subcommand, such as races list.
+type Command struct {
+	Name    string
+	Args    string
+	Summary string
+	// Watches stream until interrupted, so aren't given the timeout.
+	Watch bool
+	Run   func(ctx context.Context, client Client, printer *Printer, args []string) error
+}
+
+// Commands are listed in the order they are shown in the usage.
+var Commands = []*Command{
+	{Name: "races list", Summary: "List races", Run: listRaces},
+	{Name: "races get", Args: "<id>", Summary: "Get a race", Run: getRace},
+	{Name: "races watch", Summary: "Stream races as their status changes", Watch: true, Run: watchRaces},
+	{Name: "events list", Summary: "List sporting events", Run: listEvents},
+	{Name: "events get", Args: "<id>", Summary: "Get a sporting event", Run: getEvent},
+	{Name: "events watch", Summary: "Stream events as their status or score changes", Watch: true, Run: watchEvents},
+	{Name: "events score", Args: "<id>", Summary: "Record the live score of an event, as an admin", Run: updateScore},
+}
+
+// FindCommand returns the command named by the start of the arguments, and the arguments after
+// its name, or nil if there is none.
+func FindCommand(args []string) (*Command, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+
+	for _, command := range Commands {
+		if command.Name == args[0]+" "+args[1] {
+			return command, args[2:]
+		}
+	}
+	return nil, nil
+}
+
+func listRaces(ctx context.Context, client Client, printer *Printer, args []string) error {
+	var meetingIds ids
+	var visible optionalBool
+	var startFrom, startBefore timestamp
+	flags := newFlagSet("races list", "")
+	flags.Var(&meetingIds, "meeting-ids", "Only races of these meetings, comma separated or repeated")
+	flags.Var(&visible, "visible", "Only races that are visible, or not with --visible=false")
+	flags.Var(&startFrom, "start-from", "Only races starting at or after this time, in RFC 3339")
+	flags.Var(&startBefore, "start-before", "Only races starting before this time, in RFC 3339")
+	orderBy := flags.String("order-by", "", "Fields to order by, such as advertised_start_time desc")
+	pageSize := flags.Int("page-size", 0, "Most races listed, or every match if 0")
+	readMask := flags.String("read-mask", "", "Comma separated fields to return, such as id,name")
+	if err := parse(flags, args, 0); err != nil {
+		return err
+	}
+
+	request := &racing.ListRacesRequest{
+		Filter: &racing.ListRacesRequestFilter{
+			MeetingIds:  meetingIds,
+			Visible:     visible.value,
+			StartFrom:   startFrom.value,
+			StartBefore: startBefore.value,
+		},
+		OrderBy:  *orderBy,
+		PageSize: int32(*pageSize),
+		ReadMask: mask(*readMask),
+	}
+
+	response, err := client.ListRaces(ctx, request)
+	if err != nil {
+		return err
+	}
+	return printer.Races(response, response.Races)
+}
+
+func getRace(ctx context.Context, client Client, printer *Printer, args []string) error {
+	flags := newFlagSet("races get", "<id>")
+	readMask := flags.String("read-mask", "", "Comma separated fields to return, such as id,name")
+	if err := parse(flags, args, 1); err != nil {
+		return err
+	}
+
+	id, err := argId(flags)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.GetRace(ctx, &racing.GetRaceRequest{Id: id, ReadMask: mask(*readMask)})
+	if err != nil {
+		return err
+	}
+	//The services respond without a race rather than failing when there is none with the id
+	if response.Race == nil {
+		return status.Errorf(codes.NotFound, "race %d not found", id)
+	}
+	return printer.Races(response, []*racing.Race{response.Race})
+}
+
+func watchRaces(ctx context.Context, client Client, printer *Printer, args []string) error {
+	var meetingIds, raceIds ids
+	flags := newFlagSet("races watch", "")
+	flags.Var(&meetingIds, "meeting-ids", "Only races of these meetings, comma separated or repeated")
+	flags.Var(&raceIds, "race-ids", "Only these races, comma separated or repeated")
+	afterId := flags.Uint64("after-id", 0, "Id of the last update received, to resume after")
+	if err := parse(flags, args, 0); err != nil {
+		return err
+	}
+
+	filter := &racing.WatchRacesRequestFilter{MeetingIds: meetingIds, RaceIds: raceIds}
+	return resume(ctx, func() error {
+		return client.WatchRaces(ctx, &racing.WatchRacesRequest{Filter: filter, AfterId: *afterId}, func(update *racing.WatchRacesResponse) error {
+			if update.Id > 0 || update.Missed {
+				*afterId = update.Id
+			}
+			return printer.RaceUpdate(update)
+		})
+	})
+}
+
+func listEvents(ctx context.Context, client Client, printer *Printer, args []string) error {
+	var sportIds, teamIds, competitionIds, locationIds ids
+	var startFrom, startBefore timestamp
+	flags := newFlagSet("events list", "")
+	flags.Var(&sportIds, "sport-ids", "Only events of these sports, comma separated or repeated")
+	flags.Var(&teamIds, "team-ids", "Only events either of these teams play in, comma separated or repeated")
+	flags.Var(&competitionIds, "competition-ids", "Only events in these competitions, comma separated or repeated")
+	flags.Var(&locationIds, "location-ids", "Only events at these locations, comma separated or repeated")
+	minCapacity := flags.Int64("min-capacity", 0, "Only events at locations holding at least this many")
+	eventStatus := flags.String("status", "", "Only events with this status, OPEN, INPROGRESS or CLOSED")
+	query := flags.String("query", "", "Only events matching this full text search")
+	flags.Var(&startFrom, "start-from", "Only events starting at or after this time, in RFC 3339")
+	flags.Var(&startBefore, "start-before", "Only events starting before this time, in RFC 3339")
+	orderBy := flags.String("order-by", "", "Fields to order by, such as advertised_start_time desc")
+	pageSize := flags.Int("page-size", 0, "Most events listed, or every match if 0")
+	readMask := flags.String("read-mask", "", "Comma separated fields to return, such as id,home_team")
+	if err := parse(flags, args, 0); err != nil {
+		return err
+	}
+
+	request := &sports.ListEventsRequest{
+		Filter: &sports.ListEventsRequestFilter{
+			SportIds:       sportIds,
+			TeamIds:        teamIds,
+			CompetitionIds: competitionIds,
+			LocationIds:    locationIds,
+			MinCapacity:    *minCapacity,
+			Status:         *eventStatus,
+			Query:          *query,
+			StartFrom:      startFrom.value,
+			StartBefore:    startBefore.value,
+		},
+		OrderBy:  *orderBy,
+		PageSize: int32(*pageSize),
+		ReadMask: mask(*readMask),
+	}
+
+	response, err := client.ListEvents(ctx, request)
+	if err != nil {
+		return err
+	}
+	return printer.Events(response, response.Events)
+}
+
+func getEvent(ctx context.Context, client Client, printer *Printer, args []string) error {
+	flags := newFlagSet("events get", "<id>")
+	readMask := flags.String("read-mask", "", "Comma separated fields to return, such as id,home_team")
+	if err := parse(flags, args, 1); err != nil {
+		return err
+	}
+
+	id, err := argId(flags)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.GetEvent(ctx, &sports.GetEventRequest{Id: id, ReadMask: mask(*readMask)})
+	if err != nil {
+		return err
+	}
+	//The services respond without a event rather than failing when there is none with the id
+	if response.Event == nil {
+		return status.Errorf(codes.NotFound, "event %d not found", id)
+	}
+	return printer.Events(response, []*sports.Event{response.Event})
+}
+
+func watchEvents(ctx context.Context, client Client, printer *Printer, args []string) error {
+	var eventIds, sportIds, competitionIds, teamIds ids
+	var types list
+	flags := newFlagSet("events watch", "")
+	flags.Var(&eventIds, "event-ids", "Only these events, comma separated or repeated")
+	flags.Var(&sportIds, "sport-ids", "Only events of these sports, comma separated or repeated")
+	flags.Var(&competitionIds, "competition-ids", "Only events in these competitions, comma separated or repeated")
+	flags.Var(&teamIds, "team-ids", "Only events either of these teams play in, comma separated or repeated")
+	flags.Var(&types, "types", "Only changes of these types, STATUS or SCORE, comma separated or repeated")
+	afterId := flags.Uint64("after-id", 0, "Id of the last update received, to resume after")
+	if err := parse(flags, args, 0); err != nil {
+		return err
+	}
+
+	filter := &sports.WatchEventsRequestFilter{EventIds: eventIds, SportIds: sportIds, CompetitionIds: competitionIds, TeamIds: teamIds, Types: types}
+	return resume(ctx, func() error {
+		return client.WatchEvents(ctx, &sports.WatchEventsRequest{Filter: filter, AfterId: *afterId}, func(update *sports.WatchEventsResponse) error {
+			if update.Id > 0 || update.Missed {
+				*afterId = update.Id
+			}
+			return printer.EventUpdate(update)
+		})
+	})
+}
+
+func updateScore(ctx context.Context, client Client, printer *Printer, args []string) error {
+	flags := newFlagSet("events score", "<id>")
+	home := flags.Int64("home", 0, "Points scored by the home team")
+	away := flags.Int64("away", 0, "Points scored by the visiting team")
+	period := flags.Int64("period", 0, "Current period of play, such as the quarter, half or innings")
+	clock := flags.String("clock", "", "Game clock as displayed for the current period")
+	final := flags.Bool("final", false, "Whether the score is final")
+	if err := parse(flags, args, 1); err != nil {
+		return err
+	}
+
+	id, err := argId(flags)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.UpdateScore(ctx, &sports.UpdateScoreRequest{
+		EventId: id,
+		Score: &sports.Score{
+			HomeScore: *home,
+			AwayScore: *away,
+			Period:    *period,
+			Clock:     *clock,
+			Final:     *final,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return printer.Events(response, []*sports.Event{response.Event})
+}
+
+// Watches are resumed after the last update received when their stream ends, or fails in a way
+// reconnecting recovers from, such as the service restarting or the watch falling behind. They
+// end without an error once interrupted.
+func resume(ctx context.Context, watch func() error) error {
+	for {
+		err := watch()
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+			if code := status.Code(err); code != codes.Unavailable && code != codes.ResourceExhausted {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "entainctl: stream failed, resuming in %s: %s\n", resumeDelay, status.Convert(err).Message())
+		} else {
+			fmt.Fprintf(os.Stderr, "entainctl: stream ended, resuming in %s\n", resumeDelay)
+		}
+
+		select {
+		case <-time.After(resumeDelay):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func newFlagSet(name string, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: entainctl [global flags] %s [flags] %s\n\nFlags:\n", name, args)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// Parses the flags, which come before the command's positional arguments
+func parse(flags *flag.FlagSet, args []string, positional int) error {
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	if flags.NArg() != positional {
+		fmt.Fprintf(flags.Output(), "entainctl %s: expected %d arguments, got %d\n", flags.Name(), positional, flags.NArg())
+		flags.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func argId(flags *flag.FlagSet) (int64, error) {
+	id, err := strconv.ParseInt(flags.Arg(0), 10, 64)
+	if err != nil {
+		fmt.Fprintf(flags.Output(), "entainctl %s: invalid id %q\n", flags.Name(), flags.Arg(0))
+		return 0, errUsage
+	}
+	return id, nil
+}
+
+func mask(value string) *fieldmaskpb.FieldMask {
+	paths := list{}
+	paths.Set(value)
+	if len(paths) == 0 {
+		return nil
+	}
+	return &fieldmaskpb.FieldMask{Paths: paths}
+}
+
+// list is a flag of values given comma separated, repeated, or both.
+type list []string
+
+func (l *list) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *list) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// ids is a flag of ids given comma separated, repeated, or both.
+type ids []int64
+
+func (i *ids) String() string {
+	values := make([]string, len(*i))
+	for n, id := range *i {
+		values[n] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(values, ",")
+}
+
+func (i *ids) Set(value string) error {
+	var values list
+	values.Set(value)
+
+	for _, v := range values {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid id %q", v)
+		}
+		*i = append(*i, id)
+	}
+	return nil
+}
+
+// optionalBool is a boolean flag that is nil unless given, so that it doesn't filter.
+type optionalBool struct {
+	value *bool
+}
+
+func (b *optionalBool) String() string {
+	if b == nil || b.value == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b.value)
+}
+
+func (b *optionalBool) Set(value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	b.value = &v
+	return nil
+}
+
+func (b *optionalBool) IsBoolFlag() bool {
+	return true
+}
+
+// timestamp is a flag of a time given in RFC 3339, such as 2021-03-02T08:30:00Z, that is nil
+// unless given.
+type timestamp struct {
+	value *timestamppb.Timestamp
+}
+
+func (t *timestamp) String() string {
+	if t == nil || t.value == nil {
+		return ""
+	}
+	return t.value.AsTime().Format(time.RFC3339)
+}
+
+func (t *timestamp) Set(value string) error {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return fmt.Errorf("expected RFC 3339, such as 2021-03-02T08:30:00Z")
+	}
+	t.value = timestamppb.New(parsed)
+	return nil
+}
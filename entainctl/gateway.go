@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"git.neds.sh/matty/entain/api/proto/racing"
+	"git.neds.sh/matty/entain/api/proto/sports"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// Largest event read from a live update stream
+const maxEventSize = 1 << 20
+
+// gatewayClient calls the gateway's REST routes, authenticated with a bearer token or API key
+// when set, as a browser app would.
+type gatewayClient struct {
+	baseURL string
+	token   string
+	apiKey  string
+	http    *http.Client
+}
+
+// NewGatewayClient creates a client of the gateway at the base URL, such as
+// http://localhost:8000.
+func NewGatewayClient(baseURL string, token string, apiKey string) Client {
+	return &gatewayClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		apiKey:  apiKey,
+		http:    &http.Client{},
+	}
+}
+
+func (c *gatewayClient) ListRaces(ctx context.Context, in *racing.ListRacesRequest) (*racing.ListRacesResponse, error) {
+	out := &racing.ListRacesResponse{}
+	return out, c.call(ctx, http.MethodPost, "/v1/list-races", in, out)
+}
+
+func (c *gatewayClient) GetRace(ctx context.Context, in *racing.GetRaceRequest) (*racing.GetRaceResponse, error) {
+	out := &racing.GetRaceResponse{}
+	return out, c.call(ctx, http.MethodGet, "/v1/race/"+strconv.FormatInt(in.Id, 10)+maskQuery(in.ReadMask), nil, out)
+}
+
+func (c *gatewayClient) WatchRaces(ctx context.Context, in *racing.WatchRacesRequest, receive func(*racing.WatchRacesResponse) error) error {
+	query := url.Values{}
+	addIds(query, "meeting_ids", in.Filter.GetMeetingIds())
+	addIds(query, "race_ids", in.Filter.GetRaceIds())
+
+	return c.watch(ctx, "/v1/live/races", query, in.AfterId, func(data []byte) error {
+		response := &racing.WatchRacesResponse{}
+		if err := protojson.Unmarshal(data, response); err != nil {
+			return err
+		}
+		return receive(response)
+	})
+}
+
+func (c *gatewayClient) ListEvents(ctx context.Context, in *sports.ListEventsRequest) (*sports.ListEventsResponse, error) {
+	out := &sports.ListEventsResponse{}
+	return out, c.call(ctx, http.MethodPost, "/v1/list-events", in, out)
+}
+
+func (c *gatewayClient) GetEvent(ctx context.Context, in *sports.GetEventRequest) (*sports.GetEventResponse, error) {
+	out := &sports.GetEventResponse{}
+	return out, c.call(ctx, http.MethodGet, "/v1/event/"+strconv.FormatInt(in.Id, 10)+maskQuery(in.ReadMask), nil, out)
+}
+
+func (c *gatewayClient) WatchEvents(ctx context.Context, in *sports.WatchEventsRequest, receive func(*sports.WatchEventsResponse) error) error {
+	query := url.Values{}
+	addIds(query, "event_ids", in.Filter.GetEventIds())
+	addIds(query, "sport_ids", in.Filter.GetSportIds())
+	addIds(query, "competition_ids", in.Filter.GetCompetitionIds())
+	addIds(query, "team_ids", in.Filter.GetTeamIds())
+	if types := in.Filter.GetTypes(); len(types) > 0 {
+		query.Set("types", strings.Join(types, ","))
+	}
+
+	return c.watch(ctx, "/v1/live/events", query, in.AfterId, func(data []byte) error {
+		response := &sports.WatchEventsResponse{}
+		if err := protojson.Unmarshal(data, response); err != nil {
+			return err
+		}
+		return receive(response)
+	})
+}
+
+func (c *gatewayClient) UpdateScore(ctx context.Context, in *sports.UpdateScoreRequest) (*sports.UpdateScoreResponse, error) {
+	out := &sports.UpdateScoreResponse{}
+	return out, c.call(ctx, http.MethodPost, "/v1/event/"+strconv.FormatInt(in.EventId, 10)+"/score", in, out)
+}
+
+func (c *gatewayClient) Close() error {
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+// Sends a request with the message in as its JSON body, if any, reading the response into out
+func (c *gatewayClient) call(ctx context.Context, method string, path string, in proto.Message, out proto.Message) error {
+	var body io.Reader
+	if in != nil {
+		b, err := protojson.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	response, err := c.do(ctx, method, path, body, "application/json")
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	b, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	//Fields added to the API since the client was built are skipped
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(b, out)
+}
+
+// Reads a stream of Server-Sent Events, passing the data of each to receive. Heartbeats and
+// other comments are skipped, and the update ids are read from the data, which holds them too.
+func (c *gatewayClient) watch(ctx context.Context, path string, query url.Values, afterId uint64, receive func(data []byte) error) error {
+	if afterId > 0 {
+		query.Set("last_event_id", strconv.FormatUint(afterId, 10))
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	response, err := c.do(ctx, http.MethodGet, path, nil, "text/event-stream")
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 4096), maxEventSize)
+
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		switch {
+		case len(line) == 0 && len(data) > 0:
+			if err := receive(data); err != nil {
+				return err
+			}
+			data = nil
+		case bytes.HasPrefix(line, []byte("data:")):
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("data:")), []byte(" "))...)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
+
+// Sends a request, returning the gateway's errors as the gRPC status they were written from
+func (c *gatewayClient) do(ctx context.Context, method string, path string, body io.Reader, accept string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Accept", accept)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if len(c.token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if len(c.apiKey) > 0 {
+		request.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		defer response.Body.Close()
+
+		b, _ := ioutil.ReadAll(response.Body)
+		s := &spb.Status{}
+		if err := protojson.Unmarshal(b, s); err != nil || s.Code == 0 {
+			return nil, status.Error(codes.Unknown, fmt.Sprintf("gateway responded %s", response.Status))
+		}
+		return nil, status.ErrorProto(s)
+	}
+
+	return response, nil
+}
+
+func maskQuery(mask *fieldmaskpb.FieldMask) string {
+	if len(mask.GetPaths()) == 0 {
+		return ""
+	}
+	return "?" + url.Values{"read_mask": {strings.Join(mask.Paths, ",")}}.Encode()
+}
+
+func addIds(query url.Values, name string, ids []int64) {
+	if len(ids) == 0 {
+		return
+	}
+
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = strconv.FormatInt(id, 10)
+	}
+	query.Set(name, strings.Join(values, ","))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.neds.sh/matty/entain/api/proto/racing"
+	"git.neds.sh/matty/entain/api/proto/sports"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// Tests requests are sent to the gateway's routes with their credentials, and responses read back
+func TestGatewayCalls(t *testing.T) {
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+
+		switch r.URL.Path {
+		case "/v1/list-races":
+			io.WriteString(w, `{"races": [{"id": "7", "name": "Flemington Cup", "addedLater": true}]}`)
+		case "/v1/event/12/score":
+			io.WriteString(w, `{"event": {"id": "12", "score": {"homeScore": "2"}}}`)
+		default:
+			io.WriteString(w, `{"race": {"id": "7"}}`)
+		}
+	}))
+	defer server.Close()
+
+	client := NewGatewayClient(server.URL+"/", "token", "key")
+	defer client.Close()
+
+	races, err := client.ListRaces(context.Background(), &racing.ListRacesRequest{Filter: &racing.ListRacesRequestFilter{MeetingIds: []int64{5}}})
+	if err != nil || len(races.Races) != 1 || races.Races[0].Name != "Flemington Cup" {
+		t.Fatalf("Expected the races listed, got %v (%v)", races, err)
+	}
+	if requests[0].Method != http.MethodPost || !strings.Contains(bodies[0], `"meetingIds":["5"]`) ||
+		requests[0].Header.Get("Authorization") != "Bearer token" || requests[0].Header.Get("X-API-Key") != "key" {
+		t.Errorf("Expected the list request with credentials, got %v %s", requests[0], bodies[0])
+	}
+
+	if _, err := client.GetRace(context.Background(), &racing.GetRaceRequest{Id: 7, ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"id", "name"}}}); err != nil {
+		t.Fatalf("Error getting race: %v", err)
+	}
+	if requests[1].URL.String() != "/v1/race/7?read_mask=id%2Cname" {
+		t.Errorf("Expected the race's route with the read mask, got %s", requests[1].URL)
+	}
+
+	event, err := client.UpdateScore(context.Background(), &sports.UpdateScoreRequest{EventId: 12, Score: &sports.Score{HomeScore: 2}})
+	if err != nil || event.Event.Score.HomeScore != 2 || !strings.Contains(bodies[2], `"homeScore":"2"`) {
+		t.Errorf("Expected the score recorded, got %v (%v)", event, err)
+	}
+}
+
+// Tests errors written by the gateway are read back into the status they were written from
+func TestGatewayErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/race/404" {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"code": 5, "message": "race 404 not found", "details": []}`)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		io.WriteString(w, "<html>Bad Gateway</html>")
+	}))
+	defer server.Close()
+
+	client := NewGatewayClient(server.URL, "", "")
+
+	_, err := client.GetRace(context.Background(), &racing.GetRaceRequest{Id: 404})
+	if s := status.Convert(err); s.Code() != codes.NotFound || s.Message() != "race 404 not found" {
+		t.Errorf("Expected the gateway's error, got %v", err)
+	}
+
+	_, err = client.GetRace(context.Background(), &racing.GetRaceRequest{Id: 1})
+	if s := status.Convert(err); s.Code() != codes.Unknown || !strings.Contains(s.Message(), "502") {
+		t.Errorf("Expected an unknown error naming the response status, got %v", err)
+	}
+}
+
+// Tests live updates are read from the event stream, skipping heartbeats, until it ends
+func TestGatewayWatch(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "retry: 3000\n\n"+
+			"id: \nevent: missed\ndata: {\"missed\": true}\n\n"+
+			": heartbeat\n\n"+
+			"id: 41\nevent: score\ndata: {\"id\": \"41\", \"type\": \"SCORE\",\ndata: \"event\": {\"id\": \"3\"}}\n\n")
+	}))
+	defer server.Close()
+
+	client := NewGatewayClient(server.URL, "", "")
+
+	var updates []*sports.WatchEventsResponse
+	err := client.WatchEvents(context.Background(), &sports.WatchEventsRequest{
+		Filter:  &sports.WatchEventsRequestFilter{EventIds: []int64{3, 4}, Types: []string{"SCORE"}},
+		AfterId: 40,
+	}, func(update *sports.WatchEventsResponse) error {
+		updates = append(updates, update)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error watching events: %v", err)
+	}
+
+	if query != "event_ids=3%2C4&last_event_id=40&types=SCORE" {
+		t.Errorf("Expected the filter and id resumed after as parameters, got %s", query)
+	}
+	if len(updates) != 2 || !updates[0].Missed || updates[1].Id != 41 || updates[1].Event.Id != 3 {
+		t.Errorf("Expected the missed and score updates, got %v", updates)
+	}
+}
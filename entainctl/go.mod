@@ -0,0 +1,16 @@
+module git.neds.sh/matty/entain/entainctl
+
+go 1.16
+
+require (
+	git.neds.sh/matty/entain/api v0.0.0
+	git.neds.sh/matty/entain/common v0.0.0
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1
+	google.golang.org/grpc v1.54.0
+	google.golang.org/protobuf v1.30.0
+)
+
+replace (
+	git.neds.sh/matty/entain/api => ../api
+	git.neds.sh/matty/entain/common => ../common
+)
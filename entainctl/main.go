@@ -0,0 +1,143 @@
+// Command entainctl lists, gets and watches races and sporting events, and records scores, either
+// through the gateway or directly against the racing and sports services' gRPC endpoints.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"git.neds.sh/matty/entain/common/config"
+	"git.neds.sh/matty/entain/common/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var flags = flag.NewFlagSet("entainctl", flag.ContinueOnError)
+
+var (
+	transport      = flags.String("transport", "gateway", "Whether commands are sent to the gateway, or straight to the services' gRPC endpoints: gateway or grpc")
+	gatewayURL     = flags.String("gateway", "http://localhost:8000", "Base URL of the gateway")
+	racingEndpoint = flags.String("grpc-endpoint-racing", "localhost:9000", "gRPC racing server endpoint")
+	sportsEndpoint = flags.String("grpc-endpoint-sports", "localhost:9001", "gRPC sports server endpoint")
+	grpcTLSCA      = flags.String("grpc-tls-ca-file", "", "PEM CA bundle the services' certificates are verified against, enabling TLS to the services")
+	grpcTLSCert    = flags.String("grpc-tls-cert-file", "", "PEM client certificate presented to the services for mutual TLS, enabling TLS to the services")
+	grpcTLSKey     = flags.String("grpc-tls-key-file", "", "PEM private key of the client certificate")
+	grpcTLSName    = flags.String("grpc-tls-server-name", "", "Name the services' certificates are verified against, instead of the host dialled")
+	token          = flags.String("token", "", "JWT bearer token sent to the gateway, which admin commands such as events score require")
+	apiKey         = flags.String("api-key", "", "API key sent to the gateway, identifying the client to rate limits")
+	output         = flags.String("output", outputTable, "Output format: table, or json as received")
+	timeout        = flags.Duration("timeout", 10*time.Second, "How long commands other than watches are given to respond")
+)
+
+// Settings are read from a config file and ENTAINCTL_ environment variables as well as flags,
+// so a token can be kept out of the shell history
+var settings = config.New(flags, "ENTAINCTL")
+
+func init() {
+	settings.Check("transport", config.OneOf("gateway", "grpc"))
+	settings.Check("gateway", config.Required, config.URL)
+	settings.Check("grpc-endpoint-racing", config.Required, config.Endpoint)
+	settings.Check("grpc-endpoint-sports", config.Required, config.Endpoint)
+	settings.Check("output", config.OneOf(outputTable, outputJSON))
+	settings.Check("timeout", config.Positive)
+
+	flags.Usage = usage
+}
+
+func main() {
+	if err := settings.Load(os.Args[1:]); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintf(os.Stderr, "entainctl: %v\n", err)
+		}
+		os.Exit(2)
+	}
+
+	if settings.PrintRequested() {
+		if err := settings.Print(os.Stdout); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	command, args := FindCommand(flags.Args())
+	if command == nil {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := run(command, args); err != nil {
+		if err == errUsage {
+			os.Exit(2)
+		}
+
+		//Errors from the gateway are read back into the gRPC status they were written from, so
+		//they are reported the same way over either transport
+		s := status.Convert(err)
+		fmt.Fprintf(os.Stderr, "entainctl: %s: %s\n", s.Code(), s.Message())
+		os.Exit(1)
+	}
+}
+
+func run(command *Command, args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if !command.Watch {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return command.Run(ctx, client, NewPrinter(os.Stdout, *output), args)
+}
+
+func newClient() (Client, error) {
+	if *transport == "gateway" {
+		return NewGatewayClient(*gatewayURL, *token, *apiKey), nil
+	}
+
+	creds, err := grpcCredentials()
+	if err != nil {
+		return nil, err
+	}
+	return NewGRPCClient(*racingEndpoint, *sportsEndpoint, creds)
+}
+
+// Services are dialled over TLS when a CA bundle or client certificate is configured
+func grpcCredentials() (grpc.DialOption, error) {
+	if len(*grpcTLSCA) == 0 && len(*grpcTLSCert) == 0 && len(*grpcTLSKey) == 0 {
+		return grpc.WithInsecure(), nil
+	}
+
+	creds, err := tlsconfig.ClientCredentials(tlsconfig.Files{
+		CertFile: *grpcTLSCert,
+		KeyFile:  *grpcTLSKey,
+		CAFile:   *grpcTLSCA,
+	}, *grpcTLSName)
+	if err != nil {
+		return nil, err
+	}
+
+	return grpc.WithTransportCredentials(creds), nil
+}
+
+func usage() {
+	w := flags.Output()
+	fmt.Fprintf(w, "Usage: entainctl [global flags] <command> [flags] [args]\n\nCommands:\n")
+	for _, command := range Commands {
+		fmt.Fprintf(w, "  %-22s %s\n", command.Name+" "+command.Args, command.Summary)
+	}
+	fmt.Fprintf(w, "\nRun entainctl <command> -h for the flags of a command.\n\nGlobal flags:\n")
+	flags.PrintDefaults()
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"git.neds.sh/matty/entain/api/proto/racing"
+	"git.neds.sh/matty/entain/api/proto/sports"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Output formats
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// Widths of the columns of streamed updates, which are written as they arrive rather than
+// aligned once every row is known
+var (
+	raceUpdateWidths  = []int{18, 8, 8, 9, 8, 28, 22}
+	eventUpdateWidths = []int{18, 8, 8, 20, 26, 26, 12}
+)
+
+// Printer writes responses as aligned tables, or as JSON as they were received.
+type Printer struct {
+	w      io.Writer
+	format string
+	header bool
+}
+
+// NewPrinter creates a printer writing in the format, table or json.
+func NewPrinter(w io.Writer, format string) *Printer {
+	return &Printer{w: w, format: format}
+}
+
+// Races writes a response holding races, such as a list or a get.
+func (p *Printer) Races(response proto.Message, races []*racing.Race) error {
+	if p.format == outputJSON {
+		return p.json(response, true)
+	}
+
+	table := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tMEETING\tNUMBER\tNAME\tSTART\tSTATUS\tVISIBLE")
+	for _, race := range races {
+		fmt.Fprintf(table, "%d\t%d\t%d\t%s\t%s\t%s\t%t\n", race.Id, race.MeetingId, race.Number, race.Name, startTime(race.AdvertisedStartTime), race.Status, race.Visible)
+	}
+	return table.Flush()
+}
+
+// Events writes a response holding events, such as a list, a get or a score update.
+func (p *Printer) Events(response proto.Message, events []*sports.Event) error {
+	if p.format == outputJSON {
+		return p.json(response, true)
+	}
+
+	table := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tSPORT\tCOMPETITION\tHOME\tAWAY\tSTART\tSTATUS\tSCORE")
+	for _, event := range events {
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", event.Id, event.Sport.GetName(), event.Competition.GetName(), event.HomeTeam.GetName(), event.AwayTeam.GetName(), startTime(event.AdvertisedStartTime), event.Status, score(event.Score))
+	}
+	return table.Flush()
+}
+
+// RaceUpdate writes an update streamed while watching races, as a line of JSON or a table row.
+func (p *Printer) RaceUpdate(update *racing.WatchRacesResponse) error {
+	if p.format == outputJSON {
+		return p.json(update, false)
+	}
+
+	if !p.header {
+		p.header = true
+		p.row(raceUpdateWidths, "UPDATE", "TYPE", "ID", "MEETING", "NUMBER", "NAME", "START", "STATUS")
+	}
+	if update.Missed {
+		return p.row(raceUpdateWidths, id(update.Id), "MISSED", "updates were missed, reload what is shown")
+	}
+
+	race := update.Race
+	return p.row(raceUpdateWidths, id(update.Id), "STATUS", strconv.FormatInt(race.Id, 10), strconv.FormatInt(race.MeetingId, 10), strconv.FormatInt(race.Number, 10), race.Name, startTime(race.AdvertisedStartTime), race.Status)
+}
+
+// EventUpdate writes an update streamed while watching events, as a line of JSON or a table row.
+func (p *Printer) EventUpdate(update *sports.WatchEventsResponse) error {
+	if p.format == outputJSON {
+		return p.json(update, false)
+	}
+
+	if !p.header {
+		p.header = true
+		p.row(eventUpdateWidths, "UPDATE", "TYPE", "ID", "SPORT", "HOME", "AWAY", "STATUS", "SCORE")
+	}
+	if update.Missed {
+		return p.row(eventUpdateWidths, id(update.Id), "MISSED", "updates were missed, reload what is shown")
+	}
+
+	event := update.Event
+	return p.row(eventUpdateWidths, id(update.Id), update.Type, strconv.FormatInt(event.Id, 10), event.Sport.GetName(), event.HomeTeam.GetName(), event.AwayTeam.GetName(), event.Status, score(event.Score))
+}
+
+// Responses are indented, and streamed updates written one per line so they can be piped to jq
+func (p *Printer) json(message proto.Message, indent bool) error {
+	options := protojson.MarshalOptions{}
+	if indent {
+		options.Indent = "  "
+	}
+
+	b, err := options.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(p.w, "%s\n", b)
+	return err
+}
+
+// Writes cells padded to their column's width, leaving the last unpadded. Cells wider than
+// their column are still followed by a space, pushing those after it along.
+func (p *Printer) row(widths []int, cells ...string) error {
+	var line strings.Builder
+	for i, cell := range cells {
+		if i < len(cells)-1 && i < len(widths) {
+			cell = fmt.Sprintf("%-*s", widths[i], cell+" ")
+		}
+		line.WriteString(cell)
+	}
+
+	_, err := fmt.Fprintln(p.w, strings.TrimRight(line.String(), " "))
+	return err
+}
+
+func startTime(t *timestamppb.Timestamp) string {
+	if t == nil {
+		return ""
+	}
+	return t.AsTime().Format(time.RFC3339)
+}
+
+// Scores are written as home-away, with the period and clock while the event is being played
+func score(s *sports.Score) string {
+	if s == nil {
+		return ""
+	}
+
+	text := fmt.Sprintf("%d-%d", s.HomeScore, s.AwayScore)
+	if s.Final {
+		return text + " final"
+	}
+	if s.Period > 0 {
+		text += fmt.Sprintf(" P%d", s.Period)
+	}
+	if len(s.Clock) > 0 {
+		text += " " + s.Clock
+	}
+	return text
+}
+
+// Update ids of 0 are left out, as there is nothing to resume after
+func id(updateId uint64) string {
+	if updateId == 0 {
+		return "-"
+	}
+	return strconv.FormatUint(updateId, 10)
+}
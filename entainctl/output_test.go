@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"git.neds.sh/matty/entain/api/proto/racing"
+	"git.neds.sh/matty/entain/api/proto/sports"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Tests races and events are written as aligned tables
+func TestTables(t *testing.T) {
+	var out bytes.Buffer
+	printer := NewPrinter(&out, outputTable)
+
+	start := timestamppb.New(time.Date(2021, time.March, 2, 8, 30, 0, 0, time.UTC))
+	printer.Races(&racing.ListRacesResponse{}, []*racing.Race{{Id: 7, MeetingId: 5, Number: 3, Name: "Flemington Cup", AdvertisedStartTime: start, Status: "OPEN", Visible: true}})
+	printer.Events(&sports.ListEventsResponse{}, []*sports.Event{{
+		Id:       12,
+		Sport:    &sports.Reference{Name: "AFL"},
+		HomeTeam: &sports.Reference{Name: "Carlton"},
+		AwayTeam: &sports.Reference{Name: "Richmond"},
+		Status:   "INPROGRESS",
+		Score:    &sports.Score{HomeScore: 42, AwayScore: 37, Period: 3, Clock: "12:04"},
+	}})
+
+	expected := "" +
+		"ID  MEETING  NUMBER  NAME            START                 STATUS  VISIBLE\n" +
+		"7   5        3       Flemington Cup  2021-03-02T08:30:00Z  OPEN    true\n" +
+		"ID  SPORT  COMPETITION  HOME     AWAY      START  STATUS      SCORE\n" +
+		"12  AFL                 Carlton  Richmond         INPROGRESS  42-37 P3 12:04\n"
+	if out.String() != expected {
+		t.Errorf("Expected tables\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+// Tests streamed updates are written as rows under one header, or as a line of JSON each
+func TestUpdates(t *testing.T) {
+	var out bytes.Buffer
+	printer := NewPrinter(&out, outputTable)
+
+	printer.RaceUpdate(&racing.WatchRacesResponse{Missed: true})
+	printer.RaceUpdate(&racing.WatchRacesResponse{Id: 41, Race: &racing.Race{Id: 7, Name: "Flemington Cup", Status: "CLOSED"}})
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "UPDATE") || !strings.Contains(lines[1], "MISSED") ||
+		!strings.HasPrefix(lines[2], "41") || !strings.HasSuffix(lines[2], "CLOSED") || strings.Index(lines[2], "Flemington") != strings.Index(lines[0], "NAME") {
+		t.Errorf("Expected aligned rows under a header, got\n%s", out.String())
+	}
+
+	out.Reset()
+	printer = NewPrinter(&out, outputJSON)
+	printer.EventUpdate(&sports.WatchEventsResponse{Id: 41, Type: "SCORE", Event: &sports.Event{Id: 12}})
+	printer.EventUpdate(&sports.WatchEventsResponse{Id: 42, Type: "STATUS", Event: &sports.Event{Id: 12}})
+
+	lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	update := &sports.WatchEventsResponse{}
+	if len(lines) != 2 || protojson.Unmarshal([]byte(lines[1]), update) != nil || update.Id != 42 {
+		t.Errorf("Expected a line of JSON per update, got\n%s", out.String())
+	}
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"git.neds.sh/matty/entain/common/repocache"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+type cachedRacesRepo struct {
+	RacesRepo
+	cache *repocache.Cache
+}
+
+// NewCachedRacesRepo wraps a races repository with a read-through cache of up to a maximum
+// number of results, each held for at most the TTL. Results are never held past the start of
+// a race in them, when its status changes. Status changes and closed races are listed straight
+// from the repository, as each window is only listed once and closed lists grow as races start.
+func NewCachedRacesRepo(repo RacesRepo, maxEntries int, ttl time.Duration) RacesRepo {
+	return &cachedRacesRepo{RacesRepo: repo, cache: repocache.New(maxEntries, ttl)}
+}
+
+func (r *cachedRacesRepo) Get(ctx context.Context, id int64, fields []string) (*racing.Race, error) {
+	value, err := r.cache.Get(ctx, "get:"+strconv.FormatInt(id, 10)+":"+strings.Join(fields, ","), func(ctx context.Context) (interface{}, time.Time, error) {
+		race, err := r.RacesRepo.Get(ctx, id, fields)
+		if err != nil || race == nil {
+			return race, time.Time{}, err
+		}
+		return race, nextRaceStart([]*racing.Race{race}), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//Callers are given copies, so that cached races can't be changed through them
+	race := value.(*racing.Race)
+	if race == nil {
+		return nil, nil
+	}
+	return proto.Clone(race).(*racing.Race), nil
+}
+
+func (r *cachedRacesRepo) List(ctx context.Context, filter *racing.ListRacesRequestFilter, order_by string, fields []string, page_size int32) ([]*racing.Race, error) {
+	//Races join closed lists as they start, which lists without them can't expire at
+	if strings.EqualFold(filter.GetStatus(), "CLOSED") {
+		return r.RacesRepo.List(ctx, filter, order_by, fields, page_size)
+	}
+
+	key, err := proto.MarshalOptions{Deterministic: true}.Marshal(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := r.cache.Get(ctx, "list:"+order_by+":"+strings.Join(fields, ",")+":"+strconv.Itoa(int(page_size))+":"+string(key), func(ctx context.Context) (interface{}, time.Time, error) {
+		races, err := r.RacesRepo.List(ctx, filter, order_by, fields, page_size)
+		return races, nextRaceStart(races), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	races := value.([]*racing.Race)
+	copies := make([]*racing.Race, len(races))
+	for i, race := range races {
+		copies[i] = proto.Clone(race).(*racing.Race)
+	}
+	return copies, nil
+}
+
+// The earliest start of a race yet to start, when it closes, or the zero time
+func nextRaceStart(races []*racing.Race) time.Time {
+	var next time.Time
+	now := time.Now()
+	for _, race := range races {
+		start := race.GetAdvertisedStartTime().AsTime()
+		if start.After(now) && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return next
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"fmt"
 	"time"
 
 	"syreclabs.com/go/faker"
@@ -26,5 +27,39 @@ func (r *racesRepo) seed() error {
 		}
 	}
 
+	if err == nil {
+		err = r.createSearchIndex()
+	}
+
 	return err
 }
+
+// Create the full-text search index over races. Triggers keep the index in sync with
+// writes to the races table, and the index is rebuilt on start up so that databases
+// seeded before it existed are indexed too.
+func (r *racesRepo) createSearchIndex() error {
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(type UNINDEXED, id UNINDEXED, title, description, tokenize = 'porter unicode61')`,
+		`CREATE VIEW IF NOT EXISTS race_search AS SELECT id, name AS title, 'Race ' || number AS description FROM races`,
+		`CREATE TRIGGER IF NOT EXISTS races_search_insert AFTER INSERT ON races BEGIN
+			INSERT INTO search_index(type, id, title, description) SELECT 'RACE', id, title, description FROM race_search WHERE id = new.id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS races_search_update AFTER UPDATE ON races BEGIN
+			DELETE FROM search_index WHERE type = 'RACE' AND id = old.id;
+			INSERT INTO search_index(type, id, title, description) SELECT 'RACE', id, title, description FROM race_search WHERE id = new.id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS races_search_delete AFTER DELETE ON races BEGIN
+			DELETE FROM search_index WHERE type = 'RACE' AND id = old.id;
+		END`,
+		`DELETE FROM search_index`,
+		`INSERT INTO search_index(type, id, title, description) SELECT 'RACE', id, title, description FROM race_search`,
+	}
+
+	for _, statement := range statements {
+		if _, err := r.db.Exec(statement); err != nil {
+			return fmt.Errorf("creating search index, the service must be built with -tags sqlite_fts5: %w", err)
+		}
+	}
+
+	return nil
+}
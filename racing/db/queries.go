@@ -1,20 +1,82 @@
 package db
 
+import (
+	"database/sql"
+	"strings"
+
+	"git.neds.sh/matty/entain/common/sqlquery"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Runs the repositories' queries, timing them for the service's metrics and tracing them
+var queries = sqlquery.NewQueries(prometheus.DefaultRegisterer)
+
 const (
-	racesList = "list"
+	searchIndex = "search"
 )
 
+// Values scanned from a row of the races query
+type raceRow struct {
+	race            racing.Race
+	advertisedStart sql.NullTime
+}
+
+// A column of the races query, with the race fields it is needed for, or none if always needed
+type raceColumn struct {
+	name   string
+	fields []string
+	dest   func(row *raceRow) interface{}
+}
+
+var raceColumns = []raceColumn{
+	{"id", nil, func(row *raceRow) interface{} { return &row.race.Id }},
+	{"meeting_id", []string{"meeting_id"}, func(row *raceRow) interface{} { return &row.race.MeetingId }},
+	{"name", []string{"name"}, func(row *raceRow) interface{} { return &row.race.Name }},
+	{"number", []string{"number"}, func(row *raceRow) interface{} { return &row.race.Number }},
+	{"visible", []string{"visible"}, func(row *raceRow) interface{} { return &row.race.Visible }},
+	{"advertised_start_time", []string{"advertised_start_time", "status"}, func(row *raceRow) interface{} { return &row.advertisedStart }},
+}
+
+// The races query selecting only the columns needed for the race fields named, or every column
+// if none are, along with the columns selected in order
+func racesQuery(fields []string) (string, []raceColumn) {
+	wanted := make(map[string]bool)
+	for _, field := range fields {
+		wanted[field] = true
+	}
+
+	var (
+		columns []raceColumn
+		names   []string
+	)
+	for _, column := range raceColumns {
+		needed := len(fields) == 0 || len(column.fields) == 0
+		for _, field := range column.fields {
+			needed = needed || wanted[field]
+		}
+		if needed {
+			columns = append(columns, column)
+			names = append(names, column.name)
+		}
+	}
+
+	return "SELECT " + strings.Join(names, ", ") + " FROM races", columns
+}
+
 func getRaceQueries() map[string]string {
 	return map[string]string{
-		racesList: `
-			SELECT 
-				id, 
-				meeting_id, 
-				name, 
-				number, 
-				visible, 
-				advertised_start_time 
-			FROM races
+		searchIndex: `
+			SELECT
+				type,
+				id,
+				title,
+				description,
+				-bm25(search_index, 0.0, 0.0, 10.0, 1.0) AS score
+			FROM search_index
+			WHERE search_index MATCH ?
+			ORDER BY score DESC
+			LIMIT ?
 		`,
 	}
 }
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"regexp"
 	"strings"
@@ -18,11 +19,18 @@ type RacesRepo interface {
 	// Init will initialise our races repository.
 	Init() error
 
-	// List will return a list of races.
-	List(filter *racing.ListRacesRequestFilter, order_by string) ([]*racing.Race, error)
+	// List will return a list of races, selecting only what the fields named need, or everything if none are,
+	// and at most page_size races, or every race if 0.
+	List(ctx context.Context, filter *racing.ListRacesRequestFilter, order_by string, fields []string, page_size int32) ([]*racing.Race, error)
 
-	// Get will return an individual race
-	Get(id int64) (*racing.Race, error)
+	// Get will return an individual race, selecting only what the fields named need, or everything if none are.
+	Get(ctx context.Context, id int64, fields []string) (*racing.Race, error)
+
+	// BatchGet will return the races matching a list of ids, in no particular order
+	BatchGet(ctx context.Context, ids []int64) ([]*racing.Race, error)
+
+	// ListStatusChanges will return the races whose status changed within a window, which are those starting within it, soonest first
+	ListStatusChanges(ctx context.Context, from time.Time, before time.Time) ([]*racing.Race, error)
 }
 
 type racesRepo struct {
@@ -47,47 +55,93 @@ func (r *racesRepo) Init() error {
 	return err
 }
 
-func (r *racesRepo) Get(id int64) (*racing.Race, error) {
+func (r *racesRepo) Get(ctx context.Context, id int64, fields []string) (*racing.Race, error) {
 	var (
 		err   error
 		query string
 		args  []interface{}
 	)
 
-	query = getRaceQueries()[racesList]
+	query, columns := racesQuery(fields)
 
 	query, args = r.applyGet(query, id)
 
-	rows, err := r.db.Query(query, args...)
+	rows, done, err := queries.Query(ctx, r.db, "races.get", query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer done()
 
 	if !rows.Next() {
 		return nil, nil
 	}
-	return r.scanRace(rows, time.Now())
+	return r.scanRace(rows, columns, time.Now())
+}
+
+func (r *racesRepo) BatchGet(ctx context.Context, ids []int64) ([]*racing.Race, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	query, columns := racesQuery(nil)
+
+	query, args := r.applyBatchGet(query, ids)
+
+	rows, done, err := queries.Query(ctx, r.db, "races.batch_get", query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	return r.scanRaces(rows, columns, time.Now())
 }
 
-func (r *racesRepo) List(filter *racing.ListRacesRequestFilter, order_by string) ([]*racing.Race, error) {
+func (r *racesRepo) List(ctx context.Context, filter *racing.ListRacesRequestFilter, order_by string, fields []string, page_size int32) ([]*racing.Race, error) {
 	var (
 		err   error
 		query string
 		args  []interface{}
 	)
 
-	query = getRaceQueries()[racesList]
+	//Statuses are filtered and derived as of the same time, so that they agree
+	requestTime := time.Now()
+
+	query, columns := racesQuery(fields)
 
-	query, args = r.applyFilter(query, filter)
+	query, args = r.applyFilter(query, filter, requestTime)
 
 	query = r.applySort(query, order_by)
 
-	rows, err := r.db.Query(query, args...)
+	query, args = r.applyLimit(query, args, page_size)
+
+	rows, done, err := queries.Query(ctx, r.db, "races.list", query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	return r.scanRaces(rows, columns, requestTime)
+}
+
+func (r *racesRepo) ListStatusChanges(ctx context.Context, from time.Time, before time.Time) ([]*racing.Race, error) {
+	requestTime := time.Now()
+
+	query, columns := racesQuery(nil)
+
+	query, args := r.applyFilter(query, &racing.ListRacesRequestFilter{
+		StartFrom:   timestamppb.New(from),
+		StartBefore: timestamppb.New(before),
+	}, requestTime)
+
+	query = r.applySort(query, "advertised_start_time, id")
+
+	rows, done, err := queries.Query(ctx, r.db, "races.status_changes", query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer done()
 
-	return r.scanRaces(rows)
+	return r.scanRaces(rows, columns, requestTime)
 }
 
 func (r *racesRepo) applyGet(query string, id int64) (string, []interface{}) {
@@ -97,7 +151,16 @@ func (r *racesRepo) applyGet(query string, id int64) (string, []interface{}) {
 	return query, args
 }
 
-func (r *racesRepo) applyFilter(query string, filter *racing.ListRacesRequestFilter) (string, []interface{}) {
+func (r *racesRepo) applyBatchGet(query string, ids []int64) (string, []interface{}) {
+	var args []interface{}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	query += " WHERE id IN (" + strings.Repeat("?,", len(ids)-1) + "?)"
+	return query, args
+}
+
+func (r *racesRepo) applyFilter(query string, filter *racing.ListRacesRequestFilter, requestTime time.Time) (string, []interface{}) {
 	var (
 		clauses []string
 		args    []interface{}
@@ -121,6 +184,27 @@ func (r *racesRepo) applyFilter(query string, filter *racing.ListRacesRequestFil
 		args = append(args, filter.GetVisible())
 	}
 
+	//Start times are stored with their offset, so they are compared as instants rather than text
+	if filter.StartFrom != nil {
+		clauses = append(clauses, "julianday(advertised_start_time) >= julianday(?)")
+		args = append(args, filter.StartFrom.AsTime().Format(time.RFC3339))
+	}
+
+	if filter.StartBefore != nil {
+		clauses = append(clauses, "julianday(advertised_start_time) < julianday(?)")
+		args = append(args, filter.StartBefore.AsTime().Format(time.RFC3339))
+	}
+
+	//Races are open until their advertised start, as getRaceStatus derives
+	switch strings.ToUpper(filter.Status) {
+	case "OPEN":
+		clauses = append(clauses, "julianday(advertised_start_time) >= julianday(?)")
+		args = append(args, requestTime.Format(time.RFC3339Nano))
+	case "CLOSED":
+		clauses = append(clauses, "julianday(advertised_start_time) < julianday(?)")
+		args = append(args, requestTime.Format(time.RFC3339Nano))
+	}
+
 	if len(clauses) != 0 {
 		query += " WHERE " + strings.Join(clauses, " AND ")
 	}
@@ -141,6 +225,16 @@ func (r *racesRepo) applySort(query string, order_by string) string {
 	return query
 }
 
+// If a page size is provided, return at most that many races
+func (r *racesRepo) applyLimit(query string, args []interface{}, page_size int32) (string, []interface{}) {
+	if page_size > 0 {
+		query += " LIMIT ?"
+		args = append(args, page_size)
+	}
+
+	return query, args
+}
+
 // Sanitise sort order input to prevent sql injection
 func sanitiseOrderBy(order_by string) string {
 	orders_in := strings.Split(order_by, ",")
@@ -175,12 +269,13 @@ func sanitiseOrderBy(order_by string) string {
 
 func (m *racesRepo) scanRaces(
 	rows *sql.Rows,
+	columns []raceColumn,
+	requestTime time.Time,
 ) ([]*racing.Race, error) {
 	var races []*racing.Race
-	requestTime := time.Now()
 
 	for rows.Next() {
-		race, err := m.scanRace(rows, requestTime)
+		race, err := m.scanRace(rows, columns, requestTime)
 		if err != nil {
 			return nil, err
 		}
@@ -190,11 +285,15 @@ func (m *racesRepo) scanRaces(
 	return races, nil
 }
 
-func (m *racesRepo) scanRace(rows *sql.Rows, requestTime time.Time) (*racing.Race, error) {
-	var race racing.Race
-	var advertisedStart time.Time
+func (m *racesRepo) scanRace(rows *sql.Rows, columns []raceColumn, requestTime time.Time) (*racing.Race, error) {
+	var row raceRow
+
+	dest := make([]interface{}, len(columns))
+	for i, column := range columns {
+		dest[i] = column.dest(&row)
+	}
 
-	if err := rows.Scan(&race.Id, &race.MeetingId, &race.Name, &race.Number, &race.Visible, &advertisedStart); err != nil {
+	if err := rows.Scan(dest...); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -202,13 +301,18 @@ func (m *racesRepo) scanRace(rows *sql.Rows, requestTime time.Time) (*racing.Rac
 		return nil, err
 	}
 
-	race.Status = getRaceStatus(&advertisedStart, &requestTime)
+	race := &row.race
+
+	//Start times are only selected when the start or status is wanted
+	if row.advertisedStart.Valid {
+		race.Status = getRaceStatus(&row.advertisedStart.Time, &requestTime)
 
-	ts := timestamppb.New(advertisedStart)
+		ts := timestamppb.New(row.advertisedStart.Time)
 
-	race.AdvertisedStartTime = ts
+		race.AdvertisedStartTime = ts
+	}
 
-	return &race, nil
+	return race, nil
 }
 
 func getRaceStatus(startTime *time.Time, requestTime *time.Time) string {
@@ -0,0 +1,87 @@
+//go:build sqlite_fts5
+// +build sqlite_fts5
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// Opens a seeded in-memory database. Each connection to :memory: is a separate database,
+// so the pool is held to one connection.
+func newTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if err := NewRacesRepo(db).Init(); err != nil {
+		t.Fatalf("Error seeding database: %v", err)
+	}
+	return db
+}
+
+func exec(t *testing.T, db *sql.DB, statement string, args ...interface{}) {
+	if _, err := db.Exec(statement, args...); err != nil {
+		t.Fatalf("Error executing %q: %v", statement, err)
+	}
+}
+
+func search(t *testing.T, repo SearchRepo, query string) []*racing.SearchResult {
+	results, err := repo.Search(context.Background(), query, 10)
+	if err != nil {
+		t.Fatalf("Error searching for %q: %v", query, err)
+	}
+	return results
+}
+
+// Tests matches are ranked by bm25, closer matches first, and only scored above 0
+func TestSearchRanking(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewSearchRepo(db)
+
+	exec(t, db, `UPDATE races SET name = ? WHERE id = 1`, "Quokka Plate at the Valley Showgrounds")
+	exec(t, db, `UPDATE races SET name = ? WHERE id = 2`, "Quokka Stakes")
+
+	results := search(t, repo, "quok")
+	if len(results) != 2 || results[0].Id != 2 || results[1].Id != 1 {
+		t.Fatalf("Expected the shorter title ranked first, got %v", results)
+	}
+	if results[0].Type != "RACE" || results[0].Title != "Quokka Stakes" || results[1].Score <= 0 || results[0].Score <= results[1].Score {
+		t.Errorf("Expected races with descending positive scores, got %v", results)
+	}
+
+	if results := search(t, repo, "quokka showgrounds"); len(results) != 1 || results[0].Id != 1 {
+		t.Errorf("Expected every word to have to match, got %v", results)
+	}
+}
+
+// Tests the triggers keep the index in sync as races are inserted, renamed and deleted
+func TestSearchSync(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewSearchRepo(db)
+
+	exec(t, db, `INSERT INTO races(id, meeting_id, name, number, visible, advertised_start_time) VALUES (101, 1, 'Numbat Handicap', 4, 1, '2021-03-02T08:30:00Z')`)
+	if results := search(t, repo, "numbat"); len(results) != 1 || results[0].Id != 101 || results[0].Description != "Race 4" {
+		t.Fatalf("Expected the inserted race to be indexed, got %v", results)
+	}
+
+	exec(t, db, `UPDATE races SET name = 'Bilby Handicap', number = 6 WHERE id = 101`)
+	if results := search(t, repo, "numbat"); len(results) != 0 {
+		t.Errorf("Expected the old name to be removed from the index, got %v", results)
+	}
+	if results := search(t, repo, "bilby"); len(results) != 1 || results[0].Id != 101 || results[0].Description != "Race 6" {
+		t.Errorf("Expected the new name to be indexed, got %v", results)
+	}
+
+	exec(t, db, `DELETE FROM races WHERE id = 101`)
+	if results := search(t, repo, "bilby"); len(results) != 0 {
+		t.Errorf("Expected the deleted race to be removed from the index, got %v", results)
+	}
+}
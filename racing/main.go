@@ -1,59 +1,225 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"flag"
-	"log"
 	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"git.neds.sh/matty/entain/common/config"
+	"git.neds.sh/matty/entain/common/feed"
+	"git.neds.sh/matty/entain/common/health"
+	"git.neds.sh/matty/entain/common/logging"
+	"git.neds.sh/matty/entain/common/metrics"
+	"git.neds.sh/matty/entain/common/tlsconfig"
+	"git.neds.sh/matty/entain/common/tracing"
 	"git.neds.sh/matty/entain/racing/db"
 	"git.neds.sh/matty/entain/racing/proto/racing"
 	"git.neds.sh/matty/entain/racing/service"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
 var (
-	grpcEndpoint = flag.String("grpc-endpoint", "localhost:9000", "gRPC server endpoint")
+	dbFile          = flag.String("db-file", "./db/racing.db", "SQLite database file, seeded with example data at startup")
+	grpcEndpoint    = flag.String("grpc-endpoint", "localhost:9000", "gRPC server endpoint")
+	tlsCertFile     = flag.String("tls-cert-file", "", "PEM certificate served over TLS, the server is plaintext if unset")
+	tlsKeyFile      = flag.String("tls-key-file", "", "PEM private key of the TLS certificate")
+	tlsClientCA     = flag.String("tls-client-ca-file", "", "PEM CA bundle client certificates must be issued by, for mutual TLS")
+	healthInterval  = flag.Duration("health-check-interval", 5*time.Second, "How often the database is checked for health watchers")
+	metricsEndpoint = flag.String("metrics-endpoint", "localhost:9100", "HTTP endpoint Prometheus metrics are served on at /metrics, disabled if empty")
+	otlpEndpoint    = flag.String("otlp-endpoint", "", "Base URL of an OTLP/HTTP receiver traces are exported to, such as http://localhost:4318")
+	traceFile       = flag.String("trace-file", "", "File traces are appended to as OTLP JSON lines, or - for stdout")
+	traceSampling   = flag.Float64("trace-sample-ratio", 1, "Ratio of traces started by the service that are sampled")
+	logLevel        = flag.String("log-level", "info", "Minimum level logged: debug, info, warn or error")
+	repoCacheTTL    = flag.Duration("repo-cache-ttl", 2*time.Second, "How long query results are cached for at most, disabled if 0")
+	repoCacheSize   = flag.Int("repo-cache-size", 1000, "Most query results cached")
+	watchInterval   = flag.Duration("watch-poll-interval", time.Second, "How often races are checked for status changes to stream to watchers")
+	watchHistory    = flag.Int("watch-history-size", 1000, "Most recent updates held for watchers to resume after")
+	grpcReflection  = flag.Bool("grpc-reflection", true, "Serve gRPC server reflection, so tools such as grpcurl can describe and call the service")
+	shutdownTimeout = flag.Duration("shutdown-timeout", 10*time.Second, "How long in-flight requests are given to finish on SIGINT or SIGTERM before they are cancelled")
 )
 
+// Settings are read from a config file and RACING_ environment variables as well as flags
+var settings = config.New(flag.CommandLine, "RACING")
+
+func init() {
+	settings.Check("db-file", config.Required)
+	settings.Check("grpc-endpoint", config.Required, config.Endpoint)
+	settings.Check("metrics-endpoint", config.Optional(config.Endpoint))
+	settings.Check("otlp-endpoint", config.Optional(config.URL))
+	settings.Check("trace-sample-ratio", config.Ratio)
+	settings.Check("health-check-interval", config.Positive)
+	settings.Check("watch-poll-interval", config.Positive)
+	settings.Check("shutdown-timeout", config.Positive)
+	settings.Check("log-level", config.OneOf("debug", "info", "warn", "error"))
+}
+
 func main() {
-	flag.Parse()
+	if err := settings.Load(os.Args[1:]); err != nil {
+		logging.Error("failed loading config", "error", err)
+		os.Exit(2)
+	}
+
+	if settings.PrintRequested() {
+		if err := settings.Print(os.Stdout); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
 
 	if err := run(); err != nil {
-		log.Fatalf("failed running grpc server: %s\n", err)
+		logging.Error("failed running grpc server", "error", err)
+		os.Exit(1)
 	}
 }
 
 func run() error {
-	conn, err := net.Listen("tcp", ":9000")
+	if err := logging.Configure(*logLevel); err != nil {
+		return err
+	}
+
+	//The server runs until it is interrupted or terminated, then drains in-flight requests
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	conn, err := net.Listen("tcp", *grpcEndpoint)
 	if err != nil {
 		return err
 	}
 
-	racingDB, err := sql.Open("sqlite3", "./db/racing.db")
+	racingDB, err := sql.Open("sqlite3", *dbFile)
 	if err != nil {
 		return err
 	}
+	defer racingDB.Close()
 
 	racesRepo := db.NewRacesRepo(racingDB)
 	if err := racesRepo.Init(); err != nil {
 		return err
 	}
 
-	grpcServer := grpc.NewServer()
+	//Reads are cached in front of the database, but seeding goes straight to it
+	if *repoCacheTTL > 0 {
+		racesRepo = db.NewCachedRacesRepo(racesRepo, *repoCacheSize, *repoCacheTTL)
+	}
+
+	var serverOptions []grpc.ServerOption
+	if len(*tlsCertFile) > 0 || len(*tlsKeyFile) > 0 {
+		tlsConfig, err := tlsconfig.ServerConfig(tlsconfig.Files{
+			CertFile: *tlsCertFile,
+			KeyFile:  *tlsKeyFile,
+			CAFile:   *tlsClientCA,
+		})
+		if err != nil {
+			return err
+		}
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	} else if len(*tlsClientCA) > 0 {
+		return errors.New("a TLS certificate and key are required for mutual TLS")
+	}
+
+	tracer, err := tracing.Configure(tracing.Config{
+		Service:      "racing",
+		OTLPEndpoint: *otlpEndpoint,
+		File:         *traceFile,
+		SampleRatio:  *traceSampling,
+	})
+	if err != nil {
+		return err
+	}
+	if tracer != nil {
+		defer tracer.Shutdown(context.Background())
+	}
+
+	serverMetrics := metrics.NewServerMetrics(prometheus.DefaultRegisterer)
+	serverOptions = append(serverOptions,
+		grpc.ChainUnaryInterceptor(logging.UnaryServerInterceptor(), otelgrpc.UnaryServerInterceptor(), serverMetrics.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(logging.StreamServerInterceptor(), otelgrpc.StreamServerInterceptor(), serverMetrics.StreamServerInterceptor()),
+	)
+
+	grpcServer := grpc.NewServer(serverOptions...)
+
+	//Races are published to watchers as their status changes, found by polling as they are derived from the time
+	updates := feed.New(*watchHistory)
+	go service.NewStatusPublisher(racesRepo, updates).Run(ctx, *watchInterval)
 
 	racing.RegisterRacingServer(
 		grpcServer,
 		service.NewRacingService(
 			racesRepo,
+			db.NewSearchRepo(racingDB),
+			updates,
 		),
 	)
 
-	log.Printf("gRPC server listening on: %s\n", *grpcEndpoint)
+	//Health follows whether the database can be reached, so instances are only sent requests they can serve
+	monitor := health.NewMonitor(racingDB.PingContext, time.Second, racing.Racing_ServiceDesc.ServiceName)
+	healthpb.RegisterHealthServer(grpcServer, monitor)
+	go monitor.Run(ctx, *healthInterval)
+
+	//Reflection describes the services registered above, so it is registered last
+	if *grpcReflection {
+		reflection.Register(grpcServer)
+	}
+
+	serverMetrics.InitializeMetrics(grpcServer)
+
+	if len(*metricsEndpoint) > 0 {
+		if err := metrics.Serve(*metricsEndpoint); err != nil {
+			return err
+		}
+	}
+
+	logging.Info("gRPC server listening", "endpoint", *grpcEndpoint)
 
-	if err := grpcServer.Serve(conn); err != nil {
+	served := make(chan error, 1)
+	go func() {
+		served <- grpcServer.Serve(conn)
+	}()
+
+	select {
+	case err := <-served:
 		return err
+	case <-ctx.Done():
 	}
 
+	logging.Info("shutting down gRPC server", "timeout", shutdownTimeout.String())
+
+	//Health is reported as not serving first, so the gateway stops routing requests here
+	monitor.Shutdown()
+
+	//Watches never finish by themselves, so they are ended for clients to resume with another instance
+	updates.Close()
+	gracefulStop(grpcServer, *shutdownTimeout)
+
 	return nil
 }
+
+// Stops the server once in-flight requests finish, cancelling those still running after the timeout
+func gracefulStop(server *grpc.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-stopped:
+	case <-timer.C:
+		logging.Warn("timed out draining in-flight requests, cancelling them")
+		server.Stop()
+	}
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"git.neds.sh/matty/entain/common/feed"
+	"git.neds.sh/matty/entain/common/logging"
+	"git.neds.sh/matty/entain/racing/db"
+)
+
+// StatusPublisher publishes races to a feed of updates as their status changes, which is as
+// they start and close to betting.
+type StatusPublisher struct {
+	racesRepo db.RacesRepo
+	updates   *feed.Feed
+	last      time.Time
+	now       func() time.Time
+}
+
+// NewStatusPublisher creates a publisher of the status changes of races from now on.
+func NewStatusPublisher(racesRepo db.RacesRepo, updates *feed.Feed) *StatusPublisher {
+	return &StatusPublisher{racesRepo: racesRepo, updates: updates, last: time.Now(), now: time.Now}
+}
+
+// Run publishes the status changes found every interval, until the context is done.
+func (p *StatusPublisher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Publish(ctx); err != nil {
+				logging.FromContext(ctx).Warn("failed publishing race status changes", "error", err)
+			}
+		}
+	}
+}
+
+// Publish publishes the races whose status changed since the last changes were published.
+func (p *StatusPublisher) Publish(ctx context.Context) error {
+	now := p.now()
+
+	races, err := p.racesRepo.ListStatusChanges(ctx, p.last, now)
+	if err != nil {
+		//The window is listed again next time, so changes aren't lost while the database is unavailable
+		return err
+	}
+
+	for _, race := range races {
+		p.updates.Publish(race)
+	}
+
+	p.last = now
+	return nil
+}
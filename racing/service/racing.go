@@ -1,42 +1,199 @@
 package service
 
 import (
+	"strings"
+
+	"git.neds.sh/matty/entain/common/feed"
+	"git.neds.sh/matty/entain/common/fieldmask"
 	"git.neds.sh/matty/entain/racing/db"
 	"git.neds.sh/matty/entain/racing/proto/racing"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Number of search results returned when no limit is requested, and the most that can be
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
 )
 
+// Most ids that can be requested in a batch
+const maxBatchIds = 100
+
 type Racing interface {
 	// ListRaces will return a collection of races.
 	ListRaces(ctx context.Context, in *racing.ListRacesRequest) (*racing.ListRacesResponse, error)
 	// GetRace will return a single race matching the requested id
 	GetRace(ctx context.Context, in *racing.GetRaceRequest) (*racing.GetRaceResponse, error)
+	// BatchGetRaces will return the races matching a list of ids, in the order requested
+	BatchGetRaces(ctx context.Context, in *racing.BatchGetRacesRequest) (*racing.BatchGetRacesResponse, error)
+	// Search will return races matching a full-text query, best matches first
+	Search(ctx context.Context, in *racing.SearchRequest) (*racing.SearchResponse, error)
+	// WatchRaces will stream races as their status changes, published to the feed of updates
+	WatchRaces(in *racing.WatchRacesRequest, stream racing.Racing_WatchRacesServer) error
 }
 
 // racingService implements the Racing interface.
 type racingService struct {
-	racesRepo db.RacesRepo
+	racesRepo  db.RacesRepo
+	searchRepo db.SearchRepo
+	updates    *feed.Feed
 }
 
-// NewRacingService instantiates and returns a new racingService.
-func NewRacingService(racesRepo db.RacesRepo) Racing {
-	return &racingService{racesRepo}
+// NewRacingService instantiates and returns a new racingService, streaming the races published
+// to the updates feed to watchers.
+func NewRacingService(racesRepo db.RacesRepo, searchRepo db.SearchRepo, updates *feed.Feed) Racing {
+	return &racingService{racesRepo, searchRepo, updates}
 }
 
 func (s *racingService) ListRaces(ctx context.Context, in *racing.ListRacesRequest) (*racing.ListRacesResponse, error) {
-	races, err := s.racesRepo.List(in.Filter, in.OrderBy)
+	if err := fieldmask.Validate(in.ReadMask, &racing.Race{}); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid read mask: %v", err)
+	}
+	if in.PageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page size cannot be negative")
+	}
+	switch strings.ToUpper(in.Filter.GetStatus()) {
+	case "", "OPEN", "CLOSED":
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid status %q, expected OPEN or CLOSED", in.Filter.GetStatus())
+	}
+
+	races, err := s.racesRepo.List(ctx, in.Filter, in.OrderBy, fieldmask.Fields(in.ReadMask), in.PageSize)
 	if err != nil {
 		return nil, err
 	}
 
+	//Fields selected only to derive those wanted, such as the start time for the status, are dropped
+	for _, race := range races {
+		fieldmask.Prune(race, in.ReadMask)
+	}
+
 	return &racing.ListRacesResponse{Races: races}, nil
 }
 
 func (s *racingService) GetRace(ctx context.Context, in *racing.GetRaceRequest) (*racing.GetRaceResponse, error) {
-	race, err := s.racesRepo.Get(in.Id)
+	if err := fieldmask.Validate(in.ReadMask, &racing.Race{}); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid read mask: %v", err)
+	}
+
+	race, err := s.racesRepo.Get(ctx, in.Id, fieldmask.Fields(in.ReadMask))
 	if err != nil {
 		return nil, err
 	}
 
+	if race != nil {
+		fieldmask.Prune(race, in.ReadMask)
+	}
+
 	return &racing.GetRaceResponse{Race: race}, nil
 }
+
+func (s *racingService) BatchGetRaces(ctx context.Context, in *racing.BatchGetRacesRequest) (*racing.BatchGetRacesResponse, error) {
+	if len(in.Ids) > maxBatchIds {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d ids can be requested", maxBatchIds)
+	}
+
+	//Ids requested more than once are only queried once
+	var ids []int64
+	seen := make(map[int64]bool)
+	for _, id := range in.Ids {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	races, err := s.racesRepo.BatchGet(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byId := make(map[int64]*racing.Race, len(races))
+	for _, race := range races {
+		byId[race.Id] = race
+	}
+
+	results := make([]*racing.BatchGetRacesResult, len(in.Ids))
+	for i, id := range in.Ids {
+		race, found := byId[id]
+		results[i] = &racing.BatchGetRacesResult{Id: id, Found: found, Race: race}
+	}
+
+	return &racing.BatchGetRacesResponse{Results: results}, nil
+}
+
+func (s *racingService) Search(ctx context.Context, in *racing.SearchRequest) (*racing.SearchResponse, error) {
+	if len(strings.TrimSpace(in.Query)) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "query is required")
+	}
+
+	limit := in.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	} else if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	results, err := s.searchRepo.Search(ctx, in.Query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &racing.SearchResponse{Results: results}, nil
+}
+
+func (s *racingService) WatchRaces(in *racing.WatchRacesRequest, stream racing.Racing_WatchRacesServer) error {
+	watcher, resumed := s.updates.Watch(in.AfterId)
+	defer watcher.Close()
+
+	//Headers are sent straight away so clients know the watch started before any update is sent
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	if !resumed {
+		if err := stream.Send(&racing.WatchRacesResponse{Id: watcher.Latest(), Missed: true}); err != nil {
+			return err
+		}
+	}
+
+	for {
+		update, err := watcher.Next(stream.Context())
+		if err == feed.ErrLagged {
+			return status.Error(codes.ResourceExhausted, "watcher fell behind, resume after the last update received")
+		}
+		if err == feed.ErrClosed {
+			return status.Error(codes.Unavailable, "service shutting down, resume after the last update received")
+		}
+		if err != nil {
+			return status.FromContextError(err).Err()
+		}
+
+		race := update.Message.(*racing.Race)
+		if !watchMatches(in.Filter, race) {
+			continue
+		}
+
+		if err := stream.Send(&racing.WatchRacesResponse{Id: update.Id, Race: race}); err != nil {
+			return err
+		}
+	}
+}
+
+// Races match a watch filter if they match every list of ids given
+func watchMatches(filter *racing.WatchRacesRequestFilter, race *racing.Race) bool {
+	return containsId(filter.GetMeetingIds(), race.MeetingId) && containsId(filter.GetRaceIds(), race.Id)
+}
+
+// Empty lists of ids contain every id
+func containsId(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return len(ids) == 0
+}
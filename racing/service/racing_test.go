@@ -6,10 +6,16 @@ import (
 	"testing"
 	"time"
 
+	"git.neds.sh/matty/entain/common/feed"
 	"git.neds.sh/matty/entain/racing/db"
 	"git.neds.sh/matty/entain/racing/internal/test_utils"
 	"git.neds.sh/matty/entain/racing/proto/racing"
 	"github.com/DATA-DOG/go-sqlmock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -18,7 +24,7 @@ func listTestRun(t *testing.T, mockDb *sql.DB, request *racing.ListRacesRequest)
 
 	//Create service using mock db and filter
 	mockRacesRepo := db.NewRacesRepo(mockDb)
-	racingService := NewRacingService(mockRacesRepo)
+	racingService := NewRacingService(mockRacesRepo, db.NewSearchRepo(mockDb), nil)
 
 	//Call service
 	listRacesResponse, err := racingService.ListRaces(context.TODO(), request)
@@ -166,6 +172,46 @@ func TestListRacesWithVisibilityFilter(t *testing.T) {
 	raceResultAssertions(t, sampleRaces, listResponse.Races, mockDb.Mock)
 }
 
+// Tests list prodecure with a start time window, compared in UTC whatever the zone requested
+func TestListRacesWithStartWindow(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockRaceDb(t)
+	mockDb := mockDbHelper.Init()
+
+	windowStart := time.Date(2021, time.March, 3, 11, 30, 0, 0, time.FixedZone("", 36000))
+
+	//Races to return for expected query/args
+	sampleRaces := []*racing.Race{
+		{Id: 1, MeetingId: 1, Name: "Mock race 1", Number: 2, Visible: true, AdvertisedStartTime: timestamppb.New(windowStart.Add(time.Minute)), Status: "CLOSED"},
+	}
+
+	includedRows := mockDb.Mock.NewRows(mockDb.ColumnNames)
+	for _, race := range sampleRaces {
+		includedRows.AddRow(race.Id, race.MeetingId, race.Name, race.Number, race.Visible, race.AdvertisedStartTime.AsTime())
+	}
+
+	mockDb.Mock.
+		ExpectQuery(`SELECT id, meeting_id, name, number, visible, advertised_start_time FROM races WHERE julianday(advertised_start_time) >= julianday(?) AND julianday(advertised_start_time) < julianday(?) ORDER BY advertised_start_time`).
+		WithArgs("2021-03-03T01:30:00Z", "2021-03-03T02:30:00Z").
+		WillReturnRows(includedRows)
+
+	//Create mock request and filter as input
+	listRacesRequest := racing.ListRacesRequest{
+		Filter: &racing.ListRacesRequestFilter{
+			StartFrom:   timestamppb.New(windowStart),
+			StartBefore: timestamppb.New(windowStart.Add(time.Hour)),
+		},
+		OrderBy: "advertised_start_time",
+	}
+
+	listResponse := listTestRun(t, mockDb.DB, &listRacesRequest)
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	raceResultAssertions(t, sampleRaces, listResponse.Races, mockDb.Mock)
+}
+
 // Tests list prodecure with sort order specified
 func TestListRacesWithSortOrder(t *testing.T) {
 	//Initiliase mock database
@@ -208,6 +254,45 @@ func TestListRacesWithSortOrder(t *testing.T) {
 	raceResultAssertions(t, sampleRaces, listResponse.Races, mockDb.Mock)
 }
 
+// Tests list prodecure returns at most the page size requested, in the order requested
+func TestListRacesWithPageSize(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockRaceDb(t)
+	mockDb := mockDbHelper.Init()
+
+	mockTime := time.Date(2021, time.March, 3, 11, 30, 57, 0, time.FixedZone("", 36000))
+
+	//Races to return for expected query/args
+	sampleRaces := []*racing.Race{
+		{Id: 2, MeetingId: 9, Name: "Mock race 3", Number: 5, Visible: true, AdvertisedStartTime: timestamppb.New(mockTime), Status: "CLOSED"},
+		{Id: 1, MeetingId: 1, Name: "Mock race 1", Number: 2, Visible: true, AdvertisedStartTime: timestamppb.New(mockTime.Add(time.Second)), Status: "CLOSED"},
+	}
+
+	includedRows := mockDb.Mock.NewRows(mockDb.ColumnNames)
+	for _, race := range sampleRaces {
+		includedRows.AddRow(race.Id, race.MeetingId, race.Name, race.Number, race.Visible, race.AdvertisedStartTime.AsTime())
+	}
+
+	//The page size limits the query, rather than the races it returns
+	mockDb.Mock.
+		ExpectQuery(`SELECT id, meeting_id, name, number, visible, advertised_start_time FROM races ORDER BY advertised_start_time LIMIT ?`).
+		WithArgs(2).
+		WillReturnRows(includedRows)
+
+	listResponse := listTestRun(t, mockDb.DB, &racing.ListRacesRequest{OrderBy: "advertised_start_time", PageSize: 2})
+
+	raceResultAssertions(t, sampleRaces, listResponse.Races, mockDb.Mock)
+
+	racingService := NewRacingService(db.NewRacesRepo(mockDb.DB), db.NewSearchRepo(mockDb.DB), nil)
+	_, err := racingService.ListRaces(context.TODO(), &racing.ListRacesRequest{PageSize: -1})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected invalid argument error, got %v", err)
+	}
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+}
+
 // Tests list prodecure with varying statuses
 func TestListRacesStatuses(t *testing.T) {
 	//Initiliase mock database
@@ -250,6 +335,41 @@ func TestListRacesStatuses(t *testing.T) {
 	raceResultAssertions(t, sampleRaces, listResponse.Races, mockDb.Mock)
 }
 
+// Tests list procedure filtering by status, which races have until they start
+func TestListRacesWithStatusFilter(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockRaceDb(t)
+	mockDb := mockDbHelper.Init()
+
+	//Races to return for expected query/args
+	sampleRaces := []*racing.Race{
+		{Id: 2, MeetingId: 9, Name: "Mock race 3", Number: 5, Visible: true, AdvertisedStartTime: timestamppb.New(time.Now().Add(time.Minute)), Status: "OPEN"},
+	}
+
+	includedRows := mockDb.Mock.NewRows(mockDb.ColumnNames)
+	for _, race := range sampleRaces {
+		includedRows.AddRow(race.Id, race.MeetingId, race.Name, race.Number, race.Visible, race.AdvertisedStartTime.AsTime())
+	}
+
+	mockDb.Mock.
+		ExpectQuery(`SELECT id, meeting_id, name, number, visible, advertised_start_time FROM races WHERE julianday(advertised_start_time) >= julianday(?)`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(includedRows)
+
+	listResponse := listTestRun(t, mockDb.DB, &racing.ListRacesRequest{Filter: &racing.ListRacesRequestFilter{Status: "open"}})
+
+	raceResultAssertions(t, sampleRaces, listResponse.Races, mockDb.Mock)
+
+	racingService := NewRacingService(db.NewRacesRepo(mockDb.DB), db.NewSearchRepo(mockDb.DB), nil)
+	_, err := racingService.ListRaces(context.TODO(), &racing.ListRacesRequest{Filter: &racing.ListRacesRequestFilter{Status: "INPROGRESS"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected invalid argument error, got %v", err)
+	}
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+}
+
 // Test getting a single race by id
 func TestGetRace(t *testing.T) {
 
@@ -286,7 +406,7 @@ func TestGetRace(t *testing.T) {
 
 	//Create service using mock db and filter
 	mockRacesRepo := db.NewRacesRepo(mockDb.DB)
-	racingService := NewRacingService(mockRacesRepo)
+	racingService := NewRacingService(mockRacesRepo, db.NewSearchRepo(mockDb.DB), nil)
 
 	//Call service
 	getRaceResponse, err := racingService.GetRace(context.TODO(), &getRaceRequest)
@@ -305,3 +425,297 @@ func TestGetRace(t *testing.T) {
 
 	raceResultAssertions(t, sampleRaces, []*racing.Race{getRaceResponse.Race}, mockDb.Mock)
 }
+
+// Tests a read mask selects only the columns needed, and returns only the fields requested
+func TestListRacesWithReadMask(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockRaceDb(t)
+	mockDb := mockDbHelper.Init()
+
+	mockTime := time.Now().Add(time.Hour)
+
+	//The start time is selected to derive the status, but not returned
+	mockDb.Mock.
+		ExpectQuery(`SELECT id, name, advertised_start_time FROM races WHERE visible = ?`).
+		WithArgs(true).
+		WillReturnRows(mockDb.Mock.NewRows([]string{"id", "name", "advertised_start_time"}).
+			AddRow(1, "Mock race 1", mockTime))
+
+	listRacesRequest := racing.ListRacesRequest{
+		Filter:   &racing.ListRacesRequestFilter{Visible: proto.Bool(true)},
+		ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"name", "status"}},
+	}
+
+	listResponse := listTestRun(t, mockDb.DB, &listRacesRequest)
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	expected := &racing.Race{Name: "Mock race 1", Status: "OPEN"}
+	if len(listResponse.Races) != 1 || !proto.Equal(listResponse.Races[0], expected) {
+		t.Errorf("Expected %v, got %v", expected, listResponse.Races)
+	}
+
+	if err := mockDb.Mock.ExpectationsWereMet(); err != nil {
+		t.Error("One or more expectations were not met")
+		t.Error(err)
+	}
+
+	//Fields races don't have are rejected
+	racingService := NewRacingService(db.NewRacesRepo(mockDb.DB), db.NewSearchRepo(mockDb.DB), nil)
+	_, err := racingService.GetRace(context.TODO(), &racing.GetRaceRequest{Id: 1, ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"jockey"}}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected invalid argument error, got %v", err)
+	}
+}
+
+// Tests races are returned in the order requested, with ids no race matched reported as not found
+func TestBatchGetRaces(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockRaceDb(t)
+	mockDb := mockDbHelper.Init()
+
+	mockTime := time.Now()
+
+	sampleRaces := []*racing.Race{
+		{Id: 2, MeetingId: 1, Name: "Mock race 1", Number: 2, Visible: true, AdvertisedStartTime: timestamppb.New(mockTime), Status: "CLOSED"},
+		{Id: 5, MeetingId: 3, Name: "Mock race 2", Number: 1, Visible: false, AdvertisedStartTime: timestamppb.New(mockTime), Status: "CLOSED"},
+	}
+
+	//The database returns races in its own order, and each id is queried once
+	includedRows := mockDb.Mock.NewRows(mockDb.ColumnNames)
+	for _, race := range sampleRaces {
+		includedRows.AddRow(race.Id, race.MeetingId, race.Name, race.Number, race.Visible, race.AdvertisedStartTime.AsTime())
+	}
+
+	mockDb.Mock.
+		ExpectQuery(`SELECT id, meeting_id, name, number, visible, advertised_start_time FROM races WHERE id IN (?,?,?)`).
+		WithArgs(5, 404, 2).
+		WillReturnRows(includedRows)
+
+	//Create service using mock db
+	racingService := NewRacingService(db.NewRacesRepo(mockDb.DB), db.NewSearchRepo(mockDb.DB), nil)
+
+	//Call service
+	response, err := racingService.BatchGetRaces(context.TODO(), &racing.BatchGetRacesRequest{Ids: []int64{5, 404, 2, 5}})
+	if err != nil {
+		t.Fatalf("Error getting races: %v", err)
+	}
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	if len(response.Results) != 4 {
+		t.Fatalf("Expected a result for each requested id, got %d", len(response.Results))
+	}
+
+	notFound := response.Results[1]
+	if notFound.Id != 404 || notFound.Found || notFound.Race != nil {
+		t.Errorf("Expected id 404 to be reported as not found, got %v", notFound)
+	}
+
+	var found []*racing.Race
+	for _, i := range []int{0, 2, 3} {
+		if !response.Results[i].Found {
+			t.Errorf("Expected id %d to be found", response.Results[i].Id)
+		}
+		found = append(found, response.Results[i].Race)
+	}
+
+	raceResultAssertions(t, []*racing.Race{sampleRaces[1], sampleRaces[0], sampleRaces[1]}, found, mockDb.Mock)
+}
+
+// Tests requesting too many races at once is rejected
+func TestBatchGetRacesTooMany(t *testing.T) {
+	racingService := NewRacingService(nil, nil, nil)
+
+	_, err := racingService.BatchGetRaces(context.TODO(), &racing.BatchGetRacesRequest{Ids: make([]int64, maxBatchIds+1)})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected invalid argument error, got %v", err)
+	}
+}
+
+// Tests races are read through the cache, querying the database once for repeated requests
+func TestGetRaceCached(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockRaceDb(t)
+	mockDb := mockDbHelper.Init()
+
+	//The race starts later, so is cached until then
+	sampleRace := &racing.Race{Id: 2, MeetingId: 1, Name: "Mock race 1", Number: 2, Visible: true, AdvertisedStartTime: timestamppb.New(time.Now().Add(time.Hour)), Status: "OPEN"}
+
+	mockDb.Mock.
+		ExpectQuery(`SELECT id, meeting_id, name, number, visible, advertised_start_time FROM races WHERE id = ?`).
+		WithArgs(2).
+		WillReturnRows(mockDb.Mock.NewRows(mockDb.ColumnNames).
+			AddRow(sampleRace.Id, sampleRace.MeetingId, sampleRace.Name, sampleRace.Number, sampleRace.Visible, sampleRace.AdvertisedStartTime.AsTime()))
+
+	//Create service using a cached repository over the mock db
+	racingService := NewRacingService(db.NewCachedRacesRepo(db.NewRacesRepo(mockDb.DB), 10, time.Minute), db.NewSearchRepo(mockDb.DB), nil)
+
+	var responseRaces []*racing.Race
+	for i := 0; i < 2; i++ {
+		getRaceResponse, err := racingService.GetRace(context.TODO(), &racing.GetRaceRequest{Id: 2})
+		if err != nil {
+			t.Fatalf("Error getting race: %v", err)
+		}
+		responseRaces = append(responseRaces, getRaceResponse.Race)
+	}
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	raceResultAssertions(t, []*racing.Race{sampleRace, sampleRace}, responseRaces, mockDb.Mock)
+}
+
+// Tests search procedure converts free text into a prefix match and returns ranked results
+func TestSearch(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockRaceDb(t)
+	mockDb := mockDbHelper.Init()
+
+	//Configure mock database for test data and expected results
+	sampleResults := []*racing.SearchResult{
+		{Type: "RACE", Id: 7, Title: "Mock race 7", Description: "Race 7", Score: 4.5},
+		{Type: "RACE", Id: 2, Title: "Mock race 2", Description: "Race 2", Score: 1.25},
+	}
+
+	includedRows := mockDb.Mock.NewRows([]string{"type", "id", "title", "description", "score"})
+	for _, result := range sampleResults {
+		includedRows.AddRow(result.Type, result.Id, result.Title, result.Description, result.Score)
+	}
+
+	mockDb.Mock.
+		ExpectQuery(`SELECT type, id, title, description, -bm25(search_index, 0.0, 0.0, 10.0, 1.0) AS score FROM search_index WHERE search_index MATCH ? ORDER BY score DESC LIMIT ?`).
+		WithArgs(`"Mock"* "race"* "7"*`, 20).
+		WillReturnRows(includedRows)
+
+	//Create service using mock db
+	racingService := NewRacingService(db.NewRacesRepo(mockDb.DB), db.NewSearchRepo(mockDb.DB), nil)
+
+	//Call service, with operators in the query treated as plain text
+	searchResponse, err := racingService.Search(context.TODO(), &racing.SearchRequest{Query: `Mock "race" 7*`})
+	if err != nil {
+		t.Fatalf("Error searching races: %v", err)
+	}
+
+	if len(searchResponse.Results) != len(sampleResults) {
+		t.Fatalf("Expected %d results, got %d", len(sampleResults), len(searchResponse.Results))
+	}
+	for i, result := range sampleResults {
+		if !proto.Equal(result, searchResponse.Results[i]) {
+			t.Errorf("Expected result %v, got %v", result, searchResponse.Results[i])
+		}
+	}
+
+	//An empty query is rejected without querying the database
+	if _, err := racingService.Search(context.TODO(), &racing.SearchRequest{Query: " "}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected invalid argument for an empty query, got %v", err)
+	}
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	if err := mockDb.Mock.ExpectationsWereMet(); err != nil {
+		t.Error("One or more expectations were not met")
+		t.Error(err)
+	}
+}
+
+// Stream of a watch call recording the updates sent, which ends the call once it has sent enough
+type mockWatchStream struct {
+	racing.Racing_WatchRacesServer
+	ctx    context.Context
+	cancel context.CancelFunc
+	sent   []*racing.WatchRacesResponse
+	limit  int
+}
+
+func newMockWatchStream(limit int) *mockWatchStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &mockWatchStream{ctx: ctx, cancel: cancel, limit: limit}
+}
+
+func (m *mockWatchStream) Context() context.Context {
+	return m.ctx
+}
+
+func (m *mockWatchStream) SendHeader(metadata.MD) error {
+	return nil
+}
+
+func (m *mockWatchStream) Send(response *racing.WatchRacesResponse) error {
+	m.sent = append(m.sent, response)
+	if len(m.sent) == m.limit {
+		m.cancel()
+	}
+	return nil
+}
+
+// Tests races starting are published, and watchers resuming are sent those matching their filter
+func TestWatchRaces(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockRaceDb(t)
+	mockDb := mockDbHelper.Init()
+
+	//Configure mock database for races starting within the window polled
+	windowStart := time.Date(2021, time.March, 2, 8, 0, 0, 0, time.UTC)
+	windowEnd := windowStart.Add(time.Second)
+
+	sampleRaces := []*racing.Race{
+		{Id: 1, MeetingId: 1, Name: "Mock race 1", Number: 2, Visible: true, AdvertisedStartTime: timestamppb.New(windowStart), Status: "CLOSED"},
+		{Id: 2, MeetingId: 9, Name: "Mock race 2", Number: 5, Visible: true, AdvertisedStartTime: timestamppb.New(windowStart), Status: "CLOSED"},
+	}
+
+	includedRows := mockDb.Mock.NewRows(mockDb.ColumnNames)
+	for _, race := range sampleRaces {
+		includedRows.AddRow(race.Id, race.MeetingId, race.Name, race.Number, race.Visible, race.AdvertisedStartTime.AsTime())
+	}
+
+	mockDb.Mock.
+		ExpectQuery(`SELECT id, meeting_id, name, number, visible, advertised_start_time FROM races WHERE julianday(advertised_start_time) >= julianday(?) AND julianday(advertised_start_time) < julianday(?) ORDER BY advertised_start_time,id`).
+		WithArgs(windowStart.Format(time.RFC3339), windowEnd.Format(time.RFC3339)).
+		WillReturnRows(includedRows)
+
+	//An update published before is resumed after, so that those published by the publisher are replayed
+	updates := feed.New(10)
+	before := updates.Publish(&racing.Race{Id: 7, MeetingId: 9})
+
+	publisher := NewStatusPublisher(db.NewRacesRepo(mockDb.DB), updates)
+	publisher.last, publisher.now = windowStart, func() time.Time { return windowEnd }
+	if err := publisher.Publish(context.TODO()); err != nil {
+		t.Fatalf("Error publishing status changes: %v", err)
+	}
+
+	racingService := NewRacingService(nil, nil, updates)
+
+	stream := newMockWatchStream(1)
+	err := racingService.WatchRaces(&racing.WatchRacesRequest{Filter: &racing.WatchRacesRequestFilter{MeetingIds: []int64{9}}, AfterId: before.Id}, stream)
+	if status.Code(err) != codes.Canceled {
+		t.Errorf("Expected the watch to end when cancelled, got %v", err)
+	}
+	if len(stream.sent) != 1 || stream.sent[0].Id != before.Id+2 || !compareRaces(stream.sent[0].Race, sampleRaces[1], t) {
+		t.Errorf("Expected race 2 to be replayed, got %v", stream.sent)
+	}
+
+	//Resuming after an id from another run reports updates were missed
+	stream = newMockWatchStream(1)
+	racingService.WatchRaces(&racing.WatchRacesRequest{AfterId: 1}, stream)
+	if len(stream.sent) != 1 || !stream.sent[0].Missed || stream.sent[0].Id != before.Id+2 {
+		t.Errorf("Expected missed updates to be reported, got %v", stream.sent)
+	}
+
+	//Closing the feed as the service shuts down ends watches for clients to resume elsewhere
+	updates.Close()
+	if err := racingService.WatchRaces(&racing.WatchRacesRequest{}, newMockWatchStream(1)); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected the watch to end as unavailable, got %v", err)
+	}
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	if err := mockDb.Mock.ExpectationsWereMet(); err != nil {
+		t.Error("One or more expectations were not met")
+		t.Error(err)
+	}
+}
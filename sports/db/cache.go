@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"git.neds.sh/matty/entain/common/repocache"
+	"git.neds.sh/matty/entain/sports/proto/sports"
+)
+
+type cachedSportsRepo struct {
+	SportsRepo
+	cache *repocache.Cache
+}
+
+// NewCachedSportsRepo wraps a sports repository with a read-through cache of up to a maximum
+// number of results, each held for at most the TTL. Results are never held past the start or
+// expected end of an event in them, when its status changes, and score updates invalidate them.
+// Status changes are listed straight from the repository, as each window is only listed once.
+func NewCachedSportsRepo(repo SportsRepo, maxEntries int, ttl time.Duration) SportsRepo {
+	return &cachedSportsRepo{SportsRepo: repo, cache: repocache.New(maxEntries, ttl)}
+}
+
+func (r *cachedSportsRepo) Get(ctx context.Context, id int64, fields []string) (*sports.Event, error) {
+	value, err := r.cache.Get(ctx, "get:"+strconv.FormatInt(id, 10)+":"+strings.Join(fields, ","), func(ctx context.Context) (interface{}, time.Time, error) {
+		event, err := r.SportsRepo.Get(ctx, id, fields)
+		if err != nil || event == nil {
+			return event, time.Time{}, err
+		}
+		return event, nextEventChange([]*sports.Event{event}), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//Callers are given copies, so that cached events can't be changed through them
+	event := value.(*sports.Event)
+	if event == nil {
+		return nil, nil
+	}
+	return proto.Clone(event).(*sports.Event), nil
+}
+
+func (r *cachedSportsRepo) List(ctx context.Context, filter *sports.ListEventsRequestFilter, order_by string, fields []string, page_size int32) ([]*sports.Event, error) {
+	key, err := proto.MarshalOptions{Deterministic: true}.Marshal(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := r.cache.Get(ctx, "list:"+order_by+":"+strings.Join(fields, ",")+":"+strconv.Itoa(int(page_size))+":"+string(key), func(ctx context.Context) (interface{}, time.Time, error) {
+		events, err := r.SportsRepo.List(ctx, filter, order_by, fields, page_size)
+		return events, nextEventChange(events), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events := value.([]*sports.Event)
+	copies := make([]*sports.Event, len(events))
+	for i, event := range events {
+		copies[i] = proto.Clone(event).(*sports.Event)
+	}
+	return copies, nil
+}
+
+// Score updates change the status of the event, so it is dropped along with every list
+// that could hold it
+func (r *cachedSportsRepo) UpdateScore(ctx context.Context, id int64, score *sports.Score) error {
+	err := r.SportsRepo.UpdateScore(ctx, id, score)
+
+	//Invalidated even if the update failed, in case it was recorded before failing
+	r.cache.Purge()
+
+	return err
+}
+
+// The earliest start or expected end of an event yet to come, or the zero time
+func nextEventChange(events []*sports.Event) time.Time {
+	var next time.Time
+	now := time.Now()
+	for _, event := range events {
+		for _, change := range []time.Time{event.GetAdvertisedStartTime().AsTime(), event.GetExpectedEndTime().AsTime()} {
+			if change.After(now) && (next.IsZero() || change.Before(next)) {
+				next = change
+			}
+		}
+	}
+	return next
+}
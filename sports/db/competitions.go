@@ -0,0 +1,216 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+
+	"git.neds.sh/matty/entain/sports/proto/sports"
+)
+
+// Competition points awarded for each result
+const (
+	winPoints  = 2
+	drawPoints = 1
+)
+
+// CompetitionsRepo provides repository access to competitions and their standings.
+type CompetitionsRepo interface {
+	// List will return a list of competitions.
+	List(ctx context.Context, filter *sports.ListCompetitionsRequestFilter) ([]*sports.Competition, error)
+
+	// Get will return an individual competition
+	Get(ctx context.Context, id int64) (*sports.Competition, error)
+
+	// Standings will return the standings of a competition computed from final results
+	Standings(ctx context.Context, id int64) ([]*sports.Standing, error)
+}
+
+type competitionsRepo struct {
+	db *sql.DB
+}
+
+// NewCompetitionsRepo creates a new competitions repository.
+func NewCompetitionsRepo(db *sql.DB) CompetitionsRepo {
+	return &competitionsRepo{db: db}
+}
+
+func (r *competitionsRepo) Get(ctx context.Context, id int64) (*sports.Competition, error) {
+	query := getSportQueries()[competitionsList] + " WHERE competition.id = ?"
+
+	rows, done, err := queries.Query(ctx, r.db, "competitions.get", query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	competitions, err := r.scanCompetitions(rows)
+	if err != nil || len(competitions) == 0 {
+		return nil, err
+	}
+
+	return competitions[0], nil
+}
+
+func (r *competitionsRepo) List(ctx context.Context, filter *sports.ListCompetitionsRequestFilter) ([]*sports.Competition, error) {
+	var (
+		err   error
+		query string
+		args  []interface{}
+	)
+
+	query = getSportQueries()[competitionsList]
+
+	query, args = r.applyFilter(query, filter)
+
+	rows, done, err := queries.Query(ctx, r.db, "competitions.list", query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	return r.scanCompetitions(rows)
+}
+
+func (r *competitionsRepo) Standings(ctx context.Context, id int64) ([]*sports.Standing, error) {
+	rows, done, err := queries.Query(ctx, r.db, "competitions.standings_teams", getSportQueries()[standingsTeams], id)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	var standings []*sports.Standing
+	standingsByTeam := make(map[int64]*sports.Standing)
+
+	for rows.Next() {
+		var standing sports.Standing
+
+		if err := rows.Scan(&standing.TeamId, &standing.TeamName); err != nil {
+			return nil, err
+		}
+
+		standings = append(standings, &standing)
+		standingsByTeam[standing.TeamId] = &standing
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	results, resultsDone, err := queries.Query(ctx, r.db, "competitions.standings_results", getSportQueries()[standingsResults], id)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsDone()
+
+	for results.Next() {
+		var homeTeamId, awayTeamId, homeScore, awayScore int64
+
+		if err := results.Scan(&homeTeamId, &awayTeamId, &homeScore, &awayScore); err != nil {
+			return nil, err
+		}
+
+		//Results against teams not entered in the competition are ignored
+		home, away := standingsByTeam[homeTeamId], standingsByTeam[awayTeamId]
+		if home == nil || away == nil {
+			continue
+		}
+
+		addResult(home, homeScore, awayScore)
+		addResult(away, awayScore, homeScore)
+	}
+	if err := results.Err(); err != nil {
+		return nil, err
+	}
+
+	sortStandings(standings)
+
+	return standings, nil
+}
+
+// Apply filters to the SQL database query
+func (r *competitionsRepo) applyFilter(query string, filter *sports.ListCompetitionsRequestFilter) (string, []interface{}) {
+	var (
+		clauses []string
+		args    []interface{}
+	)
+
+	if filter == nil {
+		return query, args
+	}
+
+	if len(filter.Sport) > 0 {
+		clauses = append(clauses, "(sport.name LIKE ?)")
+		args = append(args, "%"+filter.Sport+"%")
+	}
+
+	if len(filter.Season) > 0 {
+		clauses = append(clauses, "competition.season = ?")
+		args = append(args, filter.Season)
+	}
+
+	if len(clauses) != 0 {
+		query += " WHERE " + strings.Join(clauses, " AND ")
+	}
+
+	return query, args
+}
+
+func (m *competitionsRepo) scanCompetitions(
+	rows *sql.Rows,
+) ([]*sports.Competition, error) {
+	var competitions []*sports.Competition
+
+	for rows.Next() {
+		var competition sports.Competition
+
+		if err := rows.Scan(&competition.Id, &competition.Name, &competition.Sport, &competition.Season); err != nil {
+			return nil, err
+		}
+
+		competitions = append(competitions, &competition)
+	}
+
+	return competitions, rows.Err()
+}
+
+// Record a single final result against a team's standing
+func addResult(standing *sports.Standing, pointsFor int64, pointsAgainst int64) {
+	standing.Played++
+	standing.PointsFor += pointsFor
+	standing.PointsAgainst += pointsAgainst
+
+	switch {
+	case pointsFor > pointsAgainst:
+		standing.Won++
+		standing.CompetitionPoints += winPoints
+	case pointsFor == pointsAgainst:
+		standing.Drawn++
+		standing.CompetitionPoints += drawPoints
+	default:
+		standing.Lost++
+	}
+}
+
+// Order standings by competition points, then points difference, then points scored,
+// and number their positions
+func sortStandings(standings []*sports.Standing) {
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+
+		if a.CompetitionPoints != b.CompetitionPoints {
+			return a.CompetitionPoints > b.CompetitionPoints
+		}
+		if a.PointsFor-a.PointsAgainst != b.PointsFor-b.PointsAgainst {
+			return a.PointsFor-a.PointsAgainst > b.PointsFor-b.PointsAgainst
+		}
+		if a.PointsFor != b.PointsFor {
+			return a.PointsFor > b.PointsFor
+		}
+		return a.TeamName < b.TeamName
+	})
+
+	for i, standing := range standings {
+		standing.Position = int64(i + 1)
+	}
+}
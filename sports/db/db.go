@@ -1,6 +1,8 @@
 package db
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"syreclabs.com/go/faker"
@@ -15,6 +17,37 @@ var sport_names = [6]string{
 	"Cricket",
 }
 
+var market_types = [3]string{
+	"HEAD_TO_HEAD",
+	"LINE",
+	"TOTAL",
+}
+
+var market_names = [3]string{
+	"Head to Head",
+	"Line",
+	"Total Points",
+}
+
+var selection_names = map[string][2]string{
+	"HEAD_TO_HEAD": {"Home", "Away"},
+	"LINE":         {"Home", "Away"},
+	"TOTAL":        {"Over", "Under"},
+}
+
+// Country and IANA timezone pairs assigned to seeded venues
+var location_zones = [8][2]string{
+	{"Australia", "Australia/Brisbane"},
+	{"Australia", "Australia/Sydney"},
+	{"Australia", "Australia/Melbourne"},
+	{"Australia", "Australia/Perth"},
+	{"New Zealand", "Pacific/Auckland"},
+	{"United Kingdom", "Europe/London"},
+	{"United States", "America/New_York"},
+	{"United States", "America/Los_Angeles"},
+}
+
+const number_of_events int = 100
 const number_of_teams int = 20
 const number_of_locations int = 20
 
@@ -35,6 +68,36 @@ func (r *sportsRepo) seed() error {
 	}
 
 	err = r.createLocationTable()
+	if err != nil {
+		return err
+	}
+
+	err = r.createMarketTable()
+	if err != nil {
+		return err
+	}
+
+	err = r.createSelectionTable()
+	if err != nil {
+		return err
+	}
+
+	err = r.createScoreTable()
+	if err != nil {
+		return err
+	}
+
+	err = r.createCompetitionTable()
+	if err != nil {
+		return err
+	}
+
+	err = r.createCompetitionTeamTable()
+	if err != nil {
+		return err
+	}
+
+	err = r.createSearchIndex()
 
 	return err
 }
@@ -49,17 +112,25 @@ func (r *sportsRepo) createEventTable() error {
 			location_id INTEGER,
 			advertised_start_time DATETIME,
 			duration INTEGER,
+			competition_id INTEGER,
 			FOREIGN KEY(team_home_id) REFERENCES team(id),
 			FOREIGN KEY(team_away_id) REFERENCES team(id),
 			FOREIGN KEY(sport_id) REFERENCES sport(id),
-			FOREIGN KEY(location_id) REFERENCES location(id)
+			FOREIGN KEY(location_id) REFERENCES location(id),
+			FOREIGN KEY(competition_id) REFERENCES competition(id)
 		)`,
 	)
 	if err != nil {
 		return err
 	}
 
-	for i := 1; i <= 100; i++ {
+	//Databases seeded before competitions were introduced need the column added
+	err = addColumnIfMissing(r, "event", "competition_id", "INTEGER REFERENCES competition(id)")
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i <= number_of_events; i++ {
 		err = executeStatement(r,
 			`INSERT OR IGNORE INTO event (
 				id,
@@ -149,14 +220,28 @@ func (r *sportsRepo) createLocationTable() error {
 		`CREATE TABLE IF NOT EXISTS location (
 			id INTEGER PRIMARY KEY,
 			city TEXT,
-			capacity INTEGER
+			capacity INTEGER,
+			country TEXT,
+			timezone TEXT
 		)
 	`)
 	if err != nil {
 		return err
 	}
 
+	//Databases seeded before venues had a country and timezone need the columns added
+	err = addColumnIfMissing(r, "location", "country", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing(r, "location", "timezone", "TEXT")
+	if err != nil {
+		return err
+	}
+
 	for i := 1; i <= number_of_locations; i++ {
+		zone := location_zones[faker.RandomInt(0, len(location_zones)-1)]
+
 		err = executeStatement(r,
 			`INSERT OR IGNORE INTO location (
 				id,
@@ -170,11 +255,294 @@ func (r *sportsRepo) createLocationTable() error {
 		if err != nil {
 			return err
 		}
+
+		err = executeStatement(r,
+			`UPDATE location SET country = ?, timezone = ? WHERE id = ? AND timezone IS NULL`,
+			zone[0],
+			zone[1],
+			i,
+		)
+		if err != nil {
+			return err
+		}
 	}
 
 	return err
 }
 
+func (r *sportsRepo) createMarketTable() error {
+	err := executeStatement(r,
+		`CREATE TABLE IF NOT EXISTS market (
+			id INTEGER PRIMARY KEY,
+			event_id INTEGER,
+			name TEXT,
+			type TEXT,
+			line REAL,
+			in_play INTEGER,
+			FOREIGN KEY(event_id) REFERENCES event(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i <= number_of_events; i++ {
+		for j, market_type := range market_types {
+			var line float64
+			switch market_type {
+			case "LINE":
+				line = float64(faker.RandomInt(-20, 20)) + 0.5
+			case "TOTAL":
+				line = float64(faker.RandomInt(20, 200)) + 0.5
+			}
+
+			err = executeStatement(r,
+				`INSERT OR IGNORE INTO market (
+					id,
+					event_id,
+					name,
+					type,
+					line,
+					in_play
+				) VALUES (?,?,?,?,?,?)`,
+				((i-1)*len(market_types))+j+1,
+				i,
+				market_names[j],
+				market_type,
+				line,
+				faker.Number().Between(0, 1),
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return err
+}
+
+func (r *sportsRepo) createSelectionTable() error {
+	err := executeStatement(r,
+		`CREATE TABLE IF NOT EXISTS selection (
+			id INTEGER PRIMARY KEY,
+			market_id INTEGER,
+			name TEXT,
+			price REAL,
+			FOREIGN KEY(market_id) REFERENCES market(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	number_of_markets := number_of_events * len(market_types)
+	for i := 1; i <= number_of_markets; i++ {
+		names := selection_names[market_types[(i-1)%len(market_types)]]
+		for j, name := range names {
+			err = executeStatement(r,
+				`INSERT OR IGNORE INTO selection (
+					id,
+					market_id,
+					name,
+					price
+				) VALUES (?,?,?,?)`,
+				((i-1)*2)+j+1,
+				i,
+				name,
+				float64(faker.RandomInt(101, 500))/100,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return err
+}
+
+// Scores are only recorded once an event is underway, so the table is left empty
+func (r *sportsRepo) createScoreTable() error {
+	return executeStatement(r,
+		`CREATE TABLE IF NOT EXISTS score (
+			event_id INTEGER PRIMARY KEY,
+			home_score INTEGER,
+			away_score INTEGER,
+			period INTEGER,
+			clock TEXT,
+			final INTEGER,
+			FOREIGN KEY(event_id) REFERENCES event(id)
+		)
+	`)
+}
+
+// One competition is seeded per sport for the current season, which every event of the sport is played in
+func (r *sportsRepo) createCompetitionTable() error {
+	err := executeStatement(r,
+		`CREATE TABLE IF NOT EXISTS competition (
+			id INTEGER PRIMARY KEY,
+			name TEXT,
+			sport_id INTEGER,
+			season TEXT,
+			FOREIGN KEY(sport_id) REFERENCES sport(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i <= len(sport_names); i++ {
+		err = executeStatement(r,
+			`INSERT OR IGNORE INTO competition (
+				id,
+				name,
+				sport_id,
+				season
+			) VALUES (?,?,?,?)`,
+			i,
+			sport_names[i-1]+" Premiership",
+			i,
+			time.Now().Format("2006"),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return executeStatement(r,
+		`UPDATE event
+		SET competition_id = (SELECT competition.id FROM competition WHERE competition.sport_id = event.sport_id)
+		WHERE competition_id IS NULL`,
+	)
+}
+
+func (r *sportsRepo) createCompetitionTeamTable() error {
+	err := executeStatement(r,
+		`CREATE TABLE IF NOT EXISTS competition_team (
+			competition_id INTEGER,
+			team_id INTEGER,
+			PRIMARY KEY(competition_id, team_id),
+			FOREIGN KEY(competition_id) REFERENCES competition(id),
+			FOREIGN KEY(team_id) REFERENCES team(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	//Enter each team in the competitions of the sports they have events in
+	return executeStatement(r,
+		`INSERT OR IGNORE INTO competition_team (competition_id, team_id)
+		SELECT competition_id, team_home_id FROM event WHERE competition_id IS NOT NULL
+		UNION
+		SELECT competition_id, team_away_id FROM event WHERE competition_id IS NOT NULL`,
+	)
+}
+
+// Tables that feed the search index. Writes to a table re-index its own rows when it is
+// indexed, and the events whose indexed text includes its names.
+var search_sources = []struct {
+	table       string
+	kind        string
+	view        string
+	eventsWhere string
+}{
+	{"event", "EVENT", "event_search", ""},
+	{"team", "TEAM", "team_search", "team_home_id = %[1]s.id OR team_away_id = %[1]s.id"},
+	{"location", "LOCATION", "location_search", "location_id = %[1]s.id"},
+	{"sport", "", "", "sport_id = %[1]s.id"},
+	{"competition", "", "", "competition_id = %[1]s.id"},
+}
+
+// Create the full-text search index over events, teams and venues. Triggers keep the index
+// in sync with writes to the tables it is built from, and the index is rebuilt on start up
+// so that databases seeded before it existed are indexed too.
+func (r *sportsRepo) createSearchIndex() error {
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(type UNINDEXED, id UNINDEXED, title, description, tokenize = 'porter unicode61')`,
+		`CREATE VIEW IF NOT EXISTS event_search AS
+			SELECT
+				event.id,
+				team_home.name || ' v ' || team_away.name AS title,
+				sport.name || ' at ' || location.city || ifnull(', ' || competition.name, '') AS description
+			FROM event
+			INNER JOIN team AS team_home ON event.team_home_id = team_home.id
+			INNER JOIN team AS team_away ON event.team_away_id = team_away.id
+			INNER JOIN sport ON event.sport_id = sport.id
+			INNER JOIN location ON event.location_id = location.id
+			LEFT JOIN competition ON event.competition_id = competition.id`,
+		`CREATE VIEW IF NOT EXISTS team_search AS SELECT id, name AS title, 'Rank ' || rank AS description FROM team`,
+		`CREATE VIEW IF NOT EXISTS location_search AS SELECT id, city AS title, ifnull(country, '') AS description FROM location`,
+	}
+
+	for _, source := range search_sources {
+		for _, operation := range []string{"INSERT", "UPDATE", "DELETE"} {
+			var rows []string
+			switch operation {
+			case "INSERT":
+				rows = []string{"new"}
+			case "UPDATE":
+				rows = []string{"old", "new"}
+			case "DELETE":
+				rows = []string{"old"}
+			}
+
+			var body string
+			for _, row := range rows {
+				if len(source.kind) > 0 {
+					body += reindexSearch(source.kind, source.view, row+".id")
+				}
+				if len(source.eventsWhere) > 0 {
+					body += reindexSearch("EVENT", "event_search", "SELECT id FROM event WHERE "+fmt.Sprintf(source.eventsWhere, row))
+				}
+			}
+
+			statements = append(statements, fmt.Sprintf(
+				"CREATE TRIGGER IF NOT EXISTS %s_search_%s AFTER %s ON %s BEGIN %s END",
+				source.table, strings.ToLower(operation), operation, source.table, body,
+			))
+		}
+	}
+
+	statements = append(statements, `DELETE FROM search_index`)
+	for _, source := range search_sources {
+		if len(source.kind) > 0 {
+			statements = append(statements, fmt.Sprintf(
+				"INSERT INTO search_index(type, id, title, description) SELECT '%s', id, title, description FROM %s",
+				source.kind, source.view,
+			))
+		}
+	}
+
+	for _, statement := range statements {
+		if err := executeStatement(r, statement); err != nil {
+			return fmt.Errorf("creating search index, the service must be built with -tags sqlite_fts5: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Trigger statements replacing the search index entries of a type for the given ids
+func reindexSearch(kind string, view string, ids string) string {
+	return fmt.Sprintf(
+		"DELETE FROM search_index WHERE type = '%[1]s' AND id IN (%[3]s); "+
+			"INSERT INTO search_index(type, id, title, description) SELECT '%[1]s', id, title, description FROM %[2]s WHERE id IN (%[3]s); ",
+		kind, view, ids,
+	)
+}
+
+// Add a column to an existing table if it was created before the column was introduced
+func addColumnIfMissing(r *sportsRepo, table string, column string, definition string) error {
+	var count int
+
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	return executeStatement(r, "ALTER TABLE "+table+" ADD COLUMN "+column+" "+definition)
+}
+
 func executeStatement(r *sportsRepo, statement string, args ...any) error {
 	s, err := r.db.Prepare(statement)
 	if err == nil {
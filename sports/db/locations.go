@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	// Embed the timezone database so local times do not depend on the host having zoneinfo installed
+	_ "time/tzdata"
+
+	"git.neds.sh/matty/entain/sports/proto/sports"
+)
+
+// LocationsRepo provides repository access to venues.
+type LocationsRepo interface {
+	// List will return a list of venues.
+	List(ctx context.Context, filter *sports.ListLocationsRequestFilter, order_by string) ([]*sports.Location, error)
+
+	// Get will return an individual venue
+	Get(ctx context.Context, id int64) (*sports.Location, error)
+}
+
+type locationsRepo struct {
+	db *sql.DB
+}
+
+// NewLocationsRepo creates a new locations repository.
+func NewLocationsRepo(db *sql.DB) LocationsRepo {
+	return &locationsRepo{db: db}
+}
+
+func (r *locationsRepo) Get(ctx context.Context, id int64) (*sports.Location, error) {
+	query := getSportQueries()[locationsList] + " WHERE id = ?"
+
+	rows, done, err := queries.Query(ctx, r.db, "locations.get", query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	locations, err := r.scanLocations(rows)
+	if err != nil || len(locations) == 0 {
+		return nil, err
+	}
+
+	return locations[0], nil
+}
+
+func (r *locationsRepo) List(ctx context.Context, filter *sports.ListLocationsRequestFilter, order_by string) ([]*sports.Location, error) {
+	var (
+		err   error
+		query string
+		args  []interface{}
+	)
+
+	query = getSportQueries()[locationsList]
+
+	query, args = r.applyFilter(query, filter)
+
+	query = r.applySort(query, order_by)
+
+	rows, done, err := queries.Query(ctx, r.db, "locations.list", query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	return r.scanLocations(rows)
+}
+
+func (r *locationsRepo) applyFilter(query string, filter *sports.ListLocationsRequestFilter) (string, []interface{}) {
+	var (
+		clauses []string
+		args    []interface{}
+	)
+
+	if filter == nil {
+		return query, args
+	}
+
+	if len(filter.Country) > 0 {
+		clauses = append(clauses, "country LIKE ?")
+		args = append(args, filter.Country)
+	}
+
+	if filter.MinCapacity > 0 {
+		clauses = append(clauses, "capacity >= ?")
+		args = append(args, filter.MinCapacity)
+	}
+
+	if len(clauses) != 0 {
+		query += " WHERE " + strings.Join(clauses, " AND ")
+	}
+
+	return query, args
+}
+
+// If order_by parameter is provided, send through to the SQL query
+func (r *locationsRepo) applySort(query string, order_by string) string {
+
+	if len(order_by) > 0 {
+		sanitised_order_by := sanitiseOrderBy(order_by)
+		if len(sanitised_order_by) > 0 {
+			query += " ORDER BY " + sanitised_order_by
+		}
+	}
+
+	return query
+}
+
+func (m *locationsRepo) scanLocations(
+	rows *sql.Rows,
+) ([]*sports.Location, error) {
+	var locations []*sports.Location
+
+	for rows.Next() {
+		var location sports.Location
+		var country, timezone sql.NullString
+
+		if err := rows.Scan(&location.Id, &location.City, &country, &timezone, &location.Capacity); err != nil {
+			return nil, err
+		}
+
+		location.Country = country.String
+		location.Timezone = timezone.String
+
+		locations = append(locations, &location)
+	}
+
+	return locations, rows.Err()
+}
+
+// Convert a time to the timezone of a venue, returning the timezone applied and the
+// local time formatted as RFC 3339. Venues without a known timezone fall back to UTC.
+func localTime(t time.Time, timezone string) (string, string) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil || len(timezone) == 0 {
+		location = time.UTC
+	}
+
+	return location.String(), t.In(location).Format(time.RFC3339)
+}
@@ -0,0 +1,251 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"git.neds.sh/matty/entain/sports/proto/sports"
+)
+
+// MarketsRepo provides repository access to betting markets.
+type MarketsRepo interface {
+	// List will return a list of markets.
+	List(ctx context.Context, filter *sports.ListMarketsRequestFilter, order_by string) ([]*sports.Market, error)
+
+	// Get will return an individual market
+	Get(ctx context.Context, id int64) (*sports.Market, error)
+}
+
+type marketsRepo struct {
+	db *sql.DB
+}
+
+// NewMarketsRepo creates a new markets repository.
+func NewMarketsRepo(db *sql.DB) MarketsRepo {
+	return &marketsRepo{db: db}
+}
+
+func (r *marketsRepo) Get(ctx context.Context, id int64) (*sports.Market, error) {
+	var (
+		err   error
+		query string
+		args  []interface{}
+	)
+
+	query = getSportQueries()[marketsList]
+
+	query, args = r.applyGet(query, id)
+
+	rows, done, err := queries.Query(ctx, r.db, "markets.get", query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	markets, err := r.scanMarkets(rows)
+	if err != nil || len(markets) == 0 {
+		return nil, err
+	}
+
+	if err := r.attachSelections(ctx, markets); err != nil {
+		return nil, err
+	}
+
+	return markets[0], nil
+}
+
+func (r *marketsRepo) List(ctx context.Context, filter *sports.ListMarketsRequestFilter, order_by string) ([]*sports.Market, error) {
+	var (
+		err   error
+		query string
+		args  []interface{}
+	)
+
+	query = getSportQueries()[marketsList]
+
+	query, args = r.applyDbFilter(query, filter)
+
+	query = r.applySort(query, order_by)
+
+	rows, done, err := queries.Query(ctx, r.db, "markets.list", query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	markets, err := r.scanMarkets(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	markets = r.applyDerivedFilter(markets, filter)
+
+	if err := r.attachSelections(ctx, markets); err != nil {
+		return nil, err
+	}
+
+	return markets, nil
+}
+
+func (r *marketsRepo) applyGet(query string, id int64) (string, []interface{}) {
+	var args []interface{}
+	args = append(args, id)
+	query += " WHERE market.id = ?"
+	return query, args
+}
+
+// Apply filters that apply directly to the SQL database query
+func (r *marketsRepo) applyDbFilter(query string, filter *sports.ListMarketsRequestFilter) (string, []interface{}) {
+	var (
+		clauses []string
+		args    []interface{}
+	)
+
+	if filter == nil {
+		return query, args
+	}
+
+	if len(filter.EventIds) > 0 {
+		clauses = append(clauses, "market.event_id IN ("+strings.Repeat("?,", len(filter.EventIds)-1)+"?)")
+
+		for _, eventID := range filter.EventIds {
+			args = append(args, eventID)
+		}
+	}
+
+	if len(filter.Type) > 0 {
+		clauses = append(clauses, "market.type = ?")
+		args = append(args, strings.ToUpper(filter.Type))
+	}
+
+	if len(clauses) != 0 {
+		query += " WHERE " + strings.Join(clauses, " AND ")
+	}
+
+	return query, args
+}
+
+// Apply filters that apply to derived or calculated attribtues
+func (r *marketsRepo) applyDerivedFilter(markets []*sports.Market, filter *sports.ListMarketsRequestFilter) []*sports.Market {
+	var matchingMarkets []*sports.Market
+
+	if filter != nil && len(filter.Status) > 0 {
+		for _, market := range markets {
+			if strings.EqualFold(market.Status, filter.Status) {
+				matchingMarkets = append(matchingMarkets, market)
+			}
+		}
+		markets = matchingMarkets
+	}
+
+	return markets
+}
+
+// If order_by parameter is provided, send through to the SQL query
+func (r *marketsRepo) applySort(query string, order_by string) string {
+
+	if len(order_by) > 0 {
+		sanitised_order_by := sanitiseOrderBy(order_by)
+		if len(sanitised_order_by) > 0 {
+			query += " ORDER BY " + sanitised_order_by
+		}
+	}
+
+	return query
+}
+
+// Load the selections for each market with a single query and attach them to their market
+func (r *marketsRepo) attachSelections(ctx context.Context, markets []*sports.Market) error {
+	if len(markets) == 0 {
+		return nil
+	}
+
+	var args []interface{}
+	marketsById := make(map[int64]*sports.Market, len(markets))
+	for _, market := range markets {
+		marketsById[market.Id] = market
+		args = append(args, market.Id)
+	}
+
+	query := getSportQueries()[selectionsList] +
+		" WHERE market_id IN (" + strings.Repeat("?,", len(args)-1) + "?) ORDER BY id"
+
+	rows, done, err := queries.Query(ctx, r.db, "selections.list", query, args...)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	for rows.Next() {
+		var selection sports.Selection
+
+		if err := rows.Scan(&selection.Id, &selection.MarketId, &selection.Name, &selection.Price); err != nil {
+			return err
+		}
+
+		if market, ok := marketsById[selection.MarketId]; ok {
+			market.Selections = append(market.Selections, &selection)
+		}
+	}
+
+	return rows.Err()
+}
+
+func (m *marketsRepo) scanMarkets(
+	rows *sql.Rows,
+) ([]*sports.Market, error) {
+	var markets []*sports.Market
+	requestTime := time.Now()
+
+	for rows.Next() {
+		market, err := m.scanMarket(rows, requestTime)
+		if err != nil {
+			return nil, err
+		}
+		markets = append(markets, market)
+	}
+
+	return markets, rows.Err()
+}
+
+func (m *marketsRepo) scanMarket(rows *sql.Rows, requestTime time.Time) (*sports.Market, error) {
+	var market sports.Market
+	var advertisedStart time.Time
+	var duration int
+	var final sql.NullBool
+
+	if err := rows.Scan(&market.Id, &market.EventId, &market.Name, &market.Type, &market.Line, &market.InPlay, &advertisedStart, &duration, &final); err != nil {
+		return nil, err
+	}
+
+	//Only the final flag of the score is needed to derive the event status
+	var score *sports.Score
+	if final.Valid {
+		score = &sports.Score{Final: final.Bool}
+	}
+
+	expectedEnd := advertisedStart.Add(time.Minute * time.Duration(duration))
+	eventStatus := getEventStatus(&advertisedStart, &expectedEnd, score, &requestTime)
+
+	market.Status = getMarketStatus(eventStatus, market.InPlay)
+
+	return &market, nil
+}
+
+// Markets follow the status of their event, except that markets not flagged
+// as in-play are suspended while the event is in progress
+func getMarketStatus(eventStatus string, inPlay bool) string {
+	switch eventStatus {
+	case "OPEN":
+		return "OPEN"
+	case "INPROGRESS":
+		if inPlay {
+			return "OPEN"
+		}
+		return "SUSPENDED"
+	default:
+		return "CLOSED"
+	}
+}
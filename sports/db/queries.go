@@ -1,30 +1,227 @@
 package db
 
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"git.neds.sh/matty/entain/common/sqlquery"
+	"git.neds.sh/matty/entain/sports/proto/sports"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Runs the repositories' queries, timing them for the service's metrics and tracing them
+var queries = sqlquery.NewQueries(prometheus.DefaultRegisterer)
+
 const (
-	eventsList = "list"
+	marketsList      = "markets"
+	selectionsList   = "selections"
+	scoreUpsert      = "score"
+	teamsList        = "teams"
+	competitionsList = "competitions"
+	standingsTeams   = "standings_teams"
+	standingsResults = "standings_results"
+	locationsList    = "locations"
+	searchIndex      = "search"
 )
 
+// Values scanned from a row of the events query
+type eventRow struct {
+	event                               sports.Event
+	homeTeam, awayTeam, sport, location sports.Reference
+	competitionId                       sql.NullInt64
+	competitionName                     sql.NullString
+	advertisedStart                     time.Time
+	duration                            int
+	homeScore, awayScore, period        sql.NullInt64
+	clock, timezone                     sql.NullString
+	final                               sql.NullBool
+}
+
+// A column of the events query, with the table joined for it and the event fields it is
+// needed for, or none if always needed
+type eventColumn struct {
+	expression string
+	join       string
+	fields     []string
+	dest       func(row *eventRow) interface{}
+}
+
+var eventColumns = []eventColumn{
+	{"event.id", "", nil, func(row *eventRow) interface{} { return &row.event.Id }},
+	{"team_home.id", "team_home", []string{"home_team"}, func(row *eventRow) interface{} { return &row.homeTeam.Id }},
+	{"team_home.name as home_team", "team_home", []string{"home_team"}, func(row *eventRow) interface{} { return &row.homeTeam.Name }},
+	{"team_away.id", "team_away", []string{"away_team"}, func(row *eventRow) interface{} { return &row.awayTeam.Id }},
+	{"team_away.name as away_team", "team_away", []string{"away_team"}, func(row *eventRow) interface{} { return &row.awayTeam.Name }},
+	{"sport.id", "sport", []string{"sport"}, func(row *eventRow) interface{} { return &row.sport.Id }},
+	{"sport.name as sport", "sport", []string{"sport"}, func(row *eventRow) interface{} { return &row.sport.Name }},
+	{"location.id", "location", []string{"location"}, func(row *eventRow) interface{} { return &row.location.Id }},
+	{"location.city as location", "location", []string{"location"}, func(row *eventRow) interface{} { return &row.location.Name }},
+	{"location.capacity", "location", []string{"capacity"}, func(row *eventRow) interface{} { return &row.event.Capacity }},
+	{"location.timezone", "location", []string{"timezone", "local_start_time"}, func(row *eventRow) interface{} { return &row.timezone }},
+	{"competition.id", "competition", []string{"competition"}, func(row *eventRow) interface{} { return &row.competitionId }},
+	{"competition.name as competition", "competition", []string{"competition"}, func(row *eventRow) interface{} { return &row.competitionName }},
+	{"event.advertised_start_time", "", []string{"advertised_start_time", "expected_end_time", "local_start_time", "status"}, func(row *eventRow) interface{} { return &row.advertisedStart }},
+	{"event.duration", "", []string{"expected_end_time", "status"}, func(row *eventRow) interface{} { return &row.duration }},
+	{"score.home_score", "score", []string{"score", "status"}, func(row *eventRow) interface{} { return &row.homeScore }},
+	{"score.away_score", "score", []string{"score", "status"}, func(row *eventRow) interface{} { return &row.awayScore }},
+	{"score.period", "score", []string{"score", "status"}, func(row *eventRow) interface{} { return &row.period }},
+	{"score.clock", "score", []string{"score", "status"}, func(row *eventRow) interface{} { return &row.clock }},
+	{"score.final", "score", []string{"score", "status"}, func(row *eventRow) interface{} { return &row.final }},
+}
+
+// Tables joined to events, in the order they are joined. Every event has a home and away team,
+// sport and location, so leaving out their inner joins doesn't change the events matched.
+var eventJoins = []struct {
+	table  string
+	clause string
+}{
+	{"team_home", "INNER JOIN team team_home ON team_home.id = event.team_home_id"},
+	{"team_away", "INNER JOIN team team_away ON team_away.id = event.team_away_id"},
+	{"sport", "INNER JOIN sport ON sport.id = event.sport_id"},
+	{"location", "INNER JOIN location ON location.id = event.location_id"},
+	{"competition", "LEFT JOIN competition ON competition.id = event.competition_id"},
+	{"score", "LEFT JOIN score ON score.event_id = event.id"},
+}
+
+// The events query selecting only the columns needed for the event fields named, joining only
+// their tables and those required by filters, or selecting every column if no fields are named,
+// along with the columns selected in order
+func eventsQuery(fields []string, requiredJoins []string) (string, []eventColumn) {
+	wanted := make(map[string]bool)
+	for _, field := range fields {
+		wanted[field] = true
+	}
+
+	joined := make(map[string]bool)
+	for _, join := range requiredJoins {
+		joined[join] = true
+	}
+
+	var (
+		columns     []eventColumn
+		expressions []string
+	)
+	for _, column := range eventColumns {
+		needed := len(fields) == 0 || len(column.fields) == 0
+		for _, field := range column.fields {
+			needed = needed || wanted[field]
+		}
+		if needed {
+			columns = append(columns, column)
+			expressions = append(expressions, column.expression)
+			joined[column.join] = true
+		}
+	}
+
+	query := "SELECT " + strings.Join(expressions, ", ") + " FROM event"
+	for _, join := range eventJoins {
+		if joined[join.table] {
+			query += " " + join.clause
+		}
+	}
+
+	return query, columns
+}
+
 func getSportQueries() map[string]string {
 	return map[string]string{
-		eventsList: `
+		marketsList: `
 			SELECT
-				event.id,
-				team_home.name as home_team,
-				team_away.name as away_team,
-				sport.name as sport,
-				location.city as location,
-				location.capacity,
+				market.id,
+				market.event_id,
+				market.name,
+				market.type,
+				market.line,
+				market.in_play,
 				event.advertised_start_time,
-				event.duration
-			FROM event
-			INNER JOIN team team_home
-				ON team_home.id = event.team_home_id
-			INNER JOIN team team_away
-				ON team_away.id = event.team_away_id
+				event.duration,
+				score.final
+			FROM market
+			INNER JOIN event
+				ON event.id = market.event_id
+			LEFT JOIN score
+				ON score.event_id = event.id
+		`,
+		selectionsList: `
+			SELECT
+				id,
+				market_id,
+				name,
+				price
+			FROM selection
+		`,
+		scoreUpsert: `
+			INSERT OR REPLACE INTO score (
+				event_id,
+				home_score,
+				away_score,
+				period,
+				clock,
+				final
+			) VALUES (?,?,?,?,?,?)
+		`,
+		teamsList: `
+			SELECT
+				team.id,
+				team.name,
+				team.rank,
+				GROUP_CONCAT(competition_team.competition_id) as competition_ids
+			FROM team
+			LEFT JOIN competition_team
+				ON competition_team.team_id = team.id
+		`,
+		competitionsList: `
+			SELECT
+				competition.id,
+				competition.name,
+				sport.name as sport,
+				competition.season
+			FROM competition
 			INNER JOIN sport
-				ON sport.id = event.sport_id
-			INNER JOIN location
-				ON location.id = event.location_id
+				ON sport.id = competition.sport_id
+		`,
+		standingsTeams: `
+			SELECT
+				team.id,
+				team.name
+			FROM competition_team
+			INNER JOIN team
+				ON team.id = competition_team.team_id
+			WHERE competition_team.competition_id = ?
+		`,
+		standingsResults: `
+			SELECT
+				event.team_home_id,
+				event.team_away_id,
+				score.home_score,
+				score.away_score
+			FROM event
+			INNER JOIN score
+				ON score.event_id = event.id
+			WHERE event.competition_id = ?
+				AND score.final = 1
+		`,
+		locationsList: `
+			SELECT
+				id,
+				city,
+				country,
+				timezone,
+				capacity
+			FROM location
+		`,
+		searchIndex: `
+			SELECT
+				type,
+				id,
+				title,
+				description,
+				-bm25(search_index, 0.0, 0.0, 10.0, 1.0) AS score
+			FROM search_index
+			WHERE search_index MATCH ?
+			ORDER BY score DESC
+			LIMIT ?
 		`,
 	}
 }
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+
+	"git.neds.sh/matty/entain/sports/proto/sports"
+)
+
+// SearchRepo provides full-text search over events, teams and venues.
+type SearchRepo interface {
+	// Search will return the best matches for a free text query, best matches first.
+	Search(ctx context.Context, query string, limit int64) ([]*sports.SearchResult, error)
+}
+
+type searchRepo struct {
+	db *sql.DB
+}
+
+// NewSearchRepo creates a new search repository.
+func NewSearchRepo(db *sql.DB) SearchRepo {
+	return &searchRepo{db: db}
+}
+
+func (r *searchRepo) Search(ctx context.Context, query string, limit int64) ([]*sports.SearchResult, error) {
+	match := matchExpression(query)
+	if len(match) == 0 {
+		return nil, nil
+	}
+
+	rows, done, err := queries.Query(ctx, r.db, "search", getSportQueries()[searchIndex], match, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	var results []*sports.SearchResult
+
+	for rows.Next() {
+		var result sports.SearchResult
+
+		if err := rows.Scan(&result.Type, &result.Id, &result.Title, &result.Description, &result.Score); err != nil {
+			return nil, err
+		}
+
+		results = append(results, &result)
+	}
+
+	return results, rows.Err()
+}
+
+// Convert free text into an FTS5 match expression where every word must match as a prefix.
+// Words are quoted so that FTS5 operators and syntax in the input are matched literally.
+func matchExpression(query string) string {
+	re := regexp.MustCompile(`[\pL\pN]+`)
+
+	var terms []string
+	for _, word := range re.FindAllString(query, -1) {
+		terms = append(terms, `"`+word+`"*`)
+	}
+
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,106 @@
+//go:build sqlite_fts5
+// +build sqlite_fts5
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"git.neds.sh/matty/entain/sports/proto/sports"
+)
+
+// Opens a seeded in-memory database. Each connection to :memory: is a separate database,
+// so the pool is held to one connection.
+func newTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if err := NewSportsRepo(db).Init(); err != nil {
+		t.Fatalf("Error seeding database: %v", err)
+	}
+	return db
+}
+
+func exec(t *testing.T, db *sql.DB, statement string, args ...interface{}) {
+	if _, err := db.Exec(statement, args...); err != nil {
+		t.Fatalf("Error executing %q: %v", statement, err)
+	}
+}
+
+func search(t *testing.T, repo SearchRepo, query string) []*sports.SearchResult {
+	results, err := repo.Search(context.Background(), query, 200)
+	if err != nil {
+		t.Fatalf("Error searching for %q: %v", query, err)
+	}
+	return results
+}
+
+// Counts results of each type, checking they are in descending order of score
+func countResults(t *testing.T, results []*sports.SearchResult) map[string]int {
+	counts := make(map[string]int)
+	for i, result := range results {
+		counts[result.Type]++
+		if result.Score <= 0 || (i > 0 && result.Score > results[i-1].Score) {
+			t.Errorf("Expected descending positive scores, got %v", results)
+		}
+	}
+	return counts
+}
+
+// Tests matches are ranked by bm25, so a team named by the query comes before the events it plays in
+func TestSearchRanking(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewSearchRepo(db)
+
+	exec(t, db, `UPDATE team SET name = 'Quokkas' WHERE id = 1`)
+	exec(t, db, `INSERT INTO event(id, team_home_id, team_away_id, sport_id, location_id, advertised_start_time, duration) VALUES (101, 1, 11, 1, 1, '2021-03-02T08:30:00Z', 90)`)
+
+	//Events are only indexed along with their sport, which some seeded events have none of
+	var events int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM event INNER JOIN sport ON sport.id = event.sport_id WHERE team_home_id = 1 OR team_away_id = 1`).Scan(&events); err != nil {
+		t.Fatalf("Error counting events: %v", err)
+	}
+
+	results := search(t, repo, "quok")
+	counts := countResults(t, results)
+	if len(results) == 0 || results[0].Type != "TEAM" || results[0].Id != 1 || counts["TEAM"] != 1 || counts["EVENT"] != events {
+		t.Errorf("Expected the team first then the %d events it plays in, got %v", events, results)
+	}
+}
+
+// Tests the triggers keep the index in sync as rows it is built from are inserted, updated and
+// deleted, including events reindexed when a team or venue they refer to is renamed
+func TestSearchSync(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewSearchRepo(db)
+
+	exec(t, db, `INSERT INTO team(id, name, rank) VALUES (21, 'Numbats', 1)`)
+	exec(t, db, `INSERT INTO event(id, team_home_id, team_away_id, sport_id, location_id, advertised_start_time, duration) VALUES (101, 21, 11, 1, 1, '2021-03-02T08:30:00Z', 90)`)
+	if counts := countResults(t, search(t, repo, "numbats")); counts["TEAM"] != 1 || counts["EVENT"] != 1 {
+		t.Fatalf("Expected the inserted team and event to be indexed, got %v", counts)
+	}
+
+	exec(t, db, `UPDATE team SET name = 'Bilbies' WHERE id = 21`)
+	if results := search(t, repo, "numbats"); len(results) != 0 {
+		t.Errorf("Expected the old name to be removed from the index, got %v", results)
+	}
+	if counts := countResults(t, search(t, repo, "bilbies")); counts["TEAM"] != 1 || counts["EVENT"] != 1 {
+		t.Errorf("Expected the team and its event to be reindexed with the new name, got %v", counts)
+	}
+
+	exec(t, db, `UPDATE location SET city = 'Wollongbar' WHERE id = 1`)
+	if results := search(t, repo, "bilbies wollongbar"); len(results) != 1 || results[0].Id != 101 {
+		t.Errorf("Expected the event to be reindexed with its venue's new city, got %v", results)
+	}
+
+	exec(t, db, `DELETE FROM event WHERE id = 101`)
+	if counts := countResults(t, search(t, repo, "bilbies")); counts["TEAM"] != 1 || counts["EVENT"] != 0 {
+		t.Errorf("Expected the deleted event to be removed from the index, got %v", counts)
+	}
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"regexp"
 	"strings"
@@ -18,11 +19,21 @@ type SportsRepo interface {
 	// Init will initialise our sports repository.
 	Init() error
 
-	// List will return a list of events.
-	List(filter *sports.ListEventsRequestFilter, order_by string) ([]*sports.Event, error)
+	// List will return a list of events, selecting only what the fields named need, or everything if none are,
+	// and at most page_size events, or every event if 0.
+	List(ctx context.Context, filter *sports.ListEventsRequestFilter, order_by string, fields []string, page_size int32) ([]*sports.Event, error)
 
-	// Get will return an individual event
-	Get(id int64) (*sports.Event, error)
+	// Get will return an individual event, selecting only what the fields named need, or everything if none are.
+	Get(ctx context.Context, id int64, fields []string) (*sports.Event, error)
+
+	// BatchGet will return the events matching a list of ids, in no particular order
+	BatchGet(ctx context.Context, ids []int64) ([]*sports.Event, error)
+
+	// UpdateScore will record the live score of an event
+	UpdateScore(ctx context.Context, id int64, score *sports.Score) error
+
+	// ListStatusChanges will return the events whose status changed within a window, which are those starting or expected to end within it
+	ListStatusChanges(ctx context.Context, from time.Time, before time.Time) ([]*sports.Event, error)
 }
 
 type sportsRepo struct {
@@ -47,56 +58,119 @@ func (r *sportsRepo) Init() error {
 	return err
 }
 
-func (r *sportsRepo) Get(id int64) (*sports.Event, error) {
+func (r *sportsRepo) Get(ctx context.Context, id int64, fields []string) (*sports.Event, error) {
 	var (
 		err   error
 		query string
 		args  []interface{}
 	)
 
-	query = getSportQueries()[eventsList]
+	query, columns := eventsQuery(fields, nil)
 
 	query, args = r.applyGet(query, id)
 
-	rows, err := r.db.Query(query, args...)
+	rows, done, err := queries.Query(ctx, r.db, "events.get", query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer done()
 
 	if !rows.Next() {
 		return nil, nil
 	}
-	return r.scanEvent(rows, time.Now())
+	return r.scanEvent(rows, columns, time.Now())
+}
+
+func (r *sportsRepo) BatchGet(ctx context.Context, ids []int64) ([]*sports.Event, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	query, columns := eventsQuery(nil, nil)
+
+	query, args := r.applyBatchGet(query, ids)
+
+	rows, done, err := queries.Query(ctx, r.db, "events.batch_get", query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	return r.scanEvents(rows, columns)
 }
 
-func (r *sportsRepo) List(filter *sports.ListEventsRequestFilter, order_by string) ([]*sports.Event, error) {
+func (r *sportsRepo) List(ctx context.Context, filter *sports.ListEventsRequestFilter, order_by string, fields []string, page_size int32) ([]*sports.Event, error) {
 	var (
 		err   error
 		query string
 		args  []interface{}
 	)
 
-	query = getSportQueries()[eventsList]
+	fields, joins := r.applyNeeds(filter, order_by, fields)
+
+	query, columns := eventsQuery(fields, joins)
 
 	query, args = r.applyDbFilter(query, filter)
 
 	query = r.applySort(query, order_by)
 
-	rows, err := r.db.Query(query, args...)
+	//Events filtered by their derived status can only be limited once they have been filtered
+	derived := filter != nil && len(filter.Status) > 0
+	if !derived {
+		query, args = r.applyLimit(query, args, page_size)
+	}
+
+	rows, done, err := queries.Query(ctx, r.db, "events.list", query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer done()
 
-	events, err := r.scanEvents(rows)
+	events, err := r.scanEvents(rows, columns)
 	if err != nil {
 		return nil, err
 	}
 
 	events = r.applyDerivedFilter(events, filter)
 
+	if derived && page_size > 0 && len(events) > int(page_size) {
+		events = events[:page_size]
+	}
+
 	return events, err
 }
 
+func (r *sportsRepo) UpdateScore(ctx context.Context, id int64, score *sports.Score) error {
+	return queries.Exec(ctx, r.db, "events.update_score",
+		getSportQueries()[scoreUpsert],
+		id,
+		score.HomeScore,
+		score.AwayScore,
+		score.Period,
+		score.Clock,
+		score.Final,
+	)
+}
+
+func (r *sportsRepo) ListStatusChanges(ctx context.Context, from time.Time, before time.Time) ([]*sports.Event, error) {
+	query, columns := eventsQuery(nil, nil)
+
+	//Durations are in minutes, and julian days are days
+	query += " WHERE (julianday(event.advertised_start_time) >= julianday(?) AND julianday(event.advertised_start_time) < julianday(?))" +
+		" OR (julianday(event.advertised_start_time) + event.duration / 1440.0 >= julianday(?) AND julianday(event.advertised_start_time) + event.duration / 1440.0 < julianday(?))" +
+		" ORDER BY event.advertised_start_time, event.id"
+
+	window := []interface{}{from.Format(time.RFC3339), before.Format(time.RFC3339)}
+
+	rows, done, err := queries.Query(ctx, r.db, "events.status_changes", query, append(window, window...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	return r.scanEvents(rows, columns)
+}
+
 func (r *sportsRepo) applyGet(query string, id int64) (string, []interface{}) {
 	var args []interface{}
 	args = append(args, id)
@@ -104,6 +178,50 @@ func (r *sportsRepo) applyGet(query string, id int64) (string, []interface{}) {
 	return query, args
 }
 
+func (r *sportsRepo) applyBatchGet(query string, ids []int64) (string, []interface{}) {
+	var args []interface{}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	query += " WHERE event.id IN (" + strings.Repeat("?,", len(ids)-1) + "?)"
+	return query, args
+}
+
+// Add the fields and joins filters and sorting need to those requested, selecting every column
+// when sorting by anything but the start time, as it could be any of them
+func (r *sportsRepo) applyNeeds(filter *sports.ListEventsRequestFilter, order_by string, fields []string) ([]string, []string) {
+	var joins []string
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	for _, order := range strings.Split(sanitiseOrderBy(order_by), ",") {
+		if column := strings.Fields(order); len(column) > 0 && column[0] != "advertised_start_time" {
+			return nil, nil
+		}
+	}
+
+	if filter == nil {
+		return fields, joins
+	}
+
+	if len(filter.Query) > 0 {
+		joins = append(joins, "team_home", "team_away", "sport", "location")
+	}
+
+	if filter.MinCapacity > 0 {
+		joins = append(joins, "location")
+	}
+
+	//Statuses are derived after the query, so the columns they are derived from are needed
+	if len(filter.Status) > 0 {
+		fields = append(append([]string{}, fields...), "status")
+	}
+
+	return fields, joins
+}
+
 // Apply filters that apply directly to the SQL database query
 func (r *sportsRepo) applyDbFilter(query string, filter *sports.ListEventsRequestFilter) (string, []interface{}) {
 	var (
@@ -115,14 +233,63 @@ func (r *sportsRepo) applyDbFilter(query string, filter *sports.ListEventsReques
 		return query, args
 	}
 
-	if len(filter.Sport) > 0 {
-		clauses = append(clauses, "(sport.name LIKE ?)")
-		args = append(args, "%"+filter.Sport+"%")
+	if len(filter.Query) > 0 {
+		clauses = append(clauses, "(team_home.name LIKE ? OR team_away.name LIKE ? OR sport.name LIKE ? OR location.city LIKE ?)")
+		for i := 0; i < 4; i++ {
+			args = append(args, "%"+filter.Query+"%")
+		}
+	}
+
+	if len(filter.SportIds) > 0 {
+		clauses = append(clauses, "event.sport_id IN ("+strings.Repeat("?,", len(filter.SportIds)-1)+"?)")
+
+		for _, sportID := range filter.SportIds {
+			args = append(args, sportID)
+		}
+	}
+
+	if len(filter.TeamIds) > 0 {
+		placeholders := strings.Repeat("?,", len(filter.TeamIds)-1) + "?"
+		clauses = append(clauses, "(event.team_home_id IN ("+placeholders+") OR event.team_away_id IN ("+placeholders+"))")
+
+		for _, teamID := range filter.TeamIds {
+			args = append(args, teamID)
+		}
+		for _, teamID := range filter.TeamIds {
+			args = append(args, teamID)
+		}
+	}
+
+	if len(filter.CompetitionIds) > 0 {
+		clauses = append(clauses, "event.competition_id IN ("+strings.Repeat("?,", len(filter.CompetitionIds)-1)+"?)")
+
+		for _, competitionID := range filter.CompetitionIds {
+			args = append(args, competitionID)
+		}
 	}
 
-	if len(filter.Team) > 0 {
-		clauses = append(clauses, "(home_team LIKE ? OR away_team LIKE ?)")
-		args = append(args, "%"+filter.Team+"%", "%"+filter.Team+"%")
+	if len(filter.LocationIds) > 0 {
+		clauses = append(clauses, "event.location_id IN ("+strings.Repeat("?,", len(filter.LocationIds)-1)+"?)")
+
+		for _, locationID := range filter.LocationIds {
+			args = append(args, locationID)
+		}
+	}
+
+	if filter.MinCapacity > 0 {
+		clauses = append(clauses, "location.capacity >= ?")
+		args = append(args, filter.MinCapacity)
+	}
+
+	//Start times are stored with their offset, so they are compared as instants rather than text
+	if filter.StartFrom != nil {
+		clauses = append(clauses, "julianday(event.advertised_start_time) >= julianday(?)")
+		args = append(args, filter.StartFrom.AsTime().Format(time.RFC3339))
+	}
+
+	if filter.StartBefore != nil {
+		clauses = append(clauses, "julianday(event.advertised_start_time) < julianday(?)")
+		args = append(args, filter.StartBefore.AsTime().Format(time.RFC3339))
 	}
 
 	if len(clauses) != 0 {
@@ -161,6 +328,16 @@ func (r *sportsRepo) applySort(query string, order_by string) string {
 	return query
 }
 
+// If a page size is provided, return at most that many events
+func (r *sportsRepo) applyLimit(query string, args []interface{}, page_size int32) (string, []interface{}) {
+	if page_size > 0 {
+		query += " LIMIT ?"
+		args = append(args, page_size)
+	}
+
+	return query, args
+}
+
 // Sanitise sort order input to prevent sql injection
 func sanitiseOrderBy(order_by string) string {
 	orders_in := strings.Split(order_by, ",")
@@ -195,12 +372,13 @@ func sanitiseOrderBy(order_by string) string {
 
 func (m *sportsRepo) scanEvents(
 	rows *sql.Rows,
+	columns []eventColumn,
 ) ([]*sports.Event, error) {
 	var events []*sports.Event
 	requestTime := time.Now()
 
 	for rows.Next() {
-		event, err := m.scanEvent(rows, requestTime)
+		event, err := m.scanEvent(rows, columns, requestTime)
 		if err != nil {
 			return nil, err
 		}
@@ -210,12 +388,17 @@ func (m *sportsRepo) scanEvents(
 	return events, nil
 }
 
-func (m *sportsRepo) scanEvent(rows *sql.Rows, requestTime time.Time) (*sports.Event, error) {
-	var event sports.Event
-	var advertisedStart time.Time
-	var duration int
+// Fields whose columns weren't selected are left with whatever is derived from empty values,
+// for the service to clear
+func (m *sportsRepo) scanEvent(rows *sql.Rows, columns []eventColumn, requestTime time.Time) (*sports.Event, error) {
+	var row eventRow
+
+	dest := make([]interface{}, len(columns))
+	for i, column := range columns {
+		dest[i] = column.dest(&row)
+	}
 
-	if err := rows.Scan(&event.Id, &event.HomeTeam, &event.AwayTeam, &event.Sport, &event.Location, &event.Capacity, &advertisedStart, &duration); err != nil {
+	if err := rows.Scan(dest...); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -223,22 +406,56 @@ func (m *sportsRepo) scanEvent(rows *sql.Rows, requestTime time.Time) (*sports.E
 		return nil, err
 	}
 
+	event := &row.event
+	event.HomeTeam = &row.homeTeam
+	event.AwayTeam = &row.awayTeam
+	event.Sport = &row.sport
+	event.Location = &row.location
+
+	//Not every event is played as part of a competition
+	if row.competitionId.Valid {
+		event.Competition = &sports.Reference{Id: row.competitionId.Int64, Name: row.competitionName.String}
+	}
+
+	advertisedStart := row.advertisedStart
 	ts := timestamppb.New(advertisedStart)
 	event.AdvertisedStartTime = ts
 
-	endTime := timestamppb.New(advertisedStart.Add(time.Minute * time.Duration(duration)))
-	event.ExpectedEndTime = endTime
+	event.Timezone, event.LocalStartTime = localTime(advertisedStart, row.timezone.String)
 
-	event.Status = getEventStatus(&event, &requestTime)
+	expectedEnd := advertisedStart.Add(time.Minute * time.Duration(row.duration))
+	event.ExpectedEndTime = timestamppb.New(expectedEnd)
+
+	//A score is only recorded once the event is underway
+	if row.final.Valid {
+		event.Score = &sports.Score{
+			HomeScore: row.homeScore.Int64,
+			AwayScore: row.awayScore.Int64,
+			Period:    row.period.Int64,
+			Clock:     row.clock.String,
+			Final:     row.final.Bool,
+		}
+	}
 
-	return &event, nil
+	event.Status = getEventStatus(&advertisedStart, &expectedEnd, event.Score, &requestTime)
+
+	return event, nil
 }
 
-func getEventStatus(event *sports.Event, requestTime *time.Time) string {
-	if event.AdvertisedStartTime.AsTime().After(*requestTime) {
+// Derive status from the recorded match state where available, so that delays
+// and overtime are reflected, falling back to the advertised times otherwise
+func getEventStatus(startTime *time.Time, endTime *time.Time, score *sports.Score, requestTime *time.Time) string {
+	if score != nil {
+		if score.Final {
+			return "CLOSED"
+		}
+		return "INPROGRESS"
+	}
+
+	if startTime.After(*requestTime) {
 		//advertised start time is in the future
 		return "OPEN"
-	} else if event.ExpectedEndTime.AsTime().Before(*requestTime) {
+	} else if endTime.Before(*requestTime) {
 		//expected end time is in the past
 		return "CLOSED"
 	} else {
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"git.neds.sh/matty/entain/sports/proto/sports"
+)
+
+// TeamsRepo provides repository access to teams.
+type TeamsRepo interface {
+	// List will return a list of teams.
+	List(ctx context.Context, filter *sports.ListTeamsRequestFilter, order_by string) ([]*sports.Team, error)
+
+	// Get will return an individual team
+	Get(ctx context.Context, id int64) (*sports.Team, error)
+}
+
+type teamsRepo struct {
+	db *sql.DB
+}
+
+// NewTeamsRepo creates a new teams repository.
+func NewTeamsRepo(db *sql.DB) TeamsRepo {
+	return &teamsRepo{db: db}
+}
+
+func (r *teamsRepo) Get(ctx context.Context, id int64) (*sports.Team, error) {
+	query := getSportQueries()[teamsList] + " WHERE team.id = ? GROUP BY team.id"
+
+	rows, done, err := queries.Query(ctx, r.db, "teams.get", query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	teams, err := r.scanTeams(rows)
+	if err != nil || len(teams) == 0 {
+		return nil, err
+	}
+
+	return teams[0], nil
+}
+
+func (r *teamsRepo) List(ctx context.Context, filter *sports.ListTeamsRequestFilter, order_by string) ([]*sports.Team, error) {
+	var (
+		err   error
+		query string
+		args  []interface{}
+	)
+
+	query = getSportQueries()[teamsList]
+
+	query, args = r.applyFilter(query, filter)
+
+	query += " GROUP BY team.id"
+
+	query = r.applySort(query, order_by)
+
+	rows, done, err := queries.Query(ctx, r.db, "teams.list", query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	return r.scanTeams(rows)
+}
+
+func (r *teamsRepo) applyFilter(query string, filter *sports.ListTeamsRequestFilter) (string, []interface{}) {
+	var (
+		clauses []string
+		args    []interface{}
+	)
+
+	if filter == nil {
+		return query, args
+	}
+
+	if len(filter.CompetitionIds) > 0 {
+		clauses = append(clauses, "team.id IN (SELECT team_id FROM competition_team WHERE competition_id IN ("+strings.Repeat("?,", len(filter.CompetitionIds)-1)+"?))")
+
+		for _, competitionID := range filter.CompetitionIds {
+			args = append(args, competitionID)
+		}
+	}
+
+	if len(clauses) != 0 {
+		query += " WHERE " + strings.Join(clauses, " AND ")
+	}
+
+	return query, args
+}
+
+// If order_by parameter is provided, send through to the SQL query
+func (r *teamsRepo) applySort(query string, order_by string) string {
+
+	if len(order_by) > 0 {
+		sanitised_order_by := sanitiseOrderBy(order_by)
+		if len(sanitised_order_by) > 0 {
+			query += " ORDER BY " + sanitised_order_by
+		}
+	}
+
+	return query
+}
+
+func (m *teamsRepo) scanTeams(
+	rows *sql.Rows,
+) ([]*sports.Team, error) {
+	var teams []*sports.Team
+
+	for rows.Next() {
+		var team sports.Team
+		var competitionIds sql.NullString
+
+		if err := rows.Scan(&team.Id, &team.Name, &team.Rank, &competitionIds); err != nil {
+			return nil, err
+		}
+
+		//Competition ids are aggregated into a comma separated list by the query
+		if competitionIds.Valid {
+			for _, competitionId := range strings.Split(competitionIds.String, ",") {
+				id, err := strconv.ParseInt(competitionId, 10, 64)
+				if err != nil {
+					return nil, err
+				}
+				team.CompetitionIds = append(team.CompetitionIds, id)
+			}
+		}
+
+		teams = append(teams, &team)
+	}
+
+	return teams, rows.Err()
+}
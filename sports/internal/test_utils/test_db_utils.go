@@ -13,11 +13,17 @@ type MockDbHelper interface {
 }
 
 type mockSportDb struct {
-	t               *testing.T
-	DB              *sql.DB
-	Mock            sqlmock.Sqlmock
-	ColumnNames     []string
-	JoinColumnNames []string
+	t                      *testing.T
+	DB                     *sql.DB
+	Mock                   sqlmock.Sqlmock
+	ColumnNames            []string
+	JoinColumnNames        []string
+	MarketColumnNames      []string
+	SelectionColumnNames   []string
+	TeamColumnNames        []string
+	CompetitionColumnNames []string
+	LocationColumnNames    []string
+	SearchColumnNames      []string
 }
 
 func NewMockSportDb(t *testing.T) MockDbHelper {
@@ -34,7 +40,13 @@ func (m *mockSportDb) Init() *mockSportDb {
 	m.DB = db
 	m.Mock = mock
 	m.ColumnNames = []string{"id", "team_home_id", "team_away_id", "sport_id", "location_id", "advertised_start_time", "duration"}
-	m.JoinColumnNames = []string{"id", "home_team", "away_team", "sport", "location", "capacity", "advertised_start_time", "duration"}
+	m.JoinColumnNames = []string{"id", "team_home_id", "home_team", "team_away_id", "away_team", "sport_id", "sport", "location_id", "location", "capacity", "timezone", "competition_id", "competition", "advertised_start_time", "duration", "home_score", "away_score", "period", "clock", "final"}
+	m.MarketColumnNames = []string{"id", "event_id", "name", "type", "line", "in_play", "advertised_start_time", "duration", "final"}
+	m.SelectionColumnNames = []string{"id", "market_id", "name", "price"}
+	m.TeamColumnNames = []string{"id", "name", "rank", "competition_ids"}
+	m.CompetitionColumnNames = []string{"id", "name", "sport", "season"}
+	m.LocationColumnNames = []string{"id", "city", "country", "timezone", "capacity"}
+	m.SearchColumnNames = []string{"type", "id", "title", "description", "score"}
 
 	m.Mock.MatchExpectationsInOrder(false)
 
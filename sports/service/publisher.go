@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"git.neds.sh/matty/entain/common/feed"
+	"git.neds.sh/matty/entain/common/logging"
+	"git.neds.sh/matty/entain/sports/db"
+	"git.neds.sh/matty/entain/sports/proto/sports"
+)
+
+// StatusPublisher publishes sport events to a feed of updates as their status changes, which
+// is as they start and as they are expected to end.
+type StatusPublisher struct {
+	sportsRepo db.SportsRepo
+	updates    *feed.Feed
+	last       time.Time
+	now        func() time.Time
+}
+
+// NewStatusPublisher creates a publisher of the status changes of events from now on.
+func NewStatusPublisher(sportsRepo db.SportsRepo, updates *feed.Feed) *StatusPublisher {
+	return &StatusPublisher{sportsRepo: sportsRepo, updates: updates, last: time.Now(), now: time.Now}
+}
+
+// Run publishes the status changes found every interval, until the context is done.
+func (p *StatusPublisher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Publish(ctx); err != nil {
+				logging.FromContext(ctx).Warn("failed publishing event status changes", "error", err)
+			}
+		}
+	}
+}
+
+// Publish publishes the events whose status changed since the last changes were published.
+func (p *StatusPublisher) Publish(ctx context.Context) error {
+	now := p.now()
+
+	events, err := p.sportsRepo.ListStatusChanges(ctx, p.last, now)
+	if err != nil {
+		//The window is listed again next time, so changes aren't lost while the database is unavailable
+		return err
+	}
+
+	for _, event := range events {
+		//Events with a score take their status from it, and are published as it is updated instead
+		if event.Score != nil {
+			continue
+		}
+		p.updates.Publish(&sports.WatchEventsResponse{Type: "STATUS", Event: event})
+	}
+
+	p.last = now
+	return nil
+}
@@ -1,42 +1,342 @@
 package service
 
 import (
+	"strings"
+
+	"git.neds.sh/matty/entain/common/feed"
+	"git.neds.sh/matty/entain/common/fieldmask"
 	"git.neds.sh/matty/entain/sports/db"
 	"git.neds.sh/matty/entain/sports/proto/sports"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Number of search results returned when no limit is requested, and the most that can be
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
 )
 
+// Most ids that can be requested in a batch
+const maxBatchIds = 100
+
 type Sports interface {
 	// ListSports will return a collection of sport events
 	ListEvents(ctx context.Context, in *sports.ListEventsRequest) (*sports.ListEventsResponse, error)
 	// GetSport will return a single sport event matching the requested id
 	GetEvent(ctx context.Context, in *sports.GetEventRequest) (*sports.GetEventResponse, error)
+	// BatchGetEvents will return the sport events matching a list of ids, in the order requested
+	BatchGetEvents(ctx context.Context, in *sports.BatchGetEventsRequest) (*sports.BatchGetEventsResponse, error)
+	// ListMarkets will return a collection of betting markets for sport events
+	ListMarkets(ctx context.Context, in *sports.ListMarketsRequest) (*sports.ListMarketsResponse, error)
+	// GetMarket will return a single betting market matching the requested id
+	GetMarket(ctx context.Context, in *sports.GetMarketRequest) (*sports.GetMarketResponse, error)
+	// UpdateScore will record the live score and match state of a sport event
+	UpdateScore(ctx context.Context, in *sports.UpdateScoreRequest) (*sports.UpdateScoreResponse, error)
+	// ListTeams will return a collection of teams
+	ListTeams(ctx context.Context, in *sports.ListTeamsRequest) (*sports.ListTeamsResponse, error)
+	// GetTeam will return a single team matching the requested id
+	GetTeam(ctx context.Context, in *sports.GetTeamRequest) (*sports.GetTeamResponse, error)
+	// ListCompetitions will return a collection of competitions
+	ListCompetitions(ctx context.Context, in *sports.ListCompetitionsRequest) (*sports.ListCompetitionsResponse, error)
+	// GetStandings will return the standings table of a competition computed from final results
+	GetStandings(ctx context.Context, in *sports.GetStandingsRequest) (*sports.GetStandingsResponse, error)
+	// ListLocations will return a collection of venues
+	ListLocations(ctx context.Context, in *sports.ListLocationsRequest) (*sports.ListLocationsResponse, error)
+	// GetLocation will return a single venue matching the requested id
+	GetLocation(ctx context.Context, in *sports.GetLocationRequest) (*sports.GetLocationResponse, error)
+	// Search will return events, teams and venues matching a full-text query, best matches first
+	Search(ctx context.Context, in *sports.SearchRequest) (*sports.SearchResponse, error)
+	// WatchEvents will stream sport events as their status or score changes, published to the feed of updates
+	WatchEvents(in *sports.WatchEventsRequest, stream sports.Sports_WatchEventsServer) error
 }
 
 // sportsService implements the Sports interface.
 type sportsService struct {
-	sportsRepo db.SportsRepo
+	sportsRepo       db.SportsRepo
+	marketsRepo      db.MarketsRepo
+	teamsRepo        db.TeamsRepo
+	competitionsRepo db.CompetitionsRepo
+	locationsRepo    db.LocationsRepo
+	searchRepo       db.SearchRepo
+	updates          *feed.Feed
 }
 
-// NewSportsService instantiates and returns a new sportsService.
-func NewSportsService(sportsRepo db.SportsRepo) Sports {
-	return &sportsService{sportsRepo}
+// NewSportsService instantiates and returns a new sportsService, publishing score updates to
+// the updates feed, and streaming what is published to it to watchers.
+func NewSportsService(sportsRepo db.SportsRepo, marketsRepo db.MarketsRepo, teamsRepo db.TeamsRepo, competitionsRepo db.CompetitionsRepo, locationsRepo db.LocationsRepo, searchRepo db.SearchRepo, updates *feed.Feed) Sports {
+	return &sportsService{sportsRepo, marketsRepo, teamsRepo, competitionsRepo, locationsRepo, searchRepo, updates}
 }
 
 func (s *sportsService) ListEvents(ctx context.Context, in *sports.ListEventsRequest) (*sports.ListEventsResponse, error) {
-	events, err := s.sportsRepo.List(in.Filter, in.OrderBy)
+	if err := fieldmask.Validate(in.ReadMask, &sports.Event{}); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid read mask: %v", err)
+	}
+	if in.PageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page size cannot be negative")
+	}
+
+	events, err := s.sportsRepo.List(ctx, in.Filter, in.OrderBy, fieldmask.Fields(in.ReadMask), in.PageSize)
 	if err != nil {
 		return nil, err
 	}
 
+	//Fields selected only to derive those wanted, or left empty as they weren't selected, are dropped
+	for _, event := range events {
+		fieldmask.Prune(event, in.ReadMask)
+	}
+
 	return &sports.ListEventsResponse{Events: events}, nil
 }
 
 func (s *sportsService) GetEvent(ctx context.Context, in *sports.GetEventRequest) (*sports.GetEventResponse, error) {
-	event, err := s.sportsRepo.Get(in.Id)
+	if err := fieldmask.Validate(in.ReadMask, &sports.Event{}); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid read mask: %v", err)
+	}
+
+	event, err := s.sportsRepo.Get(ctx, in.Id, fieldmask.Fields(in.ReadMask))
 	if err != nil {
 		return nil, err
 	}
 
+	if event != nil {
+		fieldmask.Prune(event, in.ReadMask)
+	}
+
 	return &sports.GetEventResponse{Event: event}, nil
 }
+
+func (s *sportsService) BatchGetEvents(ctx context.Context, in *sports.BatchGetEventsRequest) (*sports.BatchGetEventsResponse, error) {
+	if len(in.Ids) > maxBatchIds {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d ids can be requested", maxBatchIds)
+	}
+
+	//Ids requested more than once are only queried once
+	var ids []int64
+	seen := make(map[int64]bool)
+	for _, id := range in.Ids {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	events, err := s.sportsRepo.BatchGet(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byId := make(map[int64]*sports.Event, len(events))
+	for _, event := range events {
+		byId[event.Id] = event
+	}
+
+	results := make([]*sports.BatchGetEventsResult, len(in.Ids))
+	for i, id := range in.Ids {
+		event, found := byId[id]
+		results[i] = &sports.BatchGetEventsResult{Id: id, Found: found, Event: event}
+	}
+
+	return &sports.BatchGetEventsResponse{Results: results}, nil
+}
+
+func (s *sportsService) ListMarkets(ctx context.Context, in *sports.ListMarketsRequest) (*sports.ListMarketsResponse, error) {
+	markets, err := s.marketsRepo.List(ctx, in.Filter, in.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sports.ListMarketsResponse{Markets: markets}, nil
+}
+
+func (s *sportsService) GetMarket(ctx context.Context, in *sports.GetMarketRequest) (*sports.GetMarketResponse, error) {
+	market, err := s.marketsRepo.Get(ctx, in.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sports.GetMarketResponse{Market: market}, nil
+}
+
+func (s *sportsService) UpdateScore(ctx context.Context, in *sports.UpdateScoreRequest) (*sports.UpdateScoreResponse, error) {
+	score := in.Score
+	if score == nil {
+		return nil, status.Error(codes.InvalidArgument, "score is required")
+	}
+	if score.HomeScore < 0 || score.AwayScore < 0 || score.Period < 0 {
+		return nil, status.Error(codes.InvalidArgument, "score and period cannot be negative")
+	}
+
+	event, err := s.sportsRepo.Get(ctx, in.EventId, nil)
+	if err != nil {
+		return nil, err
+	}
+	if event == nil {
+		return nil, status.Errorf(codes.NotFound, "event %d not found", in.EventId)
+	}
+
+	if err := s.sportsRepo.UpdateScore(ctx, in.EventId, score); err != nil {
+		return nil, err
+	}
+
+	event, err = s.sportsRepo.Get(ctx, in.EventId, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.updates.Publish(&sports.WatchEventsResponse{Type: "SCORE", Event: event})
+
+	return &sports.UpdateScoreResponse{Event: event}, nil
+}
+
+func (s *sportsService) ListTeams(ctx context.Context, in *sports.ListTeamsRequest) (*sports.ListTeamsResponse, error) {
+	teams, err := s.teamsRepo.List(ctx, in.Filter, in.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sports.ListTeamsResponse{Teams: teams}, nil
+}
+
+func (s *sportsService) GetTeam(ctx context.Context, in *sports.GetTeamRequest) (*sports.GetTeamResponse, error) {
+	team, err := s.teamsRepo.Get(ctx, in.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sports.GetTeamResponse{Team: team}, nil
+}
+
+func (s *sportsService) ListCompetitions(ctx context.Context, in *sports.ListCompetitionsRequest) (*sports.ListCompetitionsResponse, error) {
+	competitions, err := s.competitionsRepo.List(ctx, in.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sports.ListCompetitionsResponse{Competitions: competitions}, nil
+}
+
+func (s *sportsService) GetStandings(ctx context.Context, in *sports.GetStandingsRequest) (*sports.GetStandingsResponse, error) {
+	competition, err := s.competitionsRepo.Get(ctx, in.CompetitionId)
+	if err != nil {
+		return nil, err
+	}
+	if competition == nil {
+		return nil, status.Errorf(codes.NotFound, "competition %d not found", in.CompetitionId)
+	}
+
+	standings, err := s.competitionsRepo.Standings(ctx, in.CompetitionId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sports.GetStandingsResponse{Competition: competition, Standings: standings}, nil
+}
+
+func (s *sportsService) ListLocations(ctx context.Context, in *sports.ListLocationsRequest) (*sports.ListLocationsResponse, error) {
+	locations, err := s.locationsRepo.List(ctx, in.Filter, in.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sports.ListLocationsResponse{Locations: locations}, nil
+}
+
+func (s *sportsService) GetLocation(ctx context.Context, in *sports.GetLocationRequest) (*sports.GetLocationResponse, error) {
+	location, err := s.locationsRepo.Get(ctx, in.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sports.GetLocationResponse{Location: location}, nil
+}
+
+func (s *sportsService) Search(ctx context.Context, in *sports.SearchRequest) (*sports.SearchResponse, error) {
+	if len(strings.TrimSpace(in.Query)) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "query is required")
+	}
+
+	limit := in.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	} else if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	results, err := s.searchRepo.Search(ctx, in.Query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sports.SearchResponse{Results: results}, nil
+}
+
+func (s *sportsService) WatchEvents(in *sports.WatchEventsRequest, stream sports.Sports_WatchEventsServer) error {
+	watcher, resumed := s.updates.Watch(in.AfterId)
+	defer watcher.Close()
+
+	//Headers are sent straight away so clients know the watch started before any update is sent
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	if !resumed {
+		if err := stream.Send(&sports.WatchEventsResponse{Id: watcher.Latest(), Missed: true}); err != nil {
+			return err
+		}
+	}
+
+	for {
+		update, err := watcher.Next(stream.Context())
+		if err == feed.ErrLagged {
+			return status.Error(codes.ResourceExhausted, "watcher fell behind, resume after the last update received")
+		}
+		if err == feed.ErrClosed {
+			return status.Error(codes.Unavailable, "service shutting down, resume after the last update received")
+		}
+		if err != nil {
+			return status.FromContextError(err).Err()
+		}
+
+		published := update.Message.(*sports.WatchEventsResponse)
+		if !watchMatches(in.Filter, published) {
+			continue
+		}
+
+		if err := stream.Send(&sports.WatchEventsResponse{Id: update.Id, Type: published.Type, Event: published.Event}); err != nil {
+			return err
+		}
+	}
+}
+
+// Updates match a watch filter if they are of a type watched, and the event matches every list
+// of ids given
+func watchMatches(filter *sports.WatchEventsRequestFilter, update *sports.WatchEventsResponse) bool {
+	if len(filter.GetTypes()) > 0 {
+		watched := false
+		for _, t := range filter.Types {
+			watched = watched || strings.EqualFold(t, update.Type)
+		}
+		if !watched {
+			return false
+		}
+	}
+
+	event := update.Event
+	return containsId(filter.GetEventIds(), event.Id) &&
+		containsId(filter.GetSportIds(), event.Sport.GetId()) &&
+		containsId(filter.GetCompetitionIds(), event.Competition.GetId()) &&
+		(containsId(filter.GetTeamIds(), event.HomeTeam.GetId()) || containsId(filter.GetTeamIds(), event.AwayTeam.GetId()))
+}
+
+// Empty lists of ids contain every id
+func containsId(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return len(ids) == 0
+}
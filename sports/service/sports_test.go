@@ -7,19 +7,68 @@ import (
 	"testing"
 	"time"
 
+	"git.neds.sh/matty/entain/common/feed"
 	"git.neds.sh/matty/entain/sports/db"
 	"git.neds.sh/matty/entain/sports/internal/test_utils"
 	"git.neds.sh/matty/entain/sports/proto/sports"
 	"github.com/DATA-DOG/go-sqlmock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// Query expected when listing or getting events, before any filters are applied
+const eventsQuery = `
+			SELECT
+				event.id,
+				team_home.id,
+				team_home.name as home_team,
+				team_away.id,
+				team_away.name as away_team,
+				sport.id,
+				sport.name as sport,
+				location.id,
+				location.city as location,
+				location.capacity,
+				location.timezone,
+				competition.id,
+				competition.name as competition,
+				event.advertised_start_time,
+				event.duration,
+				score.home_score,
+				score.away_score,
+				score.period,
+				score.clock,
+				score.final
+			FROM event
+			INNER JOIN team team_home ON team_home.id = event.team_home_id
+			INNER JOIN team team_away ON team_away.id = event.team_away_id
+			INNER JOIN sport ON sport.id = event.sport_id
+			INNER JOIN location ON location.id = event.location_id
+			LEFT JOIN competition ON competition.id = event.competition_id
+			LEFT JOIN score ON score.event_id = event.id`
+
+// Helper for creating the sports service with all repositories backed by the mock db
+func newTestSportsService(mockDb *sql.DB) Sports {
+	return NewSportsService(
+		db.NewSportsRepo(mockDb),
+		db.NewMarketsRepo(mockDb),
+		db.NewTeamsRepo(mockDb),
+		db.NewCompetitionsRepo(mockDb),
+		db.NewLocationsRepo(mockDb),
+		db.NewSearchRepo(mockDb),
+		feed.New(10),
+	)
+}
+
 // Helper harness for running list service procedure
 func listTestRun(t *testing.T, mockDb *sql.DB, request *sports.ListEventsRequest) *sports.ListEventsResponse {
 
 	//Create service using mock db and filter
-	mockSportsRepo := db.NewSportsRepo(mockDb)
-	sportsService := NewSportsService(mockSportsRepo)
+	sportsService := newTestSportsService(mockDb)
 
 	//Call service
 	listSportsResponse, err := sportsService.ListEvents(context.TODO(), request)
@@ -38,11 +87,12 @@ func listTestRun(t *testing.T, mockDb *sql.DB, request *sports.ListEventsRequest
 
 func compareEvents(r1 *sports.Event, r2 *sports.Event, t *testing.T) bool {
 	return r1.Id == r2.Id &&
-		r1.AwayTeam == r2.AwayTeam &&
-		r1.HomeTeam == r2.HomeTeam &&
-		r1.Location == r2.Location &&
+		proto.Equal(r1.AwayTeam, r2.AwayTeam) &&
+		proto.Equal(r1.HomeTeam, r2.HomeTeam) &&
+		proto.Equal(r1.Location, r2.Location) &&
+		proto.Equal(r1.Competition, r2.Competition) &&
 		r1.Capacity == r2.Capacity &&
-		r1.Sport == r2.Sport &&
+		proto.Equal(r1.Sport, r2.Sport) &&
 		r1.AdvertisedStartTime.Seconds == r2.AdvertisedStartTime.Seconds &&
 		r1.ExpectedEndTime.Seconds == r2.ExpectedEndTime.Seconds &&
 		r1.Status == r2.Status
@@ -79,20 +129,37 @@ func rowValuesFromEvent(t *testing.T, event *sports.Event) (values []driver.Valu
 	endTime := event.ExpectedEndTime.AsTime()
 	duration := endTime.Sub(startTime) / time.Minute
 
+	var competitionId, competitionName driver.Value
+	if event.Competition != nil {
+		competitionId, competitionName = event.Competition.Id, event.Competition.Name
+	}
+
 	return []driver.Value{
 		event.Id,
-		event.HomeTeam,
-		event.AwayTeam,
-		event.Sport,
-		event.Location,
+		event.HomeTeam.Id,
+		event.HomeTeam.Name,
+		event.AwayTeam.Id,
+		event.AwayTeam.Name,
+		event.Sport.Id,
+		event.Sport.Name,
+		event.Location.Id,
+		event.Location.Name,
 		event.Capacity,
+		event.Timezone,
+		competitionId,
+		competitionName,
 		startTime,
 		duration,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
 	}
 }
 
-// Tests list procedure with team filter
-func TestListEventsWithTeamFilter(t *testing.T) {
+// Tests list procedure with fuzzy text search
+func TestListEventsWithQueryFilter(t *testing.T) {
 	//Initiliase mock database
 	mockDbHelper := test_utils.NewMockSportDb(t)
 	mockDb := mockDbHelper.Init()
@@ -108,10 +175,10 @@ func TestListEventsWithTeamFilter(t *testing.T) {
 	sampleEvents := []*sports.Event{
 		{
 			Id:                  1,
-			HomeTeam:            "Brisbane Broncos",
-			AwayTeam:            "Gold Coast Titans",
-			Sport:               "Rugby league",
-			Location:            "Brisbane",
+			HomeTeam:            &sports.Reference{Id: 1, Name: "Brisbane Broncos"},
+			AwayTeam:            &sports.Reference{Id: 2, Name: "Gold Coast Titans"},
+			Sport:               &sports.Reference{Id: 1, Name: "Rugby league"},
+			Location:            &sports.Reference{Id: 1, Name: "Brisbane"},
 			Capacity:            30000,
 			AdvertisedStartTime: &mockStartTimestamp,
 			ExpectedEndTime:     &mockEndTimestamp,
@@ -119,10 +186,10 @@ func TestListEventsWithTeamFilter(t *testing.T) {
 		},
 		{
 			Id:                  2,
-			HomeTeam:            "Sydney Swans",
-			AwayTeam:            "Brisbane Cowboys",
-			Sport:               "Rugby league",
-			Location:            "Sydney",
+			HomeTeam:            &sports.Reference{Id: 3, Name: "Sydney Swans"},
+			AwayTeam:            &sports.Reference{Id: 4, Name: "Brisbane Cowboys"},
+			Sport:               &sports.Reference{Id: 1, Name: "Rugby league"},
+			Location:            &sports.Reference{Id: 2, Name: "Sydney"},
 			Capacity:            40000,
 			AdvertisedStartTime: &mockStartTimestamp,
 			ExpectedEndTime:     &mockEndTimestamp,
@@ -136,29 +203,14 @@ func TestListEventsWithTeamFilter(t *testing.T) {
 	}
 
 	mockDb.Mock.
-		ExpectQuery(`
-			SELECT
-				event.id,
-				team_home.name as home_team,
-				team_away.name as away_team,
-				sport.name as sport,
-				location.city as location,
-				location.capacity,
-				event.advertised_start_time,
-				event.duration
-			FROM event
-			INNER JOIN team team_home ON team_home.id = event.team_home_id
-			INNER JOIN team team_away ON team_away.id = event.team_away_id
-			INNER JOIN sport ON sport.id = event.sport_id
-			INNER JOIN location ON location.id = event.location_id
-			WHERE (home_team LIKE ? OR away_team LIKE ?)`).
-		WithArgs("%"+teamSearch+"%", "%"+teamSearch+"%").
+		ExpectQuery(eventsQuery+` WHERE (team_home.name LIKE ? OR team_away.name LIKE ? OR sport.name LIKE ? OR location.city LIKE ?)`).
+		WithArgs("%"+teamSearch+"%", "%"+teamSearch+"%", "%"+teamSearch+"%", "%"+teamSearch+"%").
 		WillReturnRows(includedRows)
 
 	//Create mock request and filter as input
 	listEventsRequest := sports.ListEventsRequest{
 		Filter: &sports.ListEventsRequestFilter{
-			Team: teamSearch,
+			Query: teamSearch,
 		},
 	}
 
@@ -187,10 +239,10 @@ func TestListEventsWithStatusFilter(t *testing.T) {
 	sampleEvents := []*sports.Event{
 		{
 			Id:                  1,
-			HomeTeam:            "Brisbane Broncos",
-			AwayTeam:            "Gold Coast Titans",
-			Sport:               "Rugby league",
-			Location:            "Brisbane",
+			HomeTeam:            &sports.Reference{Id: 1, Name: "Brisbane Broncos"},
+			AwayTeam:            &sports.Reference{Id: 2, Name: "Gold Coast Titans"},
+			Sport:               &sports.Reference{Id: 1, Name: "Rugby league"},
+			Location:            &sports.Reference{Id: 1, Name: "Brisbane"},
 			Capacity:            30000,
 			AdvertisedStartTime: &mockStartTimestamp,
 			ExpectedEndTime:     &mockEndTimestamp,
@@ -198,10 +250,10 @@ func TestListEventsWithStatusFilter(t *testing.T) {
 		},
 		{
 			Id:                  2,
-			HomeTeam:            "Sydney Swans",
-			AwayTeam:            "Brisbane Cowboys",
-			Sport:               "Rugby league",
-			Location:            "Sydney",
+			HomeTeam:            &sports.Reference{Id: 3, Name: "Sydney Swans"},
+			AwayTeam:            &sports.Reference{Id: 4, Name: "Brisbane Cowboys"},
+			Sport:               &sports.Reference{Id: 1, Name: "Rugby league"},
+			Location:            &sports.Reference{Id: 2, Name: "Sydney"},
 			Capacity:            40000,
 			AdvertisedStartTime: &mockStartTimestamp,
 			ExpectedEndTime:     &mockEndTimestamp,
@@ -215,21 +267,7 @@ func TestListEventsWithStatusFilter(t *testing.T) {
 	}
 
 	mockDb.Mock.
-		ExpectQuery(`
-			SELECT
-				event.id,
-				team_home.name as home_team,
-				team_away.name as away_team,
-				sport.name as sport,
-				location.city as location,
-				location.capacity,
-				event.advertised_start_time,
-				event.duration
-			FROM event
-			INNER JOIN team team_home ON team_home.id = event.team_home_id
-			INNER JOIN team team_away ON team_away.id = event.team_away_id
-			INNER JOIN sport ON sport.id = event.sport_id
-			INNER JOIN location ON location.id = event.location_id`).
+		ExpectQuery(eventsQuery).
 		WillReturnRows(includedRows)
 
 	//Create mock request and filter as input
@@ -247,6 +285,72 @@ func TestListEventsWithStatusFilter(t *testing.T) {
 	sportsResultAssertions(t, sampleEvents, listResponse.Events, mockDb.Mock)
 }
 
+// Tests list procedure returns at most the page size requested, limiting the query unless
+// events are filtered by their derived status
+func TestListEventsWithPageSize(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	var currentTime = time.Now()
+	var mockStartTimestamp timestamppb.Timestamp = *timestamppb.New(currentTime.Add(10 * time.Minute))
+	var mockEndTimestamp timestamppb.Timestamp = *timestamppb.New(currentTime.Add(40 * time.Minute))
+
+	//Events to return for expected query/args
+	sampleEvents := []*sports.Event{
+		{
+			Id:                  1,
+			HomeTeam:            &sports.Reference{Id: 1, Name: "Brisbane Broncos"},
+			AwayTeam:            &sports.Reference{Id: 2, Name: "Gold Coast Titans"},
+			Sport:               &sports.Reference{Id: 1, Name: "Rugby league"},
+			Location:            &sports.Reference{Id: 1, Name: "Brisbane"},
+			Capacity:            30000,
+			AdvertisedStartTime: &mockStartTimestamp,
+			ExpectedEndTime:     &mockEndTimestamp,
+			Status:              "OPEN",
+		},
+		{
+			Id:                  2,
+			HomeTeam:            &sports.Reference{Id: 3, Name: "Sydney Swans"},
+			AwayTeam:            &sports.Reference{Id: 4, Name: "Brisbane Cowboys"},
+			Sport:               &sports.Reference{Id: 1, Name: "Rugby league"},
+			Location:            &sports.Reference{Id: 2, Name: "Sydney"},
+			Capacity:            40000,
+			AdvertisedStartTime: &mockStartTimestamp,
+			ExpectedEndTime:     &mockEndTimestamp,
+			Status:              "OPEN",
+		},
+	}
+
+	limitedRows := mockDb.Mock.NewRows(mockDb.JoinColumnNames)
+	limitedRows.AddRow(rowValuesFromEvent(t, sampleEvents[0])...)
+
+	mockDb.Mock.
+		ExpectQuery(eventsQuery + ` LIMIT ?`).
+		WithArgs(1).
+		WillReturnRows(limitedRows)
+
+	listResponse := listTestRun(t, mockDb.DB, &sports.ListEventsRequest{PageSize: 1})
+
+	sportsResultAssertions(t, sampleEvents[:1], listResponse.Events, mockDb.Mock)
+
+	includedRows := mockDb.Mock.NewRows(mockDb.JoinColumnNames)
+	for _, event := range sampleEvents {
+		includedRows.AddRow(rowValuesFromEvent(t, event)...)
+	}
+
+	mockDb.Mock.
+		ExpectQuery(eventsQuery).
+		WillReturnRows(includedRows)
+
+	listResponse = listTestRun(t, mockDb.DB, &sports.ListEventsRequest{Filter: &sports.ListEventsRequestFilter{Status: "OPEN"}, PageSize: 1})
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	sportsResultAssertions(t, sampleEvents[:1], listResponse.Events, mockDb.Mock)
+}
+
 // Tests list procedure with status calculation based on time
 func TestListEventsStatusCalculation(t *testing.T) {
 	//Initiliase mock database
@@ -262,10 +366,10 @@ func TestListEventsStatusCalculation(t *testing.T) {
 	sampleEvents := []*sports.Event{
 		{
 			Id:                  1,
-			HomeTeam:            "Brisbane Broncos",
-			AwayTeam:            "Gold Coast Titans",
-			Sport:               "Rugby league",
-			Location:            "Brisbane",
+			HomeTeam:            &sports.Reference{Id: 1, Name: "Brisbane Broncos"},
+			AwayTeam:            &sports.Reference{Id: 2, Name: "Gold Coast Titans"},
+			Sport:               &sports.Reference{Id: 1, Name: "Rugby league"},
+			Location:            &sports.Reference{Id: 1, Name: "Brisbane"},
 			Capacity:            30000,
 			AdvertisedStartTime: timestamppb.New(currentTime.Add(-10 * time.Minute)),
 			ExpectedEndTime:     timestamppb.New(currentTime.Add(10 * time.Minute)),
@@ -273,10 +377,10 @@ func TestListEventsStatusCalculation(t *testing.T) {
 		},
 		{
 			Id:                  2,
-			HomeTeam:            "Sydney Swans",
-			AwayTeam:            "Brisbane Cowboys",
-			Sport:               "Rugby league",
-			Location:            "Sydney",
+			HomeTeam:            &sports.Reference{Id: 3, Name: "Sydney Swans"},
+			AwayTeam:            &sports.Reference{Id: 4, Name: "Brisbane Cowboys"},
+			Sport:               &sports.Reference{Id: 1, Name: "Rugby league"},
+			Location:            &sports.Reference{Id: 2, Name: "Sydney"},
 			Capacity:            40000,
 			AdvertisedStartTime: timestamppb.New(currentTime.Add(-20 * time.Minute)),
 			ExpectedEndTime:     timestamppb.New(currentTime.Add(-10 * time.Minute)),
@@ -284,10 +388,10 @@ func TestListEventsStatusCalculation(t *testing.T) {
 		},
 		{
 			Id:                  3,
-			HomeTeam:            "Sydney Swans",
-			AwayTeam:            "Canberra Raiders",
-			Sport:               "Rugby league",
-			Location:            "Sydney",
+			HomeTeam:            &sports.Reference{Id: 3, Name: "Sydney Swans"},
+			AwayTeam:            &sports.Reference{Id: 5, Name: "Canberra Raiders"},
+			Sport:               &sports.Reference{Id: 1, Name: "Rugby league"},
+			Location:            &sports.Reference{Id: 2, Name: "Sydney"},
 			Capacity:            40000,
 			AdvertisedStartTime: timestamppb.New(currentTime.Add(10 * time.Minute)),
 			ExpectedEndTime:     timestamppb.New(currentTime.Add(20 * time.Minute)),
@@ -301,21 +405,7 @@ func TestListEventsStatusCalculation(t *testing.T) {
 	}
 
 	mockDb.Mock.
-		ExpectQuery(`
-			SELECT
-				event.id,
-				team_home.name as home_team,
-				team_away.name as away_team,
-				sport.name as sport,
-				location.city as location,
-				location.capacity,
-				event.advertised_start_time,
-				event.duration
-			FROM event
-			INNER JOIN team team_home ON team_home.id = event.team_home_id
-			INNER JOIN team team_away ON team_away.id = event.team_away_id
-			INNER JOIN sport ON sport.id = event.sport_id
-			INNER JOIN location ON location.id = event.location_id`).
+		ExpectQuery(eventsQuery).
 		WillReturnRows(includedRows)
 
 	//Create mock request and filter as input
@@ -345,10 +435,10 @@ func TestGetRace(t *testing.T) {
 	sampleEvents := []*sports.Event{
 		{
 			Id:                  2,
-			HomeTeam:            "Sydney Swans",
-			AwayTeam:            "Brisbane Cowboys",
-			Sport:               "Rugby league",
-			Location:            "Sydney",
+			HomeTeam:            &sports.Reference{Id: 3, Name: "Sydney Swans"},
+			AwayTeam:            &sports.Reference{Id: 4, Name: "Brisbane Cowboys"},
+			Sport:               &sports.Reference{Id: 1, Name: "Rugby league"},
+			Location:            &sports.Reference{Id: 2, Name: "Sydney"},
 			Capacity:            40000,
 			AdvertisedStartTime: &mockStartTimestamp,
 			ExpectedEndTime:     &mockEndTimestamp,
@@ -362,22 +452,7 @@ func TestGetRace(t *testing.T) {
 	}
 
 	mockDb.Mock.
-		ExpectQuery(`
-			SELECT
-				event.id,
-				team_home.name as home_team,
-				team_away.name as away_team,
-				sport.name as sport,
-				location.city as location,
-				location.capacity,
-				event.advertised_start_time,
-				event.duration
-			FROM event
-			INNER JOIN team team_home ON team_home.id = event.team_home_id
-			INNER JOIN team team_away ON team_away.id = event.team_away_id
-			INNER JOIN sport ON sport.id = event.sport_id
-			INNER JOIN location ON location.id = event.location_id
-			WHERE event.id = ?`).
+		ExpectQuery(eventsQuery + ` WHERE event.id = ?`).
 		WithArgs(2).
 		WillReturnRows(includedRows)
 
@@ -387,8 +462,7 @@ func TestGetRace(t *testing.T) {
 	}
 
 	//Create service using mock db and filter
-	mockSportsRepo := db.NewSportsRepo(mockDb.DB)
-	sportsService := NewSportsService(mockSportsRepo)
+	sportsService := newTestSportsService(mockDb.DB)
 
 	//Call service
 	getEventResponse, err := sportsService.GetEvent(context.TODO(), &getEventRequest)
@@ -407,3 +481,990 @@ func TestGetRace(t *testing.T) {
 
 	sportsResultAssertions(t, sampleEvents, []*sports.Event{getEventResponse.Event}, mockDb.Mock)
 }
+
+// Tests list markets procedure with suspension of markets while their event is in progress
+func TestListMarketsStatusCalculation(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	//Configure mock database for test data and expected results
+	var currentTime = time.Now()
+
+	//Markets to return for expected query/args
+	sampleMarkets := []*sports.Market{
+		{Id: 1, EventId: 1, Name: "Head to Head", Type: "HEAD_TO_HEAD", InPlay: false, Status: "SUSPENDED"},
+		{Id: 2, EventId: 1, Name: "Line", Type: "LINE", Line: -6.5, InPlay: true, Status: "OPEN"},
+		{Id: 3, EventId: 2, Name: "Total Points", Type: "TOTAL", Line: 160.5, InPlay: false, Status: "OPEN"},
+	}
+
+	//Event 1 is in progress, event 2 is yet to start
+	eventStarts := map[int64]time.Time{
+		1: currentTime.Add(-10 * time.Minute),
+		2: currentTime.Add(10 * time.Minute),
+	}
+
+	includedRows := mockDb.Mock.NewRows(mockDb.MarketColumnNames)
+	for _, market := range sampleMarkets {
+		includedRows.AddRow(market.Id, market.EventId, market.Name, market.Type, market.Line, market.InPlay, eventStarts[market.EventId], 80, nil)
+	}
+
+	mockDb.Mock.
+		ExpectQuery(`
+			SELECT
+				market.id,
+				market.event_id,
+				market.name,
+				market.type,
+				market.line,
+				market.in_play,
+				event.advertised_start_time,
+				event.duration,
+				score.final
+			FROM market
+			INNER JOIN event ON event.id = market.event_id
+			LEFT JOIN score ON score.event_id = event.id
+			WHERE market.event_id IN (?,?)`).
+		WithArgs(1, 2).
+		WillReturnRows(includedRows)
+
+	mockDb.Mock.
+		ExpectQuery(`SELECT id, market_id, name, price FROM selection WHERE market_id IN (?,?,?) ORDER BY id`).
+		WithArgs(1, 2, 3).
+		WillReturnRows(mockDb.Mock.NewRows(mockDb.SelectionColumnNames))
+
+	//Create mock request and filter as input
+	listMarketsRequest := sports.ListMarketsRequest{
+		Filter: &sports.ListMarketsRequestFilter{
+			EventIds: []int64{1, 2},
+		},
+	}
+
+	//Create service using mock db
+	sportsService := newTestSportsService(mockDb.DB)
+
+	//Call service
+	listMarketsResponse, err := sportsService.ListMarkets(context.TODO(), &listMarketsRequest)
+
+	//Fail test if errors occurred
+	if err != nil {
+		t.Fatalf("Error listing markets: %v", err)
+	}
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	if len(listMarketsResponse.Markets) != len(sampleMarkets) {
+		t.Fatalf("Returned markets not expected length. Expected %d, got %d", len(sampleMarkets), len(listMarketsResponse.Markets))
+	}
+
+	for i, market := range sampleMarkets {
+		if listMarketsResponse.Markets[i].Status != market.Status {
+			t.Errorf("Market[%d] status does not match. Expected %q, got %q", i, market.Status, listMarketsResponse.Markets[i].Status)
+		}
+	}
+
+	if err := mockDb.Mock.ExpectationsWereMet(); err != nil {
+		t.Error("One or more expectations were not met")
+		t.Error(err)
+	}
+}
+
+// Test getting a single market by id, including its selections
+func TestGetMarket(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	//Randomly chosed fixed date to use where time is not part of test
+	mockStartTime := time.Date(2021, time.March, 3, 11, 30, 57, 0, time.FixedZone("", 36000))
+
+	includedRows := mockDb.Mock.NewRows(mockDb.MarketColumnNames).
+		AddRow(4, 2, "Head to Head", "HEAD_TO_HEAD", 0, true, mockStartTime, 80, nil)
+
+	mockDb.Mock.
+		ExpectQuery(`
+			SELECT
+				market.id,
+				market.event_id,
+				market.name,
+				market.type,
+				market.line,
+				market.in_play,
+				event.advertised_start_time,
+				event.duration,
+				score.final
+			FROM market
+			INNER JOIN event ON event.id = market.event_id
+			LEFT JOIN score ON score.event_id = event.id
+			WHERE market.id = ?`).
+		WithArgs(4).
+		WillReturnRows(includedRows)
+
+	selectionRows := mockDb.Mock.NewRows(mockDb.SelectionColumnNames).
+		AddRow(7, 4, "Home", 1.85).
+		AddRow(8, 4, "Away", 2.05)
+
+	mockDb.Mock.
+		ExpectQuery(`SELECT id, market_id, name, price FROM selection WHERE market_id IN (?) ORDER BY id`).
+		WithArgs(4).
+		WillReturnRows(selectionRows)
+
+	//Create service using mock db
+	sportsService := newTestSportsService(mockDb.DB)
+
+	//Call service
+	getMarketResponse, err := sportsService.GetMarket(context.TODO(), &sports.GetMarketRequest{Id: 4})
+
+	//Fail test if errors occurred
+	if err != nil {
+		t.Fatalf("Error getting market: %v", err)
+	}
+
+	t.Log("get market response:")
+	t.Log(getMarketResponse)
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	market := getMarketResponse.Market
+	if market == nil || market.Id != 4 || market.Status != "CLOSED" {
+		t.Errorf("Returned market does not match expected market, got %v", market)
+	}
+
+	if market != nil && (len(market.Selections) != 2 || market.Selections[1].Name != "Away" || market.Selections[1].Price != 2.05) {
+		t.Errorf("Returned selections do not match expected selections, got %v", market.Selections)
+	}
+
+	if err := mockDb.Mock.ExpectationsWereMet(); err != nil {
+		t.Error("One or more expectations were not met")
+		t.Error(err)
+	}
+}
+
+// Tests list procedure with status derived from recorded scores in preference to time
+func TestListEventsStatusFromScore(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	//Configure mock database for test data and expected results
+	var currentTime = time.Now()
+
+	//Events to return for expected query/args
+	sampleEvents := []*sports.Event{
+		{
+			Id:                  1,
+			HomeTeam:            &sports.Reference{Id: 1, Name: "Brisbane Broncos"},
+			AwayTeam:            &sports.Reference{Id: 2, Name: "Gold Coast Titans"},
+			Sport:               &sports.Reference{Id: 1, Name: "Rugby league"},
+			Location:            &sports.Reference{Id: 1, Name: "Brisbane"},
+			Capacity:            30000,
+			AdvertisedStartTime: timestamppb.New(currentTime.Add(-90 * time.Minute)),
+			ExpectedEndTime:     timestamppb.New(currentTime.Add(-10 * time.Minute)),
+			Status:              "INPROGRESS",
+			Score:               &sports.Score{HomeScore: 18, AwayScore: 18, Period: 3, Clock: "02:30"},
+		},
+		{
+			Id:                  2,
+			HomeTeam:            &sports.Reference{Id: 3, Name: "Sydney Swans"},
+			AwayTeam:            &sports.Reference{Id: 4, Name: "Brisbane Cowboys"},
+			Sport:               &sports.Reference{Id: 1, Name: "Rugby league"},
+			Location:            &sports.Reference{Id: 2, Name: "Sydney"},
+			Capacity:            40000,
+			AdvertisedStartTime: timestamppb.New(currentTime.Add(-70 * time.Minute)),
+			ExpectedEndTime:     timestamppb.New(currentTime.Add(10 * time.Minute)),
+			Status:              "CLOSED",
+			Score:               &sports.Score{HomeScore: 40, AwayScore: 0, Period: 2, Clock: "00:00", Final: true},
+		},
+	}
+
+	includedRows := mockDb.Mock.NewRows(mockDb.JoinColumnNames)
+	for _, event := range sampleEvents {
+		values := rowValuesFromEvent(t, event)
+		values = append(values[:15], event.Score.HomeScore, event.Score.AwayScore, event.Score.Period, event.Score.Clock, event.Score.Final)
+		includedRows.AddRow(values...)
+	}
+
+	mockDb.Mock.
+		ExpectQuery(eventsQuery).
+		WillReturnRows(includedRows)
+
+	listResponse := listTestRun(t, mockDb.DB, &sports.ListEventsRequest{})
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	sportsResultAssertions(t, sampleEvents, listResponse.Events, mockDb.Mock)
+
+	for i, event := range sampleEvents {
+		if listResponse.Events[i].Score.GetHomeScore() != event.Score.HomeScore || listResponse.Events[i].Score.GetFinal() != event.Score.Final {
+			t.Errorf("Event[%d] score does not match. Expected %v, got %v", i, event.Score, listResponse.Events[i].Score)
+		}
+	}
+}
+
+// Test recording the score of an event
+func TestUpdateScore(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	//Configure mock database for test data and expected results
+	var currentTime = time.Now()
+	startTime := currentTime.Add(10 * time.Minute)
+
+	getQuery := eventsQuery + ` WHERE event.id = ?`
+
+	//The event is delayed, so has not started despite the score being recorded
+	mockDb.Mock.ExpectQuery(getQuery).
+		WithArgs(3).
+		WillReturnRows(mockDb.Mock.NewRows(mockDb.JoinColumnNames).
+			AddRow(3, 3, "Sydney Swans", 5, "Canberra Raiders", 1, "Rugby league", 2, "Sydney", 40000, "Australia/Sydney", 1, "Rugby league Premiership", startTime, 80, nil, nil, nil, nil, nil))
+
+	mockDb.Mock.ExpectPrepare(`
+			INSERT OR REPLACE INTO score (
+				event_id,
+				home_score,
+				away_score,
+				period,
+				clock,
+				final
+			) VALUES (?,?,?,?,?,?)`).
+		ExpectExec().
+		WithArgs(3, 6, 0, 1, "12:05", false).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+
+	mockDb.Mock.ExpectQuery(getQuery).
+		WithArgs(3).
+		WillReturnRows(mockDb.Mock.NewRows(mockDb.JoinColumnNames).
+			AddRow(3, 3, "Sydney Swans", 5, "Canberra Raiders", 1, "Rugby league", 2, "Sydney", 40000, "Australia/Sydney", 1, "Rugby league Premiership", startTime, 80, 6, 0, 1, "12:05", false))
+
+	//Create service using mock db
+	sportsService := newTestSportsService(mockDb.DB)
+
+	//Call service
+	updateScoreResponse, err := sportsService.UpdateScore(context.TODO(), &sports.UpdateScoreRequest{
+		EventId: 3,
+		Score:   &sports.Score{HomeScore: 6, AwayScore: 0, Period: 1, Clock: "12:05"},
+	})
+
+	//Fail test if errors occurred
+	if err != nil {
+		t.Fatalf("Error updating score: %v", err)
+	}
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	event := updateScoreResponse.Event
+	if event.Status != "INPROGRESS" || event.Score.GetHomeScore() != 6 || event.Score.GetClock() != "12:05" {
+		t.Errorf("Returned event does not reflect recorded score, got %v", event)
+	}
+
+	if err := mockDb.Mock.ExpectationsWereMet(); err != nil {
+		t.Error("One or more expectations were not met")
+		t.Error(err)
+	}
+}
+
+// Tests events are returned in the order requested, with ids no event matched reported as not found
+func TestBatchGetEvents(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	startTime := time.Now().Add(time.Hour)
+
+	mockDb.Mock.ExpectQuery(eventsQuery+` WHERE event.id IN (?,?,?)`).
+		WithArgs(3, 404, 1).
+		WillReturnRows(mockDb.Mock.NewRows(mockDb.JoinColumnNames).
+			AddRow(1, 1, "Brisbane Broncos", 2, "Melbourne Storm", 1, "Rugby league", 1, "Brisbane", 52500, "Australia/Brisbane", 1, "Rugby league Premiership", startTime, 80, nil, nil, nil, nil, nil).
+			AddRow(3, 3, "Sydney Swans", 5, "Canberra Raiders", 1, "Rugby league", 2, "Sydney", 40000, "Australia/Sydney", 1, "Rugby league Premiership", startTime, 80, nil, nil, nil, nil, nil))
+
+	//Create service using mock db
+	sportsService := newTestSportsService(mockDb.DB)
+
+	//Call service
+	response, err := sportsService.BatchGetEvents(context.TODO(), &sports.BatchGetEventsRequest{Ids: []int64{3, 404, 1}})
+	if err != nil {
+		t.Fatalf("Error getting events: %v", err)
+	}
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	var ids []int64
+	for _, result := range response.Results {
+		ids = append(ids, result.Id)
+		if result.Found != (result.Event != nil) || (result.Found && result.Event.Id != result.Id) {
+			t.Errorf("Unexpected result %v", result)
+		}
+	}
+	if len(ids) != 3 || ids[0] != 3 || ids[1] != 404 || ids[2] != 1 || response.Results[1].Found {
+		t.Errorf("Expected results in the order requested with 404 not found, got %v", response.Results)
+	}
+
+	if err := mockDb.Mock.ExpectationsWereMet(); err != nil {
+		t.Error("One or more expectations were not met")
+		t.Error(err)
+	}
+}
+
+// Tests recording a score invalidates the cached event, so the update is returned
+func TestUpdateScoreCached(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	startTime := time.Now().Add(-10 * time.Minute)
+	getQuery := eventsQuery + ` WHERE event.id = ?`
+
+	//The event is read once before the update, as the repeated read is served from the cache
+	mockDb.Mock.ExpectQuery(getQuery).
+		WithArgs(3).
+		WillReturnRows(mockDb.Mock.NewRows(mockDb.JoinColumnNames).
+			AddRow(3, 3, "Sydney Swans", 5, "Canberra Raiders", 1, "Rugby league", 2, "Sydney", 40000, "Australia/Sydney", 1, "Rugby league Premiership", startTime, 80, nil, nil, nil, nil, nil))
+
+	mockDb.Mock.ExpectPrepare(`
+			INSERT OR REPLACE INTO score (
+				event_id,
+				home_score,
+				away_score,
+				period,
+				clock,
+				final
+			) VALUES (?,?,?,?,?,?)`).
+		ExpectExec().
+		WithArgs(3, 6, 0, 1, "12:05", false).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+
+	mockDb.Mock.ExpectQuery(getQuery).
+		WithArgs(3).
+		WillReturnRows(mockDb.Mock.NewRows(mockDb.JoinColumnNames).
+			AddRow(3, 3, "Sydney Swans", 5, "Canberra Raiders", 1, "Rugby league", 2, "Sydney", 40000, "Australia/Sydney", 1, "Rugby league Premiership", startTime, 80, 6, 0, 1, "12:05", false))
+
+	//Create service using a cached repository over the mock db
+	sportsService := NewSportsService(
+		db.NewCachedSportsRepo(db.NewSportsRepo(mockDb.DB), 10, time.Minute),
+		db.NewMarketsRepo(mockDb.DB),
+		db.NewTeamsRepo(mockDb.DB),
+		db.NewCompetitionsRepo(mockDb.DB),
+		db.NewLocationsRepo(mockDb.DB),
+		db.NewSearchRepo(mockDb.DB),
+		feed.New(10),
+	)
+
+	if _, err := sportsService.GetEvent(context.TODO(), &sports.GetEventRequest{Id: 3}); err != nil {
+		t.Fatalf("Error getting event: %v", err)
+	}
+
+	updateScoreResponse, err := sportsService.UpdateScore(context.TODO(), &sports.UpdateScoreRequest{
+		EventId: 3,
+		Score:   &sports.Score{HomeScore: 6, AwayScore: 0, Period: 1, Clock: "12:05"},
+	})
+	if err != nil {
+		t.Fatalf("Error updating score: %v", err)
+	}
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	if event := updateScoreResponse.Event; event.Score.GetHomeScore() != 6 {
+		t.Errorf("Returned event does not reflect recorded score, got %v", event)
+	}
+
+	if err := mockDb.Mock.ExpectationsWereMet(); err != nil {
+		t.Error("One or more expectations were not met")
+		t.Error(err)
+	}
+}
+
+// Test recording the score of an event that does not exist
+func TestUpdateScoreNotFound(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	mockDb.Mock.ExpectQuery(eventsQuery + ` WHERE event.id = ?`).
+		WithArgs(404).
+		WillReturnRows(mockDb.Mock.NewRows(mockDb.JoinColumnNames))
+
+	//Create service using mock db
+	sportsService := newTestSportsService(mockDb.DB)
+
+	//Call service
+	_, err := sportsService.UpdateScore(context.TODO(), &sports.UpdateScoreRequest{
+		EventId: 404,
+		Score:   &sports.Score{HomeScore: 1},
+	})
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+
+	if err := mockDb.Mock.ExpectationsWereMet(); err != nil {
+		t.Error("One or more expectations were not met")
+		t.Error(err)
+	}
+}
+
+// Tests list procedure with exact sport, team and competition id filters
+func TestListEventsWithIdFilters(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	//Randomly chosed fixed date to use where time is not part of test
+	var mockStartTimestamp timestamppb.Timestamp = *timestamppb.New(time.Date(2021, time.March, 3, 11, 30, 57, 0, time.FixedZone("", 36000)))
+	var mockEndTimestamp timestamppb.Timestamp = *timestamppb.New(time.Date(2021, time.March, 3, 11, 50, 57, 0, time.FixedZone("", 36000)))
+
+	//Events to return for expected query/args
+	sampleEvents := []*sports.Event{
+		{
+			Id:                  1,
+			HomeTeam:            &sports.Reference{Id: 1, Name: "Brisbane Broncos"},
+			AwayTeam:            &sports.Reference{Id: 2, Name: "Gold Coast Titans"},
+			Sport:               &sports.Reference{Id: 1, Name: "Rugby league"},
+			Location:            &sports.Reference{Id: 1, Name: "Brisbane"},
+			Capacity:            30000,
+			AdvertisedStartTime: &mockStartTimestamp,
+			ExpectedEndTime:     &mockEndTimestamp,
+			Status:              "CLOSED",
+			Competition:         &sports.Reference{Id: 1, Name: "Rugby league Premiership"},
+		},
+	}
+
+	includedRows := mockDb.Mock.NewRows(mockDb.JoinColumnNames)
+	for _, event := range sampleEvents {
+		includedRows.AddRow(rowValuesFromEvent(t, event)...)
+	}
+
+	mockDb.Mock.
+		ExpectQuery(eventsQuery+` WHERE event.sport_id IN (?) AND (event.team_home_id IN (?,?) OR event.team_away_id IN (?,?)) AND event.competition_id IN (?)`).
+		WithArgs(1, 3, 4, 3, 4, 1).
+		WillReturnRows(includedRows)
+
+	//Create mock request and filter as input
+	listEventsRequest := sports.ListEventsRequest{
+		Filter: &sports.ListEventsRequestFilter{
+			SportIds:       []int64{1},
+			TeamIds:        []int64{3, 4},
+			CompetitionIds: []int64{1},
+		},
+	}
+
+	listResponse := listTestRun(t, mockDb.DB, &listEventsRequest)
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	sportsResultAssertions(t, sampleEvents, listResponse.Events, mockDb.Mock)
+}
+
+// Tests list events procedure with a start time window
+func TestListEventsWithStartWindow(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	windowStart := time.Date(2021, time.March, 3, 11, 30, 0, 0, time.FixedZone("", 36000))
+	var mockStartTimestamp timestamppb.Timestamp = *timestamppb.New(windowStart.Add(time.Minute))
+	var mockEndTimestamp timestamppb.Timestamp = *timestamppb.New(windowStart.Add(21 * time.Minute))
+
+	//Events to return for expected query/args
+	sampleEvents := []*sports.Event{
+		{
+			Id:                  1,
+			HomeTeam:            &sports.Reference{Id: 1, Name: "Brisbane Broncos"},
+			AwayTeam:            &sports.Reference{Id: 2, Name: "Gold Coast Titans"},
+			Sport:               &sports.Reference{Id: 1, Name: "Rugby league"},
+			Location:            &sports.Reference{Id: 1, Name: "Brisbane"},
+			Capacity:            30000,
+			AdvertisedStartTime: &mockStartTimestamp,
+			ExpectedEndTime:     &mockEndTimestamp,
+			Status:              "CLOSED",
+			Competition:         &sports.Reference{Id: 1, Name: "Rugby league Premiership"},
+		},
+	}
+
+	includedRows := mockDb.Mock.NewRows(mockDb.JoinColumnNames)
+	for _, event := range sampleEvents {
+		includedRows.AddRow(rowValuesFromEvent(t, event)...)
+	}
+
+	mockDb.Mock.
+		ExpectQuery(eventsQuery+` WHERE julianday(event.advertised_start_time) >= julianday(?) AND julianday(event.advertised_start_time) < julianday(?)`).
+		WithArgs("2021-03-03T01:30:00Z", "2021-03-03T02:30:00Z").
+		WillReturnRows(includedRows)
+
+	//Create mock request and filter as input
+	listEventsRequest := sports.ListEventsRequest{
+		Filter: &sports.ListEventsRequestFilter{
+			StartFrom:   timestamppb.New(windowStart),
+			StartBefore: timestamppb.New(windowStart.Add(time.Hour)),
+		},
+	}
+
+	listResponse := listTestRun(t, mockDb.DB, &listEventsRequest)
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	sportsResultAssertions(t, sampleEvents, listResponse.Events, mockDb.Mock)
+}
+
+// Tests a read mask selects only the columns needed, joining only the tables they and the
+// filters need, and returns only the fields requested
+func TestListEventsWithReadMask(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	startTime := time.Date(2021, time.March, 3, 11, 30, 57, 0, time.UTC)
+
+	mockDb.Mock.
+		ExpectQuery(`SELECT event.id, team_home.id, team_home.name as home_team, event.advertised_start_time FROM event INNER JOIN team team_home ON team_home.id = event.team_home_id INNER JOIN location ON location.id = event.location_id WHERE location.capacity >= ? ORDER BY advertised_start_time`).
+		WithArgs(30000).
+		WillReturnRows(mockDb.Mock.NewRows([]string{"id", "team_home_id", "home_team", "advertised_start_time"}).
+			AddRow(1, 1, "Brisbane Broncos", startTime))
+
+	listEventsRequest := sports.ListEventsRequest{
+		Filter:   &sports.ListEventsRequestFilter{MinCapacity: 30000},
+		OrderBy:  "advertised_start_time",
+		ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"home_team.name", "advertised_start_time"}},
+	}
+
+	listResponse := listTestRun(t, mockDb.DB, &listEventsRequest)
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	expected := &sports.Event{HomeTeam: &sports.Reference{Name: "Brisbane Broncos"}, AdvertisedStartTime: timestamppb.New(startTime)}
+	if len(listResponse.Events) != 1 || !proto.Equal(listResponse.Events[0], expected) {
+		t.Errorf("Expected %v, got %v", expected, listResponse.Events)
+	}
+
+	if err := mockDb.Mock.ExpectationsWereMet(); err != nil {
+		t.Error("One or more expectations were not met")
+		t.Error(err)
+	}
+
+	//Fields events don't have are rejected
+	_, err := newTestSportsService(mockDb.DB).GetEvent(context.TODO(), &sports.GetEventRequest{Id: 1, ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"home_team.colour"}}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected invalid argument error, got %v", err)
+	}
+}
+
+// Tests list teams procedure with competition filter
+func TestListTeamsWithCompetitionFilter(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	includedRows := mockDb.Mock.NewRows(mockDb.TeamColumnNames).
+		AddRow(1, "Brisbane Broncos", 2, "1,3").
+		AddRow(2, "Gold Coast Titans", 1, "1")
+
+	mockDb.Mock.
+		ExpectQuery(`
+			SELECT
+				team.id,
+				team.name,
+				team.rank,
+				GROUP_CONCAT(competition_team.competition_id) as competition_ids
+			FROM team
+			LEFT JOIN competition_team ON competition_team.team_id = team.id
+			WHERE team.id IN (SELECT team_id FROM competition_team WHERE competition_id IN (?))
+			GROUP BY team.id ORDER BY rank desc`).
+		WithArgs(1).
+		WillReturnRows(includedRows)
+
+	//Create service using mock db
+	sportsService := newTestSportsService(mockDb.DB)
+
+	//Call service
+	listTeamsResponse, err := sportsService.ListTeams(context.TODO(), &sports.ListTeamsRequest{
+		Filter:  &sports.ListTeamsRequestFilter{CompetitionIds: []int64{1}},
+		OrderBy: "rank desc",
+	})
+
+	//Fail test if errors occurred
+	if err != nil {
+		t.Fatalf("Error listing teams: %v", err)
+	}
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	teams := listTeamsResponse.Teams
+	if len(teams) != 2 || teams[0].Name != "Brisbane Broncos" || len(teams[0].CompetitionIds) != 2 || teams[0].CompetitionIds[1] != 3 {
+		t.Errorf("Returned teams do not match expected teams, got %v", teams)
+	}
+
+	if err := mockDb.Mock.ExpectationsWereMet(); err != nil {
+		t.Error("One or more expectations were not met")
+		t.Error(err)
+	}
+}
+
+// Tests standings are computed and ordered from final results
+func TestGetStandings(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	mockDb.Mock.
+		ExpectQuery(`
+			SELECT
+				competition.id,
+				competition.name,
+				sport.name as sport,
+				competition.season
+			FROM competition
+			INNER JOIN sport ON sport.id = competition.sport_id
+			WHERE competition.id = ?`).
+		WithArgs(1).
+		WillReturnRows(mockDb.Mock.NewRows(mockDb.CompetitionColumnNames).
+			AddRow(1, "Rugby league Premiership", "Rugby league", "2021"))
+
+	mockDb.Mock.
+		ExpectQuery(`
+			SELECT
+				team.id,
+				team.name
+			FROM competition_team
+			INNER JOIN team ON team.id = competition_team.team_id
+			WHERE competition_team.competition_id = ?`).
+		WithArgs(1).
+		WillReturnRows(mockDb.Mock.NewRows([]string{"id", "name"}).
+			AddRow(1, "Brisbane Broncos").
+			AddRow(2, "Gold Coast Titans").
+			AddRow(3, "Sydney Roosters"))
+
+	mockDb.Mock.
+		ExpectQuery(`
+			SELECT
+				event.team_home_id,
+				event.team_away_id,
+				score.home_score,
+				score.away_score
+			FROM event
+			INNER JOIN score ON score.event_id = event.id
+			WHERE event.competition_id = ?
+				AND score.final = 1`).
+		WithArgs(1).
+		WillReturnRows(mockDb.Mock.NewRows([]string{"team_home_id", "team_away_id", "home_score", "away_score"}).
+			AddRow(1, 2, 12, 18).
+			AddRow(3, 1, 10, 10).
+			AddRow(2, 3, 24, 6))
+
+	//Create service using mock db
+	sportsService := newTestSportsService(mockDb.DB)
+
+	//Call service
+	getStandingsResponse, err := sportsService.GetStandings(context.TODO(), &sports.GetStandingsRequest{CompetitionId: 1})
+
+	//Fail test if errors occurred
+	if err != nil {
+		t.Fatalf("Error getting standings: %v", err)
+	}
+
+	t.Log("get standings response:")
+	t.Log(getStandingsResponse)
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	expectedStandings := []*sports.Standing{
+		{Position: 1, TeamId: 2, TeamName: "Gold Coast Titans", Played: 2, Won: 2, PointsFor: 42, PointsAgainst: 18, CompetitionPoints: 4},
+		{Position: 2, TeamId: 1, TeamName: "Brisbane Broncos", Played: 2, Drawn: 1, Lost: 1, PointsFor: 22, PointsAgainst: 28, CompetitionPoints: 1},
+		{Position: 3, TeamId: 3, TeamName: "Sydney Roosters", Played: 2, Drawn: 1, Lost: 1, PointsFor: 16, PointsAgainst: 34, CompetitionPoints: 1},
+	}
+
+	standings := getStandingsResponse.Standings
+	if len(standings) != len(expectedStandings) {
+		t.Fatalf("Returned standings not expected length. Expected %d, got %d", len(expectedStandings), len(standings))
+	}
+
+	for i, expected := range expectedStandings {
+		if !proto.Equal(expected, standings[i]) {
+			t.Errorf("Standing[%d] does not match. Expected %v, got %v", i, expected, standings[i])
+		}
+	}
+
+	if err := mockDb.Mock.ExpectationsWereMet(); err != nil {
+		t.Error("One or more expectations were not met")
+		t.Error(err)
+	}
+}
+
+// Tests list procedure with venue filters and start times local to the venue
+func TestListEventsWithLocationFilter(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	//Randomly chosed fixed date to use where time is not part of test
+	var mockStartTimestamp timestamppb.Timestamp = *timestamppb.New(time.Date(2021, time.March, 3, 1, 30, 57, 0, time.UTC))
+	var mockEndTimestamp timestamppb.Timestamp = *timestamppb.New(time.Date(2021, time.March, 3, 1, 50, 57, 0, time.UTC))
+
+	//Events to return for expected query/args
+	sampleEvents := []*sports.Event{
+		{
+			Id:                  1,
+			HomeTeam:            &sports.Reference{Id: 1, Name: "Brisbane Broncos"},
+			AwayTeam:            &sports.Reference{Id: 2, Name: "Gold Coast Titans"},
+			Sport:               &sports.Reference{Id: 1, Name: "Rugby league"},
+			Location:            &sports.Reference{Id: 1, Name: "Brisbane"},
+			Capacity:            52500,
+			Timezone:            "Australia/Brisbane",
+			AdvertisedStartTime: &mockStartTimestamp,
+			ExpectedEndTime:     &mockEndTimestamp,
+			Status:              "CLOSED",
+		},
+		{
+			Id:                  2,
+			HomeTeam:            &sports.Reference{Id: 3, Name: "Sydney Swans"},
+			AwayTeam:            &sports.Reference{Id: 4, Name: "Brisbane Cowboys"},
+			Sport:               &sports.Reference{Id: 1, Name: "Rugby league"},
+			Location:            &sports.Reference{Id: 2, Name: "Sydney"},
+			Capacity:            48000,
+			AdvertisedStartTime: &mockStartTimestamp,
+			ExpectedEndTime:     &mockEndTimestamp,
+			Status:              "CLOSED",
+		},
+	}
+
+	includedRows := mockDb.Mock.NewRows(mockDb.JoinColumnNames)
+	for _, event := range sampleEvents {
+		includedRows.AddRow(rowValuesFromEvent(t, event)...)
+	}
+
+	mockDb.Mock.
+		ExpectQuery(eventsQuery+` WHERE event.location_id IN (?,?) AND location.capacity >= ?`).
+		WithArgs(1, 2, 40000).
+		WillReturnRows(includedRows)
+
+	//Create mock request and filter as input
+	listEventsRequest := sports.ListEventsRequest{
+		Filter: &sports.ListEventsRequestFilter{
+			LocationIds: []int64{1, 2},
+			MinCapacity: 40000,
+		},
+	}
+
+	listResponse := listTestRun(t, mockDb.DB, &listEventsRequest)
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	sportsResultAssertions(t, sampleEvents, listResponse.Events, mockDb.Mock)
+
+	//Venues without a timezone fall back to UTC
+	expectedLocalTimes := []string{"2021-03-03T11:30:57+10:00", "2021-03-03T01:30:57Z"}
+	expectedTimezones := []string{"Australia/Brisbane", "UTC"}
+	for i, event := range listResponse.Events {
+		if event.LocalStartTime != expectedLocalTimes[i] || event.Timezone != expectedTimezones[i] {
+			t.Errorf("Event[%d] local start time does not match. Expected %s %s, got %s %s", i, expectedLocalTimes[i], expectedTimezones[i], event.LocalStartTime, event.Timezone)
+		}
+	}
+}
+
+// Tests list locations procedure with capacity search
+func TestListLocationsWithCapacityFilter(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	includedRows := mockDb.Mock.NewRows(mockDb.LocationColumnNames).
+		AddRow(1, "Brisbane", "Australia", "Australia/Brisbane", 52500).
+		AddRow(2, "Sydney", "Australia", "Australia/Sydney", 48000)
+
+	mockDb.Mock.
+		ExpectQuery(`
+			SELECT
+				id,
+				city,
+				country,
+				timezone,
+				capacity
+			FROM location
+			WHERE country LIKE ? AND capacity >= ? ORDER BY capacity desc`).
+		WithArgs("australia", 40000).
+		WillReturnRows(includedRows)
+
+	//Create service using mock db
+	sportsService := newTestSportsService(mockDb.DB)
+
+	//Call service
+	listLocationsResponse, err := sportsService.ListLocations(context.TODO(), &sports.ListLocationsRequest{
+		Filter:  &sports.ListLocationsRequestFilter{Country: "australia", MinCapacity: 40000},
+		OrderBy: "capacity desc",
+	})
+
+	//Fail test if errors occurred
+	if err != nil {
+		t.Fatalf("Error listing locations: %v", err)
+	}
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	locations := listLocationsResponse.Locations
+	if len(locations) != 2 || locations[0].Timezone != "Australia/Brisbane" || locations[1].Capacity != 48000 {
+		t.Errorf("Returned locations do not match expected locations, got %v", locations)
+	}
+
+	if err := mockDb.Mock.ExpectationsWereMet(); err != nil {
+		t.Error("One or more expectations were not met")
+		t.Error(err)
+	}
+}
+
+// Tests search procedure converts free text into a prefix match and caps the number of results
+func TestSearch(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	//Configure mock database for test data and expected results
+	sampleResults := []*sports.SearchResult{
+		{Type: "TEAM", Id: 3, Title: "Brisbane Broncos", Description: "Rank 2", Score: 6.5},
+		{Type: "EVENT", Id: 12, Title: "Brisbane Broncos v Melbourne Storm", Description: "Rugby league at Brisbane, Rugby league Premiership", Score: 3.25},
+		{Type: "LOCATION", Id: 5, Title: "Brisbane", Description: "Australia", Score: 1.5},
+	}
+
+	includedRows := mockDb.Mock.NewRows(mockDb.SearchColumnNames)
+	for _, result := range sampleResults {
+		includedRows.AddRow(result.Type, result.Id, result.Title, result.Description, result.Score)
+	}
+
+	mockDb.Mock.
+		ExpectQuery(`SELECT type, id, title, description, -bm25(search_index, 0.0, 0.0, 10.0, 1.0) AS score FROM search_index WHERE search_index MATCH ? ORDER BY score DESC LIMIT ?`).
+		WithArgs(`"brisbane"* "bron"*`, 100).
+		WillReturnRows(includedRows)
+
+	//Create service using mock db
+	sportsService := newTestSportsService(mockDb.DB)
+
+	//Call service, with a limit above the maximum
+	searchResponse, err := sportsService.Search(context.TODO(), &sports.SearchRequest{Query: "brisbane bron", Limit: 1000})
+	if err != nil {
+		t.Fatalf("Error searching: %v", err)
+	}
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	if len(searchResponse.Results) != len(sampleResults) {
+		t.Fatalf("Expected %d results, got %d", len(sampleResults), len(searchResponse.Results))
+	}
+	for i, result := range sampleResults {
+		if !proto.Equal(result, searchResponse.Results[i]) {
+			t.Errorf("Expected result %v, got %v", result, searchResponse.Results[i])
+		}
+	}
+
+	if err := mockDb.Mock.ExpectationsWereMet(); err != nil {
+		t.Error("One or more expectations were not met")
+		t.Error(err)
+	}
+}
+
+// Stream of a watch call recording the updates sent, which ends the call once it has sent enough
+type mockWatchStream struct {
+	sports.Sports_WatchEventsServer
+	ctx    context.Context
+	cancel context.CancelFunc
+	sent   []*sports.WatchEventsResponse
+	limit  int
+}
+
+func newMockWatchStream(limit int) *mockWatchStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &mockWatchStream{ctx: ctx, cancel: cancel, limit: limit}
+}
+
+func (m *mockWatchStream) Context() context.Context {
+	return m.ctx
+}
+
+func (m *mockWatchStream) SendHeader(metadata.MD) error {
+	return nil
+}
+
+func (m *mockWatchStream) Send(response *sports.WatchEventsResponse) error {
+	m.sent = append(m.sent, response)
+	if len(m.sent) == m.limit {
+		m.cancel()
+	}
+	return nil
+}
+
+// Tests events starting or ending are published unless scored, and watchers resuming are sent
+// the updates matching their filter
+func TestWatchEvents(t *testing.T) {
+	//Initiliase mock database
+	mockDbHelper := test_utils.NewMockSportDb(t)
+	mockDb := mockDbHelper.Init()
+
+	//Configure mock database for events starting or ending within the window polled
+	windowStart := time.Date(2021, time.March, 2, 8, 0, 0, 0, time.UTC)
+	windowEnd := windowStart.Add(time.Second)
+
+	mockDb.Mock.
+		ExpectQuery(eventsQuery+` WHERE (julianday(event.advertised_start_time) >= julianday(?) AND julianday(event.advertised_start_time) < julianday(?))`+
+			` OR (julianday(event.advertised_start_time) + event.duration / 1440.0 >= julianday(?) AND julianday(event.advertised_start_time) + event.duration / 1440.0 < julianday(?))`+
+			` ORDER BY event.advertised_start_time, event.id`).
+		WithArgs(windowStart.Format(time.RFC3339), windowEnd.Format(time.RFC3339), windowStart.Format(time.RFC3339), windowEnd.Format(time.RFC3339)).
+		WillReturnRows(mockDb.Mock.NewRows(mockDb.JoinColumnNames).
+			AddRow(1, 3, "Sydney Swans", 5, "Canberra Raiders", 1, "Rugby league", 2, "Sydney", 40000, "Australia/Sydney", 1, "Rugby league Premiership", windowStart, 80, nil, nil, nil, nil, nil).
+			AddRow(2, 3, "Sydney Swans", 5, "Canberra Raiders", 1, "Rugby league", 2, "Sydney", 40000, "Australia/Sydney", 1, "Rugby league Premiership", windowStart, 80, 6, 0, 1, "00:01", false).
+			AddRow(4, 7, "Brisbane Lions", 8, "Geelong Cats", 2, "AFL", 2, "Sydney", 40000, "Australia/Sydney", nil, nil, windowStart, 120, nil, nil, nil, nil, nil))
+
+	//An update published before is resumed after, so that those published after it are replayed
+	updates := feed.New(10)
+	before := updates.Publish(&sports.WatchEventsResponse{Type: "SCORE", Event: &sports.Event{Id: 9}})
+
+	publisher := NewStatusPublisher(db.NewSportsRepo(mockDb.DB), updates)
+	publisher.last, publisher.now = windowStart, func() time.Time { return windowEnd }
+	if err := publisher.Publish(context.TODO()); err != nil {
+		t.Fatalf("Error publishing status changes: %v", err)
+	}
+	updates.Publish(&sports.WatchEventsResponse{Type: "SCORE", Event: &sports.Event{Id: 1, Sport: &sports.Reference{Id: 1}}})
+
+	sportsService := NewSportsService(nil, nil, nil, nil, nil, nil, updates)
+
+	//Only the status of event 1 is watched for, as event 2 is scored and event 4 is another sport
+	stream := newMockWatchStream(1)
+	err := sportsService.WatchEvents(&sports.WatchEventsRequest{
+		Filter:  &sports.WatchEventsRequestFilter{SportIds: []int64{1}, Types: []string{"status"}},
+		AfterId: before.Id,
+	}, stream)
+	if status.Code(err) != codes.Canceled {
+		t.Errorf("Expected the watch to end when cancelled, got %v", err)
+	}
+	if len(stream.sent) != 1 || stream.sent[0].Id != before.Id+1 || stream.sent[0].Type != "STATUS" || stream.sent[0].Event.Id != 1 {
+		t.Errorf("Expected the status of event 1 to be replayed, got %v", stream.sent)
+	}
+
+	//Resuming after an id from another run reports updates were missed
+	stream = newMockWatchStream(1)
+	sportsService.WatchEvents(&sports.WatchEventsRequest{AfterId: 1}, stream)
+	if len(stream.sent) != 1 || !stream.sent[0].Missed || stream.sent[0].Id != before.Id+3 {
+		t.Errorf("Expected missed updates to be reported, got %v", stream.sent)
+	}
+
+	//Cleanup mock database
+	mockDbHelper.Close()
+
+	if err := mockDb.Mock.ExpectationsWereMet(); err != nil {
+		t.Error("One or more expectations were not met")
+		t.Error(err)
+	}
+}